@@ -0,0 +1,57 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/cleaner"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+)
+
+// progressPrintPeriod is the minimum period between two progress lines of the built-in cleaners.
+const progressPrintPeriod = 10 * time.Second
+
+// runBlockCleaner runs the built-in cleaner selected by the block cleaner command in args on the
+// device in the LOCAL_PV_BLKDEVICE environment variable, as cleanup jobs do for the scripts.
+func runBlockCleaner(args []string) int {
+	defer klog.Flush()
+	blkdevPath := os.Getenv(common.LocalPVEnv)
+	if blkdevPath == "" {
+		klog.Errorf("%s environment variable not set", common.LocalPVEnv)
+		return 1
+	}
+	opts, err := cleaner.ParseCommand(args)
+	if err != nil {
+		klog.Error(err)
+		return 1
+	}
+	// The progress is printed with the protocol of the cleaner scripts, for the job logs.
+	progress := cleaner.Throttled(progressPrintPeriod, func(done, total int64) {
+		fmt.Println(cleaner.FormatProgress(done, total))
+	})
+	if err := cleaner.Clean(context.Background(), blkdevPath, opts, progress); err != nil {
+		klog.Errorf("Error cleaning %q: %v", blkdevPath, err)
+		return 1
+	}
+	klog.Infof("Completed cleanup of %q", blkdevPath)
+	return 0
+}
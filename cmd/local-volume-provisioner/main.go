@@ -22,49 +22,71 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/cleaner"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/controller"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/crdconfig"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/deleter"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/metrics"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/metrics/collectors"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/util"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/watcher"
 
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// configSourceConfigMap loads the configuration from the configmap mounted in the pod.
+	configSourceConfigMap = "ConfigMap"
+	// configSourceCRD loads the configuration from the LocalVolumeProvisionerConfig objects
+	// which select the node.
+	configSourceCRD = "CRD"
 )
 
 var (
-	optListenAddress string
-	optMetricsPath   string
-	discoveryPeriod  time.Duration
-	configSyncPeriod time.Duration
+	optListenAddress    string
+	optMetricsPath      string
+	discoveryPeriod     time.Duration
+	discoveryWatch      bool
+	fullDiscoveryPeriod time.Duration
+	configSyncPeriod    time.Duration
+	cleanupJournalDir   string
+	configSource        string
+	configDropInDir     string
 )
 
 func main() {
 	rand.Seed(time.Now().UTC().UnixNano())
 	klog.InitFlags(nil)
+	if len(os.Args) > 1 && os.Args[1] == cleaner.Subcommand {
+		os.Exit(runBlockCleaner(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == validateConfigSubcommand {
+		os.Exit(runValidateConfig(os.Args[2:]))
+	}
 	flag.StringVar(&optListenAddress, "listen-address", ":8080", "address on which to expose metrics and readiness status")
 	flag.StringVar(&optMetricsPath, "metrics-path", "/metrics", "path under which to expose metrics")
 	flag.DurationVar(&discoveryPeriod, "discovery-period", 10*time.Second, "the period for local volume discovery")
+	flag.BoolVar(&discoveryWatch, "discovery-watch", false, "watch the discovery directories and the mount table to discover new local volumes as soon as they show up")
+	flag.DurationVar(&fullDiscoveryPeriod, "full-discovery-period", 5*time.Minute, "the period for full local volume discovery when --discovery-watch is enabled")
 	flag.DurationVar(&configSyncPeriod, "config-sync-period", 5*time.Second, "the period to check if there has been any config changes")
+	flag.StringVar(&cleanupJournalDir, "cleanup-journal-dir", "", "directory on a host path where the state of the cleanups run by the provisioner is recorded, to know about the cleanups interrupted by a restart")
+	flag.StringVar(&configSource, "config-source", configSourceConfigMap, "where the configuration is loaded from: ConfigMap, the configmap mounted in "+common.ProvisionerConfigPath+", or CRD, the LocalVolumeProvisionerConfig objects which select the node")
+	flag.StringVar(&configDropInDir, "config-drop-in-dir", "", "directory on a host path containing node-local *.yaml and *.yml drop-in files whose storageClassMap and labelsForPV are merged with the configmap")
 	flag.Parse()
 	flag.Set("logtostderr", "true")
 
-	provisionerConfig := common.ProvisionerConfiguration{
-		StorageClassConfig: make(map[string]common.MountConfig),
-		MinResyncPeriod:    metav1.Duration{Duration: 5 * time.Minute},
-	}
-	if err := common.LoadProvisionerConfigs(common.ProvisionerConfigPath, &provisionerConfig); err != nil {
-		klog.Fatalf("Error parsing Provisioner's configuration: %#v. Exiting...\n", err)
-	}
-	klog.Infof("Loaded configuration: %+v", provisionerConfig)
-	klog.Infof("Ready to run...")
-
 	nodeName := os.Getenv("MY_NODE_NAME")
 	if nodeName == "" {
 		klog.Fatalf("MY_NODE_NAME environment variable not set\n")
@@ -84,25 +106,82 @@ func main() {
 	client := common.SetupClient()
 	node := util.GetNode(client.CoreV1(), nodeName)
 
+	var loadConfig common.ConfigLoader
+	switch configSource {
+	case configSourceConfigMap:
+		loadConfig = common.ConfigMapLoader(common.ProvisionerConfigPath, configDropInDir)
+	case configSourceCRD:
+		if configDropInDir != "" {
+			klog.Fatalf("Drop-in files are only merged with the %s config source", configSourceConfigMap)
+		}
+		loader, err := crdconfig.NewLoader(client, common.SetupDynamicClient(), nodeName, wait.NeverStop)
+		if err != nil {
+			klog.Fatalf("Error watching the %s objects: %v", crdconfig.Kind, err)
+		}
+		loadConfig = loader.Load
+	default:
+		klog.Fatalf("Unsupported config source %q", configSource)
+	}
+	provisionerConfig := common.ProvisionerConfiguration{
+		StorageClassConfig: make(map[string]common.MountConfig),
+		MinResyncPeriod:    metav1.Duration{Duration: 5 * time.Minute},
+	}
+	if err := loadConfig(&provisionerConfig); err != nil {
+		klog.Fatalf("Error parsing Provisioner's configuration: %v. Exiting...\n", err)
+	}
+	klog.Infof("Loaded configuration: %+v", provisionerConfig)
+	klog.Infof("Ready to run...")
+
 	configUpdate := make(chan common.ProvisionerConfiguration)
 	defer close(configUpdate)
 
-	configWatcher := watcher.NewConfigWatcher(common.ProvisionerConfigPath, configSyncPeriod, provisionerConfig)
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "local-volume-provisioner"})
+	configWatcher := watcher.NewConfigWatcher(loadConfig, configSyncPeriod, provisionerConfig, recorder, node)
+	if configDropInDir != "" {
+		if err := configWatcher.WatchDir(configDropInDir); err != nil {
+			klog.Warningf("Drop-in files are only reloaded every %v: %v", configSyncPeriod, err)
+		}
+	}
 	klog.Info("Starting config watcher\n")
 	go configWatcher.Run(configUpdate)
 
 	klog.Info("Starting controller\n")
 	procTable := deleter.NewProcTable()
-	go controller.RunLocalController(configUpdate, client, procTable, discoveryPeriod, node, namespace, jobImage, provisionerConfig)
+	var dirtyVolumes *deleter.DirtyVolumes
+	if cleanupJournalDir != "" {
+		journal, err := deleter.NewCleanupJournal(cleanupJournalDir)
+		if err != nil {
+			klog.Fatalf("Error initializing cleanup journal: %v", err)
+		}
+		procTable, err = deleter.NewJournaledProcTable(journal)
+		if err != nil {
+			klog.Fatalf("Error restoring cleanups from journal: %v", err)
+		}
+		dirtyVolumes, err = deleter.NewDirtyVolumes(filepath.Join(cleanupJournalDir, "dirty"))
+		if err != nil {
+			klog.Fatalf("Error initializing dirty volumes: %v", err)
+		}
+	} else {
+		klog.Warningf("No --cleanup-journal-dir set: the volumes whose PV is deleted before their cleanup completes are not tracked, and may be published again with the data of their previous user")
+	}
+	go controller.RunLocalController(configUpdate, client, procTable, dirtyVolumes, controller.DiscoveryOptions{Period: discoveryPeriod, Watch: discoveryWatch, FullPeriod: fullDiscoveryPeriod}, node, namespace, jobImage, provisionerConfig, configWatcher)
 
 	klog.Infof("Starting metrics server at %s\n", optListenAddress)
 	prometheus.MustRegister([]prometheus.Collector{
 		metrics.PersistentVolumeCapacityBytes,
+		metrics.PersistentVolumeCapacityMismatchBytes,
+		metrics.PersistentVolumeMissing,
 		metrics.PersistentVolumeDiscoveryTotal,
 		metrics.PersistentVolumeDiscoveryDurationSeconds,
 		metrics.PersistentVolumeDeleteTotal,
 		metrics.PersistentVolumeDeleteDurationSeconds,
 		metrics.PersistentVolumeDeleteFailedTotal,
+		metrics.CleanupProgressRatio,
+		metrics.CleanupJobsFailed,
+		metrics.CleanupQueueDepth,
+		metrics.ConfigReloadFailuresTotal,
 		metrics.APIServerRequestsTotal,
 		metrics.APIServerRequestsFailedTotal,
 		metrics.APIServerRequestsDurationSeconds,
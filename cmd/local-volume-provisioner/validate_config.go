@@ -0,0 +1,57 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+)
+
+// validateConfigSubcommand is the subcommand which validates a configuration without starting
+// the provisioner.
+const validateConfigSubcommand = "validate-config"
+
+// runValidateConfig loads the configuration in the directory given by args, laid out as the
+// mounted configmap with one file per key, merged with the drop-in files if a drop-in directory is
+// given, and reports whether the provisioner would accept it.
+func runValidateConfig(args []string) int {
+	flags := flag.NewFlagSet(validateConfigSubcommand, flag.ContinueOnError)
+	configDir := flags.String("config-dir", common.ProvisionerConfigPath, "directory containing one file per key of the provisioner configmap")
+	dropInDir := flags.String("config-drop-in-dir", "", "directory containing the node-local drop-in files merged with the configmap, if any")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %q\n", flags.Args())
+		return 2
+	}
+	provisionerConfig := common.ProvisionerConfiguration{
+		StorageClassConfig: make(map[string]common.MountConfig),
+		MinResyncPeriod:    metav1.Duration{Duration: 5 * time.Minute},
+	}
+	if err := common.LoadProvisionerConfigs(*configDir, *dropInDir, &provisionerConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration in %s: %v\n", *configDir, err)
+		return 1
+	}
+	fmt.Printf("configuration in %s is valid\n", *configDir)
+	return 0
+}
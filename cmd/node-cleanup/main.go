@@ -48,6 +48,7 @@ var (
 	workerThreads            = flag.Uint("worker-threads", 10, "Number of controller worker threads.")
 	pvcDeletionDelay         = flag.Duration("pvc-deletion-delay", 60*time.Second, "Duration, in seconds, to wait after Node deletion for PVC cleanup.")
 	stalePVDiscoveryInterval = flag.Duration("stale-pv-discovery-interval", 10*time.Second, "Duration, in seconds, the PV Deleter should wait between tries to clean up stale PVs.")
+	cleanupJobNamespace      = flag.String("cleanup-job-namespace", "", "Namespace of the cleanup jobs of the provisioners. The cleanup jobs which target deleted Nodes are deleted from it. Disabled if empty.")
 	listenAddress            = flag.String("listen-address", ":8080", "The TCP network address where the prometheus metrics endpoint will listen (example: `:8080`).")
 	metricsPath              = flag.String("metrics-path", "/metrics", "The HTTP path where prometheus metrics will be exposed.")
 )
@@ -83,7 +84,7 @@ func main() {
 		*storageClassNames,
 		*pvcDeletionDelay,
 		*stalePVDiscoveryInterval)
-	deleter := deleter.NewDeleter(clientset, pvInformer.Lister(), nodeInformer.Lister(), *storageClassNames)
+	deleter := deleter.NewDeleter(clientset, pvInformer.Lister(), nodeInformer.Lister(), *storageClassNames, *cleanupJobNamespace)
 
 	factory.Start(ctx.Done())
 
@@ -95,6 +96,8 @@ func main() {
 			metrics.PersistentVolumeDeleteFailedTotal,
 			metrics.PersistentVolumeClaimDeleteTotal,
 			metrics.PersistentVolumeClaimDeleteFailedTotal,
+			metrics.CleanupJobDeleteTotal,
+			metrics.CleanupJobDeleteFailedTotal,
 		}...)
 		gatherers := prometheus.Gatherers{
 			reg,
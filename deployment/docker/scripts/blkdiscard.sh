@@ -30,5 +30,8 @@ fi
 # Validate that we got a valid block device to cleanup
 validateBlockDevice
 
+size=$(blockDeviceSize)
+printProgress 0 $size
 echo "Calling blkdiscard"
 blkdiscard -v $LOCAL_PV_BLKDEVICE
+printProgress $size $size
@@ -29,6 +29,17 @@ function validateBlockDevice {
     fi
 }
 
+# Prints the progress of the cleanup as bytes done/bytes total, e.g. "progress: 1048576/10737418240",
+# which the provisioner reports on the PV when it runs the script itself.
+function printProgress {
+    echo "progress: $1/$2"
+}
+
+# Prints the size of the block device specified by environment variable LOCAL_PV_BLKDEVICE in bytes.
+function blockDeviceSize {
+    blockdev --getsize64 "$LOCAL_PV_BLKDEVICE"
+}
+
 function validateFilesystem {
     if [ -z ${LOCAL_PV_FILESYSTEM+x} ]
     then
@@ -51,11 +51,15 @@ fi
 # Validate that we got a valid block device to cleanup
 validateBlockDevice
 
+size=$(blockDeviceSize)
+total=`expr $size \* $iterations`
 counter=0
 while [ "$counter" -lt "$iterations" ]
 do
+   printProgress `expr $size \* $counter` $total
    echo "Running new iteration of dd"
    doZero
    counter=`expr $counter + 1`
 done
+printProgress $total $total
 
@@ -31,10 +31,13 @@ fi
 # Validate that we got a valid block device to cleanup
 validateBlockDevice
 
+size=$(blockDeviceSize)
+printProgress 0 $size
 echo "Calling mkfs"
 ionice -c 3 mkfs -F $LOCAL_PV_BLKDEVICE
 
 echo "Calling wipefs"
 ionice -c 3 wipefs -a $LOCAL_PV_BLKDEVICE
 
+printProgress $size $size
 echo "Quick reset completed"
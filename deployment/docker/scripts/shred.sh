@@ -40,4 +40,13 @@ if ! [[ $iterations =~ ^[0-9]+$ ]]; then
     errorExit "Number of iterations is not a number $iterations"
 fi
 
-ionice -c 3 shred -vzf -n $iterations $LOCAL_PV_BLKDEVICE
+# shred -v prints the pass it is running, e.g. "shred: /dev/sdb: pass 2/4 (random)...1.0GiB/10GiB 10%".
+set -o pipefail
+size=$(blockDeviceSize)
+ionice -c 3 shred -vzf -n $iterations $LOCAL_PV_BLKDEVICE 2>&1 | while read -r line; do
+  echo "$line"
+  if [[ $line =~ pass\ ([0-9]+)/([0-9]+)[^%]*[^0-9]([0-9]+)%$ ]]; then
+    printProgress `expr \( $size / 100 \) \* \( \( ${BASH_REMATCH[1]} - 1 \) \* 100 + ${BASH_REMATCH[3]} \) / ${BASH_REMATCH[2]}` $size
+  fi
+done
+printProgress $size $size
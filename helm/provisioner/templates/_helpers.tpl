@@ -40,3 +40,16 @@ Create the name of the service account to use
     {{ default "default" .Values.serviceAccount.name }}
 {{- end -}}
 {{- end -}}
+
+{{/*
+Whether the provisioner may clean up volumes with jobs, for any volume mode or class
+*/}}
+{{- define "provisioner.useJobs" -}}
+{{- $useJobs := or .Values.useJobForCleaning .Values.useJobForFilesystemCleaning -}}
+{{- range $classConfig := .Values.classes -}}
+{{- if $classConfig.useJobForCleaning -}}
+{{- $useJobs = true -}}
+{{- end -}}
+{{- end -}}
+{{- if $useJobs -}}true{{- end -}}
+{{- end -}}
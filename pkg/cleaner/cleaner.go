@@ -0,0 +1,170 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cleaner implements the built-in block device cleaners, which can be selected
+// instead of a script in the block cleaner command of a storage class.
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// BuiltinPrefix is the prefix of the block cleaner commands selecting a built-in cleaner
+	BuiltinPrefix = "builtin:"
+	// Subcommand is the provisioner subcommand running a built-in cleaner, used by cleanup jobs
+	Subcommand = "clean-block"
+
+	// MethodDiscard discards the device blocks with the BLKDISCARD ioctl
+	MethodDiscard = "discard"
+	// MethodSecureDiscard securely discards the device blocks with the BLKSECDISCARD ioctl
+	MethodSecureDiscard = "secdiscard"
+	// MethodZeroOut zeroes the device with the BLKZEROOUT ioctl, which the device may offload
+	MethodZeroOut = "zeroout"
+	// MethodZeroFill zeroes the device by writing zeros to it
+	MethodZeroFill = "zero-fill"
+
+	bytesPerSecondFlag = "--bytes-per-second="
+
+	// chunkSize is the size of the ranges cleaned at once, which bounds how late the rate limit is applied
+	chunkSize = 64 * 1024 * 1024
+	// writeSize is the size of the writes of the zero-fill method
+	writeSize = 1024 * 1024
+)
+
+// Options selects a built-in cleaner and configures it.
+type Options struct {
+	// Method is the cleaning method, one of the Method constants
+	Method string
+	// BytesPerSecond limits the cleaning throughput, 0 for no limit
+	BytesPerSecond int64
+}
+
+// IsBuiltin returns true if the block cleaner command selects a built-in cleaner.
+func IsBuiltin(command []string) bool {
+	return len(command) > 0 && strings.HasPrefix(command[0], BuiltinPrefix)
+}
+
+// ParseCommand returns the options of the built-in cleaner selected by the block cleaner command,
+// e.g. ["builtin:zeroout", "--bytes-per-second=100Mi"].
+func ParseCommand(command []string) (*Options, error) {
+	if !IsBuiltin(command) {
+		return nil, fmt.Errorf("%q is not a built-in cleaner", command)
+	}
+	opts := &Options{Method: strings.TrimPrefix(command[0], BuiltinPrefix)}
+	switch opts.Method {
+	case MethodDiscard, MethodSecureDiscard, MethodZeroOut, MethodZeroFill:
+	default:
+		return nil, fmt.Errorf("unknown built-in cleaner %q", command[0])
+	}
+	for _, arg := range command[1:] {
+		if !strings.HasPrefix(arg, bytesPerSecondFlag) {
+			return nil, fmt.Errorf("unknown argument %q for built-in cleaner %q", arg, command[0])
+		}
+		limit, err := resource.ParseQuantity(strings.TrimPrefix(arg, bytesPerSecondFlag))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bytes per second for built-in cleaner %q: %v", command[0], err)
+		}
+		if limit.Sign() < 0 {
+			return nil, fmt.Errorf("negative bytes per second %q for built-in cleaner %q", limit.String(), command[0])
+		}
+		opts.BytesPerSecond = limit.Value()
+	}
+	return opts, nil
+}
+
+// throttle reports the progress of the cleaning, delays it so that it doesn't go over the
+// configured throughput, and stops it once its context is done.
+type throttle struct {
+	ctx            context.Context
+	bytesPerSecond int64
+	total          int64
+	progress       ProgressFunc
+	start          time.Time
+	done           int64
+	now            func() time.Time
+	sleep          func(time.Duration)
+}
+
+func newThrottle(ctx context.Context, bytesPerSecond, total int64, progress ProgressFunc) *throttle {
+	return &throttle{
+		ctx:            ctx,
+		bytesPerSecond: bytesPerSecond,
+		total:          total,
+		progress:       progress,
+		start:          time.Now(),
+		now:            time.Now,
+		sleep: func(d time.Duration) {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+		},
+	}
+}
+
+// wait records that n more bytes have been cleaned, and sleeps until they are within the limit.
+// It returns an error if the context of the cleaning is done.
+func (t *throttle) wait(n int64) error {
+	t.done += n
+	if t.progress != nil {
+		t.progress(t.done, t.total)
+	}
+	if t.bytesPerSecond > 0 {
+		expected := time.Duration(float64(t.done) / float64(t.bytesPerSecond) * float64(time.Second))
+		if delay := expected - t.now().Sub(t.start); delay > 0 {
+			t.sleep(delay)
+		}
+	}
+	return t.ctx.Err()
+}
+
+// cleanRanges calls clean on consecutive ranges of the device, of at most chunkSize bytes.
+func cleanRanges(size int64, t *throttle, clean func(offset, length int64) error) error {
+	for offset := int64(0); offset < size; offset += chunkSize {
+		length := min(chunkSize, size-offset)
+		if err := clean(offset, length); err != nil {
+			return fmt.Errorf("error cleaning range [%d, %d): %v", offset, offset+length, err)
+		}
+		if err := t.wait(length); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zeroFill writes zeros over the first size bytes of w.
+func zeroFill(w io.WriterAt, size int64, t *throttle) error {
+	zeros := make([]byte, writeSize)
+	for offset := int64(0); offset < size; offset += writeSize {
+		length := min(writeSize, size-offset)
+		if _, err := w.WriteAt(zeros[:length], offset); err != nil {
+			return fmt.Errorf("error writing zeros at offset %d: %v", offset, err)
+		}
+		if err := t.wait(length); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+// blkSecDiscard is _IO(0x12, 125), which golang.org/x/sys/unix doesn't define
+const blkSecDiscard = 0x127d
+
+// Clean cleans the block device at devicePath with the built-in cleaner selected by opts, and
+// reports its progress to progress if not nil. The cleaning stops with an error once ctx is done.
+// The device is opened exclusively, so a device which is mounted or otherwise in use is not cleaned.
+func Clean(ctx context.Context, devicePath string, opts *Options, progress ProgressFunc) error {
+	file, err := os.OpenFile(devicePath, os.O_WRONLY|unix.O_EXCL, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var size uint64
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, file.Fd(), unix.BLKGETSIZE64, uintptr(unsafe.Pointer(&size))); errno != 0 {
+		return fmt.Errorf("error getting size of %q: %v", devicePath, errno)
+	}
+	klog.Infof("Cleaning %d bytes of %q with built-in cleaner %q, limited to %d bytes per second", size, devicePath,
+		opts.Method, opts.BytesPerSecond)
+
+	t := newThrottle(ctx, opts.BytesPerSecond, int64(size), progress)
+	switch opts.Method {
+	case MethodDiscard:
+		err = cleanRanges(int64(size), t, rangeIoctl(file, unix.BLKDISCARD))
+	case MethodSecureDiscard:
+		err = cleanRanges(int64(size), t, rangeIoctl(file, blkSecDiscard))
+	case MethodZeroOut:
+		err = cleanRanges(int64(size), t, rangeIoctl(file, unix.BLKZEROOUT))
+	case MethodZeroFill:
+		err = zeroFill(file, int64(size), t)
+	default:
+		err = fmt.Errorf("unknown built-in cleaner %q", opts.Method)
+	}
+	if err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// rangeIoctl returns a function applying an ioctl taking a [offset, length] range to the device.
+func rangeIoctl(file *os.File, req uintptr) func(offset, length int64) error {
+	return func(offset, length int64) error {
+		r := [2]uint64{uint64(offset), uint64(length)}
+		if _, _, errno := unix.Syscall(unix.SYS_IOCTL, file.Fd(), req, uintptr(unsafe.Pointer(&r))); errno != 0 {
+			return errno
+		}
+		return nil
+	}
+}
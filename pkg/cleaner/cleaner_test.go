@@ -0,0 +1,210 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		command     []string
+		expected    *Options
+		expectedErr bool
+	}{
+		{
+			command:  []string{"builtin:discard"},
+			expected: &Options{Method: MethodDiscard},
+		},
+		{
+			command:  []string{"builtin:secdiscard"},
+			expected: &Options{Method: MethodSecureDiscard},
+		},
+		{
+			command:  []string{"builtin:zeroout", "--bytes-per-second=100Mi"},
+			expected: &Options{Method: MethodZeroOut, BytesPerSecond: 100 * 1024 * 1024},
+		},
+		{
+			command:  []string{"builtin:zero-fill", "--bytes-per-second=1G"},
+			expected: &Options{Method: MethodZeroFill, BytesPerSecond: 1000 * 1000 * 1000},
+		},
+		{
+			command:     []string{"/scripts/quick_reset.sh"},
+			expectedErr: true,
+		},
+		{
+			command:     []string{"builtin:shred"},
+			expectedErr: true,
+		},
+		{
+			command:     []string{"builtin:zeroout", "--passes=3"},
+			expectedErr: true,
+		},
+		{
+			command:     []string{"builtin:zeroout", "--bytes-per-second=fast"},
+			expectedErr: true,
+		},
+		{
+			command:     []string{"builtin:zeroout", "--bytes-per-second=-1Mi"},
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		opts, err := ParseCommand(test.command)
+		if test.expectedErr {
+			if err == nil {
+				t.Errorf("command %q: expected error, got options %+v", test.command, opts)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("command %q: unexpected error: %v", test.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(opts, test.expected) {
+			t.Errorf("command %q: expected options %+v, got %+v", test.command, test.expected, opts)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	now := time.Unix(0, 0)
+	var slept time.Duration
+	th := &throttle{
+		ctx:            context.Background(),
+		bytesPerSecond: 100,
+		start:          now,
+		now:            func() time.Time { return now.Add(slept) },
+		sleep:          func(d time.Duration) { slept += d },
+	}
+
+	if err := th.wait(50); err != nil {
+		t.Fatal(err)
+	}
+	if slept != 500*time.Millisecond {
+		t.Errorf("expected to sleep 500ms after 50 bytes, slept %v", slept)
+	}
+	// Time spent cleaning counts towards the limit.
+	now = now.Add(200 * time.Millisecond)
+	if err := th.wait(100); err != nil {
+		t.Fatal(err)
+	}
+	if slept != 1300*time.Millisecond {
+		t.Errorf("expected to sleep 1.3s in total after 150 bytes, slept %v", slept)
+	}
+
+	unlimited := newThrottle(context.Background(), 0, 1<<30, nil)
+	unlimited.sleep = func(d time.Duration) { t.Errorf("unexpected sleep of %v without limit", d) }
+	if err := unlimited.wait(1 << 30); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCleanRanges(t *testing.T) {
+	size := int64(2*chunkSize + 10)
+	var ranges, progress [][2]int64
+	report := func(done, total int64) { progress = append(progress, [2]int64{done, total}) }
+	err := cleanRanges(size, newThrottle(context.Background(), 0, size, report), func(offset, length int64) error {
+		ranges = append(ranges, [2]int64{offset, length})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := [][2]int64{{0, chunkSize}, {chunkSize, chunkSize}, {2 * chunkSize, 10}}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("expected ranges %v, got %v", expected, ranges)
+	}
+	expectedProgress := [][2]int64{{chunkSize, size}, {2 * chunkSize, size}, {size, size}}
+	if !reflect.DeepEqual(progress, expectedProgress) {
+		t.Errorf("expected progress %v, got %v", expectedProgress, progress)
+	}
+}
+
+func TestCleanRanges_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	size := int64(4 * chunkSize)
+	cleaned := 0
+	err := cleanRanges(size, newThrottle(ctx, 0, size, nil), func(offset, length int64) error {
+		cleaned++
+		if cleaned == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("expected error %v, got %v", context.Canceled, err)
+	}
+	if cleaned != 2 {
+		t.Errorf("expected cleaning to stop after 2 ranges, cleaned %d", cleaned)
+	}
+}
+
+func TestParseProgress(t *testing.T) {
+	tests := []struct {
+		line          string
+		done, total   int64
+		expectedMatch bool
+	}{
+		{line: FormatProgress(1048576, 10737418240), done: 1048576, total: 10737418240, expectedMatch: true},
+		{line: "progress: 0/100", done: 0, total: 100, expectedMatch: true},
+		{line: "Running new iteration of dd"},
+		{line: "progress: 50%"},
+		{line: "progress: 200/100"},
+		{line: "progress: 0/0"},
+	}
+	for _, test := range tests {
+		done, total, ok := ParseProgress(test.line)
+		if ok != test.expectedMatch || done != test.done || total != test.total {
+			t.Errorf("line %q: expected (%d, %d, %v), got (%d, %d, %v)", test.line, test.done, test.total,
+				test.expectedMatch, done, total, ok)
+		}
+	}
+}
+
+func TestZeroFill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "device")
+	size := writeSize + 100
+	if err := os.WriteFile(path, bytes.Repeat([]byte{0xff}, size+10), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := zeroFill(file, int64(size), newThrottle(context.Background(), 0, int64(size), nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	file.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[:size], make([]byte, size)) {
+		t.Errorf("expected the first %d bytes to be zeroed", size)
+	}
+	if !bytes.Equal(data[size:], bytes.Repeat([]byte{0xff}, 10)) {
+		t.Errorf("expected the bytes past %d to be left as is", size)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// progressPrefix starts the lines of the progress protocol, e.g. "progress: 1048576/10737418240".
+const progressPrefix = "progress: "
+
+// ProgressFunc is called with the number of bytes cleaned so far and the total number of bytes to clean.
+type ProgressFunc func(done, total int64)
+
+// FormatProgress returns the line reporting the progress of a cleaner, which cleaner scripts
+// can print on their stdout to report their progress.
+func FormatProgress(done, total int64) string {
+	return fmt.Sprintf("%s%d/%d", progressPrefix, done, total)
+}
+
+// ParseProgress parses a line printed by a cleaner, and returns false if it doesn't report progress.
+func ParseProgress(line string) (done, total int64, ok bool) {
+	if !strings.HasPrefix(line, progressPrefix) {
+		return 0, 0, false
+	}
+	if _, err := fmt.Sscanf(strings.TrimPrefix(line, progressPrefix), "%d/%d", &done, &total); err != nil {
+		return 0, 0, false
+	}
+	if done < 0 || total <= 0 || done > total {
+		return 0, 0, false
+	}
+	return done, total, true
+}
+
+// Throttled returns a ProgressFunc calling f at most once per period, and once cleaning is complete.
+func Throttled(period time.Duration, f ProgressFunc) ProgressFunc {
+	var last time.Time
+	return func(done, total int64) {
+		if done < total && time.Since(last) < period {
+			return
+		}
+		last = time.Now()
+		f(done, total)
+	}
+}
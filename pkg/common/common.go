@@ -18,6 +18,7 @@ package common
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"hash/fnv"
 	"io/ioutil"
@@ -25,10 +26,13 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"k8s.io/klog/v2"
+	kjson "sigs.k8s.io/json"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/cache"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/cleaner"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/util"
 	"sigs.k8s.io/yaml"
 
@@ -38,6 +42,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
@@ -73,6 +79,53 @@ const (
 	AlphaStorageNodeAffinityAnnotation = "volume.alpha.kubernetes.io/node-affinity"
 	// VolumeDelete copied from k8s.io/kubernetes/pkg/controller/volume/events
 	VolumeDelete = "VolumeDelete"
+	// EventVolumeDeviceMismatch is the event reason used when the block device behind a PV
+	// no longer matches the device that was discovered for it
+	EventVolumeDeviceMismatch = "VolumeDeviceMismatch"
+	// EventVolumeDeviceUnknown is the event reason used when the identity of the block device
+	// behind a PV can't be read, e.g. because the path no longer resolves to a device
+	EventVolumeDeviceUnknown = "VolumeDeviceUnknown"
+	// EventVolumeResized is the event reason used when the capacity of an available PV
+	// is updated to the new size of its local volume
+	EventVolumeResized = "VolumeResized"
+	// EventVolumeCapacityMismatch is the event reason used when the local volume of a bound PV
+	// has been resized and the PV capacity no longer matches it
+	EventVolumeCapacityMismatch = "VolumeCapacityMismatch"
+	// EventVolumeMissing is the event reason used when the backing path of a PV is gone
+	// or is no longer a mount point
+	EventVolumeMissing = "VolumeMissing"
+	// EventVolumeCleanupQuarantined is the event reason used when the cleanup of a PV is no
+	// longer retried because it failed too many times
+	EventVolumeCleanupQuarantined = "VolumeCleanupQuarantined"
+	// EventVolumeCleanupLogs is the event reason used to record the last logs of the successful
+	// or expired failed cleanup job of a PV, before the job is deleted
+	EventVolumeCleanupLogs = "VolumeCleanupLogs"
+	// EventVolumeCleanupJobFailed is the event reason used when the cleanup job of a PV failed
+	EventVolumeCleanupJobFailed = "VolumeCleanupJobFailed"
+	// EventVolumeCleanupJobExpired is the event reason used when a failed cleanup job is deleted
+	// after its TTL, and counted as a failed cleanup
+	EventVolumeCleanupJobExpired = "VolumeCleanupJobExpired"
+	// EventProvisionerConfigInvalid is the event reason used on the node when the reloaded config
+	// of the provisioner is invalid, and the last applied one is kept
+	EventProvisionerConfigInvalid = "ProvisionerConfigInvalid"
+
+	// AnnDeviceWWN records the WWN of the block device backing a PV at discovery time
+	AnnDeviceWWN = "local-static-provisioner.sigs.k8s.io/device-wwn"
+	// AnnDeviceSerial records the serial number of the block device backing a PV at discovery time
+	AnnDeviceSerial = "local-static-provisioner.sigs.k8s.io/device-serial"
+	// AnnDevicePartUUID records the partition UUID of the block device backing a PV at discovery time
+	AnnDevicePartUUID = "local-static-provisioner.sigs.k8s.io/device-partuuid"
+
+	// ProvisionerBinaryPath is the path of the provisioner binary in its image, which
+	// cleanup jobs run to use the built-in block cleaners
+	ProvisionerBinaryPath = "/local-provisioner"
+
+	// AnnCleanupProgress reports the progress of the cleanup of a released block PV
+	AnnCleanupProgress = "local-static-provisioner.sigs.k8s.io/cleanup-progress"
+
+	// AnnCleanupQuarantined marks the PVs whose cleanup failed too many times, and which are not
+	// cleaned up again until it is removed
+	AnnCleanupQuarantined = "local-static-provisioner.sigs.k8s.io/cleanup-quarantined"
 
 	// LocalPVEnv will contain the device path when script is invoked
 	LocalPVEnv = "LOCAL_PV_BLKDEVICE"
@@ -89,6 +142,32 @@ const (
 
 	// DefaultNamePattern is the default name pattern list (separated by comma) of in PV discovery.
 	DefaultNamePattern = "*"
+
+	// MissingVolumePolicyIgnore does not check the backing paths of the existing PVs.
+	MissingVolumePolicyIgnore = "Ignore"
+	// MissingVolumePolicyReport reports the PVs whose backing path is missing with an event and a metric.
+	MissingVolumePolicyReport = "Report"
+	// MissingVolumePolicyDelete reports the PVs whose backing path is missing, and deletes the Available ones.
+	MissingVolumePolicyDelete = "Delete"
+	// DefaultMissingVolumePolicy is the default policy for PVs whose backing path is missing.
+	DefaultMissingVolumePolicy = MissingVolumePolicyReport
+
+	// PVNamingSchemeLegacy names the PVs after a hash of the file name, node name and storage class.
+	PVNamingSchemeLegacy = "Legacy"
+	// PVNamingSchemeDeviceIdentity names the PVs after a hash of the identity of the device, i.e. the
+	// WWN or serial of block devices and the filesystem UUID of mount points, along with the node and
+	// file name, so that the names survive renaming the storage class and change when another device
+	// shows up at the path.
+	PVNamingSchemeDeviceIdentity = "DeviceIdentity"
+	// DefaultPVNamingScheme is the default PV naming scheme.
+	DefaultPVNamingScheme = PVNamingSchemeLegacy
+
+	// CleanupQueueOrderOldestFirst starts the cleanups waiting for the concurrency limits in the
+	// order they were queued.
+	CleanupQueueOrderOldestFirst = "OldestFirst"
+	// CleanupQueueOrderSmallestFirst starts the cleanups waiting for the concurrency limits by
+	// increasing capacity of their PV, then in the order they were queued.
+	CleanupQueueOrderSmallestFirst = "SmallestFirst"
 )
 
 // UserConfig stores all the user-defined parameters to the provisioner
@@ -103,12 +182,22 @@ type UserConfig struct {
 	UseAlphaAPI bool
 	// UseJobForCleaning indicates if Jobs should be spawned for cleaning block devices (as opposed to process),.
 	UseJobForCleaning bool
+	// UseJobForFilesystemCleaning indicates if Jobs should be spawned for cleaning filesystem volumes.
+	UseJobForFilesystemCleaning bool
 	// Namespace of this Pod (optional)
 	Namespace string
 	// JobContainerImage of container to use for jobs (optional)
 	JobContainerImage string
 	// JobTolerations defines the tolerations to apply to jobs (optional)
 	JobTolerations []v1.Toleration
+	// JobTemplate customizes the cleanup jobs (optional)
+	JobTemplate *JobTemplate
+	// FailedCleanupJobTTL is how long failed cleanup jobs are kept, forever if 0 (optional)
+	FailedCleanupJobTTL metav1.Duration
+	// MaxConcurrentCleanups is how many cleanups may run at once on the node, unlimited if 0 (optional)
+	MaxConcurrentCleanups int
+	// CleanupQueueOrder is the order of the cleanups waiting for the concurrency limits (optional)
+	CleanupQueueOrder string
 	// MinResyncPeriod is minimum resync period. Resync period in reflectors
 	// will be random between MinResyncPeriod and 2*MinResyncPeriod.
 	MinResyncPeriod metav1.Duration
@@ -126,6 +215,38 @@ type UserConfig struct {
 	ProvisionerNotReadyNodeTaintKey string
 }
 
+// UseJobForCleaningVolume returns true if the volumes of the given mode and storage class
+// configuration are cleaned up by Jobs, rather than by the provisioner process.
+func (c *UserConfig) UseJobForCleaningVolume(mode v1.PersistentVolumeMode, config MountConfig) bool {
+	if mode == v1.PersistentVolumeFilesystem && config.ReformatOnRelease != nil {
+		// The volume must be unmounted and mounted again by the provisioner.
+		return false
+	}
+	if config.UseJobForCleaning != nil {
+		return *config.UseJobForCleaning
+	}
+	switch mode {
+	case v1.PersistentVolumeBlock:
+		return c.UseJobForCleaning
+	case v1.PersistentVolumeFilesystem:
+		return c.UseJobForFilesystemCleaning
+	}
+	return false
+}
+
+// UsesJobsForCleaning returns true if the volumes of any storage class may be cleaned up by Jobs.
+func (c *UserConfig) UsesJobsForCleaning() bool {
+	if c.UseJobForCleaning || c.UseJobForFilesystemCleaning {
+		return true
+	}
+	for _, config := range c.DiscoveryMap {
+		if config.UseJobForCleaning != nil && *config.UseJobForCleaning {
+			return true
+		}
+	}
+	return false
+}
+
 // MountConfig stores a configuration for discoverying a specific storageclass
 type MountConfig struct {
 	// The hostpath directory
@@ -134,6 +255,15 @@ type MountConfig struct {
 	MountDir string `json:"mountDir" yaml:"mountDir"`
 	// The type of block cleaner to use
 	BlockCleanerCommand []string `json:"blockCleanerCommand" yaml:"blockCleanerCommand"`
+	// The filesystem cleaner command, run with the LOCAL_PV_FILESYSTEM environment variable set
+	// to the volume path. The volume contents are removed by the provisioner (or by
+	// /scripts/fsclean.sh in cleanup jobs) if not specified.
+	// +optional
+	FilesystemCleanerCommand []string `json:"filesystemCleanerCommand" yaml:"filesystemCleanerCommand"`
+	// ReformatOnRelease cleans up the filesystem volumes, which must be the mount points of
+	// block devices, by formatting their device again instead of removing their contents.
+	// +optional
+	ReformatOnRelease *ReformatConfig `json:"reformatOnRelease" yaml:"reformatOnRelease"`
 	// The volume mode of created PersistentVolume object,
 	// default to Filesystem if not specified.
 	VolumeMode string `json:"volumeMode" yaml:"volumeMode"`
@@ -151,6 +281,127 @@ type MountConfig struct {
 	// Additional selector terms to set for node affinity in addition to the provisioner node name.
 	// Useful for shared disks as affinity can not be changed after provisioning the PV.
 	Selector []v1.NodeSelectorTerm `json:"selector" yaml:"selector"`
+	// MissingVolumePolicy defines what to do with the PVs whose backing path is missing or no
+	// longer a mount point: Ignore, Report or Delete. Report by default.
+	MissingVolumePolicy string `json:"missingVolumePolicy" yaml:"missingVolumePolicy"`
+	// PVNamingScheme defines how the PVs are named: Legacy or DeviceIdentity. Legacy by default.
+	// Changing it does not rename the existing PVs.
+	PVNamingScheme string `json:"pvNamingScheme" yaml:"pvNamingScheme"`
+	// CleanupTimeout is how long a block cleanup or a filesystem cleaner command may run before it is
+	// stopped and considered failed. No timeout by default.
+	CleanupTimeout metav1.Duration `json:"cleanupTimeout" yaml:"cleanupTimeout"`
+	// MaxCleanupAttempts is how many times the cleanup of a PV is attempted before the PV is
+	// quarantined. Unlimited by default.
+	MaxCleanupAttempts int `json:"maxCleanupAttempts" yaml:"maxCleanupAttempts"`
+	// MaxConcurrentCleanups is how many cleanups of the volumes of this class may run at once, in
+	// addition to the limit of the node. Unlimited by default.
+	// +optional
+	MaxConcurrentCleanups int `json:"maxConcurrentCleanups" yaml:"maxConcurrentCleanups"`
+	// UseJobForCleaning overrides useJobForCleaning and useJobForFilesystemCleaning for the volumes
+	// of this class, whatever their volume mode.
+	// +optional
+	UseJobForCleaning *bool `json:"useJobForCleaning" yaml:"useJobForCleaning"`
+	// JobTemplate overrides the fields of the provisioner job template for the cleanup jobs of the
+	// volumes of this class.
+	// +optional
+	JobTemplate *JobTemplate `json:"jobTemplate" yaml:"jobTemplate"`
+}
+
+// ReformatConfig configures how the device of a released filesystem volume is formatted again.
+type ReformatConfig struct {
+	// FsType is the type of the filesystem created on the device, e.g. ext4 or xfs
+	FsType string `json:"fsType" yaml:"fsType"`
+	// MkfsOptions are passed to mkfs before the device, e.g. -F for mkfs.ext4 or -f for mkfs.xfs
+	// to overwrite the previous filesystem
+	MkfsOptions []string `json:"mkfsOptions" yaml:"mkfsOptions"`
+	// MountOptions are the options the new filesystem is mounted with
+	MountOptions []string `json:"mountOptions" yaml:"mountOptions"`
+}
+
+// JobTemplate customizes the cleanup jobs spawned when UseJobForCleaning is enabled.
+// The fields which are not set keep the values generated by the provisioner.
+type JobTemplate struct {
+	// Labels are added to the job and its pod
+	Labels map[string]string `json:"labels" yaml:"labels"`
+	// Annotations are added to the job and its pod
+	Annotations map[string]string `json:"annotations" yaml:"annotations"`
+	// PriorityClassName is the priority class of the pod
+	PriorityClassName string `json:"priorityClassName" yaml:"priorityClassName"`
+	// ServiceAccountName is the service account the pod runs as
+	ServiceAccountName string `json:"serviceAccountName" yaml:"serviceAccountName"`
+	// Resources are the resource requests and limits of the cleaner container
+	Resources *v1.ResourceRequirements `json:"resources" yaml:"resources"`
+	// SecurityContext replaces the privileged security context of the cleaner container
+	SecurityContext *v1.SecurityContext `json:"securityContext" yaml:"securityContext"`
+	// PodSecurityContext is the security context of the pod
+	PodSecurityContext *v1.PodSecurityContext `json:"podSecurityContext" yaml:"podSecurityContext"`
+	// BackoffLimit is the backoff limit of the job, unless MaxCleanupAttempts is set
+	BackoffLimit *int32 `json:"backoffLimit" yaml:"backoffLimit"`
+	// ActiveDeadlineSeconds is the active deadline of the job, unless CleanupTimeout is set
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds" yaml:"activeDeadlineSeconds"`
+}
+
+// Merge returns the job template with the fields set in override replacing its own, and the
+// labels and annotations of both. Either template may be nil.
+func (t *JobTemplate) Merge(override *JobTemplate) *JobTemplate {
+	if t == nil {
+		return override
+	}
+	if override == nil {
+		return t
+	}
+	merged := *t
+	merged.Labels = mergeMaps(t.Labels, override.Labels)
+	merged.Annotations = mergeMaps(t.Annotations, override.Annotations)
+	if override.PriorityClassName != "" {
+		merged.PriorityClassName = override.PriorityClassName
+	}
+	if override.ServiceAccountName != "" {
+		merged.ServiceAccountName = override.ServiceAccountName
+	}
+	if override.Resources != nil {
+		merged.Resources = override.Resources
+	}
+	if override.SecurityContext != nil {
+		merged.SecurityContext = override.SecurityContext
+	}
+	if override.PodSecurityContext != nil {
+		merged.PodSecurityContext = override.PodSecurityContext
+	}
+	if override.BackoffLimit != nil {
+		merged.BackoffLimit = override.BackoffLimit
+	}
+	if override.ActiveDeadlineSeconds != nil {
+		merged.ActiveDeadlineSeconds = override.ActiveDeadlineSeconds
+	}
+	return &merged
+}
+
+func mergeMaps(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
+
+func validateJobTemplate(template *JobTemplate) error {
+	if template == nil {
+		return nil
+	}
+	if template.BackoffLimit != nil && *template.BackoffLimit < 0 {
+		return fmt.Errorf("invalid negative backoff limit %d", *template.BackoffLimit)
+	}
+	if template.ActiveDeadlineSeconds != nil && *template.ActiveDeadlineSeconds <= 0 {
+		return fmt.Errorf("invalid non-positive active deadline seconds %d", *template.ActiveDeadlineSeconds)
+	}
+	return nil
 }
 
 // RuntimeConfig stores all the objects that the provisioner needs to run
@@ -192,6 +443,7 @@ type LocalPVConfig struct {
 	MountOptions    []string
 	FsType          *string
 	Labels          map[string]string
+	Annotations     map[string]string
 	SetPVOwnerRef   bool
 	OwnerReference  *metav1.OwnerReference
 }
@@ -218,9 +470,29 @@ type ProvisionerConfiguration struct {
 	// default is false.
 	// +optional
 	UseJobForCleaning bool `json:"useJobForCleaning" yaml:"useJobForCleaning"`
+	// UseJobForFilesystemCleaning indicates if Jobs should be spawned for cleaning filesystem volumes
+	// (as opposed to process), default is false.
+	// +optional
+	UseJobForFilesystemCleaning bool `json:"useJobForFilesystemCleaning" yaml:"useJobForFilesystemCleaning"`
 	// JobTolerations defines the tolerations to apply to jobs
 	// +optional
 	JobTolerations []v1.Toleration `json:"jobTolerations" yaml:"jobTolerations"`
+	// JobTemplate customizes the cleanup jobs, and can be overridden per storage class
+	// +optional
+	JobTemplate *JobTemplate `json:"jobTemplate" yaml:"jobTemplate"`
+	// FailedCleanupJobTTL is how long failed cleanup jobs are kept for the administrator to look
+	// into, before they are deleted and the cleanup is retried. By default, failed jobs are kept,
+	// unless the storage class sets MaxCleanupAttempts.
+	// +optional
+	FailedCleanupJobTTL metav1.Duration `json:"failedCleanupJobTTL" yaml:"failedCleanupJobTTL"`
+	// MaxConcurrentCleanups is how many cleanups, by process or job, may run at once on the node.
+	// The other released PVs wait in a queue. Unlimited by default.
+	// +optional
+	MaxConcurrentCleanups int `json:"maxConcurrentCleanups" yaml:"maxConcurrentCleanups"`
+	// CleanupQueueOrder is the order the queued cleanups are started in: OldestFirst (default) or
+	// SmallestFirst.
+	// +optional
+	CleanupQueueOrder string `json:"cleanupQueueOrder" yaml:"cleanupQueueOrder"`
 	// MinResyncPeriod is minimum resync period. Resync period in reflectors
 	// will be random between MinResyncPeriod and 2*MinResyncPeriod.
 	MinResyncPeriod metav1.Duration `json:"minResyncPeriod" yaml:"minResyncPeriod"`
@@ -242,6 +514,15 @@ type ProvisionerConfiguration struct {
 	ProvisionerNotReadyNodeTaintKey string `json:"provisionerNotReadyNodeTaintKey" yaml:"provisionerNotReadyNodeTaintKey"`
 }
 
+// DropInConfiguration defines the configuration of a node-local drop-in file, merged with the
+// configmap by LoadProvisionerConfigs.
+type DropInConfiguration struct {
+	// StorageClassConfig defines storage classes, replacing the ones of the same name
+	StorageClassConfig map[string]MountConfig `json:"storageClassMap" yaml:"storageClassMap"`
+	// LabelsForPV defines additional labels of the PVs, overriding the ones of the same key
+	LabelsForPV map[string]string `json:"labelsForPV" yaml:"labelsForPV"`
+}
+
 // CreateLocalPVSpec returns a PV spec that can be used for PV creation
 func CreateLocalPVSpec(config *LocalPVConfig) *v1.PersistentVolume {
 	pv := &v1.PersistentVolume{
@@ -272,6 +553,10 @@ func CreateLocalPVSpec(config *LocalPVConfig) *v1.PersistentVolume {
 		},
 	}
 
+	for key, value := range config.Annotations {
+		pv.ObjectMeta.Annotations[key] = value
+	}
+
 	if config.AccessMode == "" {
 		pv.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}
 	}
@@ -291,6 +576,39 @@ func CreateLocalPVSpec(config *LocalPVConfig) *v1.PersistentVolume {
 	return pv
 }
 
+// BlockDeviceIdentityToAnnotations returns the PV annotations recording the given block device identity.
+// Identifiers the device does not report are left out.
+func BlockDeviceIdentityToAnnotations(id *util.BlockDeviceIdentity) map[string]string {
+	annotations := map[string]string{}
+	if id == nil {
+		return annotations
+	}
+	if id.WWN != "" {
+		annotations[AnnDeviceWWN] = id.WWN
+	}
+	if id.Serial != "" {
+		annotations[AnnDeviceSerial] = id.Serial
+	}
+	if id.PartUUID != "" {
+		annotations[AnnDevicePartUUID] = id.PartUUID
+	}
+	return annotations
+}
+
+// BlockDeviceIdentityFromAnnotations returns the block device identity recorded on the PV,
+// or nil if the PV was created without one.
+func BlockDeviceIdentityFromAnnotations(pv *v1.PersistentVolume) *util.BlockDeviceIdentity {
+	id := &util.BlockDeviceIdentity{
+		WWN:      pv.Annotations[AnnDeviceWWN],
+		Serial:   pv.Annotations[AnnDeviceSerial],
+		PartUUID: pv.Annotations[AnnDevicePartUUID],
+	}
+	if id.IsEmpty() {
+		return nil
+	}
+	return id
+}
+
 // GetContainerPath gets the local path (within provisioner container) of the PV
 func GetContainerPath(pv *v1.PersistentVolume, config MountConfig) (string, error) {
 	relativePath, err := filepath.Rel(config.HostDir, pv.Spec.Local.Path)
@@ -337,15 +655,28 @@ func VolumeConfigToConfigMapData(config *ProvisionerConfiguration) (map[string]s
 
 // ConfigMapDataToVolumeConfig converts configmap data to volume config.
 func ConfigMapDataToVolumeConfig(data map[string]string, provisionerConfig *ProvisionerConfiguration) error {
-	rawYaml := ""
-	for key, val := range data {
-		rawYaml += key
-		rawYaml += ": \n"
-		rawYaml += insertSpaces(string(val))
+	if err := decodeConfigMapData(data, provisionerConfig); err != nil {
+		return err
 	}
+	return validateProvisionerConfig(provisionerConfig)
+}
 
-	if err := yaml.Unmarshal([]byte(rawYaml), provisionerConfig); err != nil {
-		return fmt.Errorf("fail to Unmarshal yaml due to: %#v", err)
+// validateProvisionerConfig validates the decoded configuration, and sets the defaults of the
+// storage classes.
+func validateProvisionerConfig(provisionerConfig *ProvisionerConfiguration) error {
+	if err := validateJobTemplate(provisionerConfig.JobTemplate); err != nil {
+		return fmt.Errorf("Invalid job template: %v", err)
+	}
+	if provisionerConfig.FailedCleanupJobTTL.Duration < 0 {
+		return fmt.Errorf("invalid negative failed cleanup job TTL %v", provisionerConfig.FailedCleanupJobTTL.Duration)
+	}
+	if provisionerConfig.MaxConcurrentCleanups < 0 {
+		return fmt.Errorf("invalid negative max concurrent cleanups %d", provisionerConfig.MaxConcurrentCleanups)
+	}
+	switch provisionerConfig.CleanupQueueOrder {
+	case "", CleanupQueueOrderOldestFirst, CleanupQueueOrderSmallestFirst:
+	default:
+		return fmt.Errorf("unsupported cleanup queue order %q", provisionerConfig.CleanupQueueOrder)
 	}
 	for class, config := range provisionerConfig.StorageClassConfig {
 		if config.BlockCleanerCommand == nil {
@@ -356,6 +687,30 @@ func ConfigMapDataToVolumeConfig(data map[string]string, provisionerConfig *Prov
 			if len(config.BlockCleanerCommand) < 1 {
 				return fmt.Errorf("Invalid empty block cleaner command for class %v", class)
 			}
+			if cleaner.IsBuiltin(config.BlockCleanerCommand) {
+				if _, err := cleaner.ParseCommand(config.BlockCleanerCommand); err != nil {
+					return fmt.Errorf("Invalid block cleaner command for class %v: %v", class, err)
+				}
+			}
+		}
+		if config.FilesystemCleanerCommand != nil {
+			if len(config.FilesystemCleanerCommand) < 1 {
+				return fmt.Errorf("Invalid empty filesystem cleaner command for class %v", class)
+			}
+			if cleaner.IsBuiltin(config.FilesystemCleanerCommand) {
+				return fmt.Errorf("Invalid filesystem cleaner command for class %v: built-in cleaners only clean block devices", class)
+			}
+		}
+		switch v1.PersistentVolumeAccessMode(config.AccessMode) {
+		case "", v1.ReadWriteOnce, v1.ReadOnlyMany, v1.ReadWriteMany, v1.ReadWriteOncePod:
+		default:
+			return fmt.Errorf("unsupported access mode %q for class %v", config.AccessMode, class)
+		}
+		for _, pattern := range strings.Split(config.NamePattern, ",") {
+			// The whole pattern is checked even if it does not match.
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid name pattern %q for class %v: %v", pattern, class, err)
+			}
 		}
 		if config.MountDir == "" || config.HostDir == "" {
 			return fmt.Errorf("Storage Class %v is misconfigured, missing HostDir or MountDir parameter", class)
@@ -374,16 +729,174 @@ func ConfigMapDataToVolumeConfig(data map[string]string, provisionerConfig *Prov
 		if volumeMode != v1.PersistentVolumeBlock && volumeMode != v1.PersistentVolumeFilesystem {
 			return fmt.Errorf("unsupported volume mode %s", config.VolumeMode)
 		}
+		if config.ReformatOnRelease != nil {
+			if config.ReformatOnRelease.FsType == "" {
+				return fmt.Errorf("Invalid reformat on release for class %v: missing fsType", class)
+			}
+			if volumeMode != v1.PersistentVolumeFilesystem {
+				return fmt.Errorf("Invalid reformat on release for class %v: volume mode is not Filesystem", class)
+			}
+			if config.FilesystemCleanerCommand != nil {
+				return fmt.Errorf("Invalid reformat on release for class %v: a filesystem cleaner command is configured", class)
+			}
+		}
+
+		switch config.MissingVolumePolicy {
+		case "":
+			config.MissingVolumePolicy = DefaultMissingVolumePolicy
+		case MissingVolumePolicyIgnore, MissingVolumePolicyReport, MissingVolumePolicyDelete:
+		default:
+			return fmt.Errorf("unsupported missing volume policy %q for class %v", config.MissingVolumePolicy, class)
+		}
+
+		switch config.PVNamingScheme {
+		case "":
+			config.PVNamingScheme = DefaultPVNamingScheme
+		case PVNamingSchemeLegacy, PVNamingSchemeDeviceIdentity:
+		default:
+			return fmt.Errorf("unsupported PV naming scheme %q for class %v", config.PVNamingScheme, class)
+		}
+
+		if config.CleanupTimeout.Duration < 0 {
+			return fmt.Errorf("invalid negative cleanup timeout %v for class %v", config.CleanupTimeout.Duration, class)
+		}
+		if config.MaxCleanupAttempts < 0 {
+			return fmt.Errorf("invalid negative max cleanup attempts %d for class %v", config.MaxCleanupAttempts, class)
+		}
+		if config.MaxConcurrentCleanups < 0 {
+			return fmt.Errorf("invalid negative max concurrent cleanups %d for class %v", config.MaxConcurrentCleanups, class)
+		}
+		if err := validateJobTemplate(config.JobTemplate); err != nil {
+			return fmt.Errorf("Invalid job template for class %v: %v", class, err)
+		}
 
 		provisionerConfig.StorageClassConfig[class] = config
-		klog.V(5).Infof("StorageClass %q configured with MountDir %q, HostDir %q, VolumeMode %q, FsType %q, BlockCleanerCommand %q, NamePattern %q",
+		klog.V(5).Infof("StorageClass %q configured with MountDir %q, HostDir %q, VolumeMode %q, FsType %q, BlockCleanerCommand %q, FilesystemCleanerCommand %q, NamePattern %q, MissingVolumePolicy %q, PVNamingScheme %q, CleanupTimeout %v, MaxCleanupAttempts %d",
 			class,
 			config.MountDir,
 			config.HostDir,
 			config.VolumeMode,
 			config.FsType,
 			config.BlockCleanerCommand,
-			config.NamePattern)
+			config.FilesystemCleanerCommand,
+			config.NamePattern,
+			config.MissingVolumePolicy,
+			config.PVNamingScheme,
+			config.CleanupTimeout.Duration,
+			config.MaxCleanupAttempts)
+	}
+	return validateHostDirs(provisionerConfig.StorageClassConfig)
+}
+
+// decodeConfigMapData decodes the configmap data into the provisioner configuration. Unknown,
+// duplicate and miscased fields are rejected, so that a typo does not silently drop a setting.
+func decodeConfigMapData(data map[string]string, provisionerConfig *ProvisionerConfiguration) error {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make(map[string]json.RawMessage, len(data))
+	for _, key := range keys {
+		value, err := yaml.YAMLToJSONStrict([]byte(data[key]))
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", key, err)
+		}
+		fields[key] = value
+	}
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("unable to Marshal configuration: %v", err)
+	}
+	return unmarshalStrict(raw, provisionerConfig)
+}
+
+// unmarshalStrict decodes the JSON data into v, rejecting unknown, duplicate and miscased fields.
+func unmarshalStrict(data []byte, v interface{}) error {
+	strictErrs, err := kjson.UnmarshalStrict(data, v, kjson.DisallowUnknownFields, kjson.DisallowDuplicateFields)
+	if err != nil {
+		return err
+	}
+	if len(strictErrs) > 0 {
+		return utilerrors.NewAggregate(strictErrs)
+	}
+	return nil
+}
+
+// dropInFilePatterns are the patterns of the names of the drop-in files.
+var dropInFilePatterns = []string{"*.yaml", "*.yml"}
+
+// mergeDropInConfigs merges the *.yaml and *.yml drop-in files of dropInDir into the configuration,
+// in the lexical order of their names. A class of a drop-in file replaces the class of the same name
+// of the configmap or of the previous files, and its labels override theirs. A missing
+// directory has no drop-in files.
+func mergeDropInConfigs(dropInDir string, provisionerConfig *ProvisionerConfiguration) error {
+	var files []string
+	for _, pattern := range dropInFilePatterns {
+		matches, err := filepath.Glob(filepath.Join(dropInDir, pattern))
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		raw, err := yaml.YAMLToJSONStrict(contents)
+		if err != nil {
+			return fmt.Errorf("invalid drop-in file %s: %v", file, err)
+		}
+		dropIn := DropInConfiguration{}
+		if err := unmarshalStrict(raw, &dropIn); err != nil {
+			return fmt.Errorf("invalid drop-in file %s: %v", file, err)
+		}
+		for class, config := range dropIn.StorageClassConfig {
+			if provisionerConfig.StorageClassConfig == nil {
+				provisionerConfig.StorageClassConfig = make(map[string]MountConfig)
+			}
+			if _, ok := provisionerConfig.StorageClassConfig[class]; ok {
+				klog.V(4).Infof("Class %s is replaced by drop-in file %s", class, file)
+			}
+			provisionerConfig.StorageClassConfig[class] = config
+		}
+		for key, value := range dropIn.LabelsForPV {
+			if provisionerConfig.LabelsForPV == nil {
+				provisionerConfig.LabelsForPV = make(map[string]string)
+			}
+			provisionerConfig.LabelsForPV[key] = value
+		}
+	}
+	return nil
+}
+
+// validateHostDirs checks that the classes do not discover the same volumes: the host directory of
+// a class can't be within the one of another class, and classes can only share a host directory if
+// they all select their volumes with a name pattern.
+func validateHostDirs(classConfigs map[string]MountConfig) error {
+	classes := make([]string, 0, len(classConfigs))
+	for class := range classConfigs {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for i, class := range classes {
+		config := classConfigs[class]
+		for _, other := range classes[i+1:] {
+			otherConfig := classConfigs[other]
+			hostDir, otherHostDir := filepath.Clean(config.HostDir), filepath.Clean(otherConfig.HostDir)
+			switch {
+			case hostDir == otherHostDir:
+				if config.NamePattern == DefaultNamePattern || otherConfig.NamePattern == DefaultNamePattern {
+					return fmt.Errorf("classes %v and %v share host dir %q, which requires both of them to set a name pattern", class, other, config.HostDir)
+				}
+			case util.IsStrictlyBeneath(hostDir, otherHostDir):
+				return fmt.Errorf("host dir %q of class %v is within host dir %q of class %v", otherConfig.HostDir, other, config.HostDir, class)
+			case util.IsStrictlyBeneath(otherHostDir, hostDir):
+				return fmt.Errorf("host dir %q of class %v is within host dir %q of class %v", config.HostDir, class, otherConfig.HostDir, other)
+			}
+		}
 	}
 	return nil
 }
@@ -402,16 +915,6 @@ func normalizePath(path string) string {
 	return normalizedPath
 }
 
-func insertSpaces(original string) string {
-	spaced := ""
-	for _, line := range strings.Split(original, "\n") {
-		spaced += "   "
-		spaced += line
-		spaced += "\n"
-	}
-	return spaced
-}
-
 // UserConfigFromProvisionerConfig creates a UserConfig from the provided ProvisionerConfiguration struct
 func UserConfigFromProvisionerConfig(node *v1.Node, namespace, jobImage string, config ProvisionerConfiguration) *UserConfig {
 	return &UserConfig{
@@ -420,11 +923,16 @@ func UserConfigFromProvisionerConfig(node *v1.Node, namespace, jobImage string,
 		NodeLabelsForPV:                 config.NodeLabelsForPV,
 		UseAlphaAPI:                     config.UseAlphaAPI,
 		UseJobForCleaning:               config.UseJobForCleaning,
+		UseJobForFilesystemCleaning:     config.UseJobForFilesystemCleaning,
 		MinResyncPeriod:                 config.MinResyncPeriod,
 		UseNodeNameOnly:                 config.UseNodeNameOnly,
 		Namespace:                       namespace,
 		JobContainerImage:               jobImage,
 		JobTolerations:                  config.JobTolerations,
+		JobTemplate:                     config.JobTemplate,
+		FailedCleanupJobTTL:             config.FailedCleanupJobTTL,
+		MaxConcurrentCleanups:           config.MaxConcurrentCleanups,
+		CleanupQueueOrder:               config.CleanupQueueOrder,
 		LabelsForPV:                     config.LabelsForPV,
 		SetPVOwnerRef:                   config.SetPVOwnerRef,
 		RemoveNodeNotReadyTaint:         config.RemoveNodeNotReadyTaint,
@@ -433,8 +941,9 @@ func UserConfigFromProvisionerConfig(node *v1.Node, namespace, jobImage string,
 }
 
 // LoadProvisionerConfigs loads all configuration into a string and unmarshal it into ProvisionerConfiguration struct.
-// The configuration is stored in the configmap which is mounted as a volume.
-func LoadProvisionerConfigs(configPath string, provisionerConfig *ProvisionerConfiguration) error {
+// The configuration is stored in the configmap which is mounted as a volume, and is merged with the
+// node-local drop-in files of dropInDir, if it is not empty.
+func LoadProvisionerConfigs(configPath, dropInDir string, provisionerConfig *ProvisionerConfiguration) error {
 	files, err := ioutil.ReadDir(configPath)
 	if err != nil {
 		return err
@@ -452,11 +961,47 @@ func LoadProvisionerConfigs(configPath string, provisionerConfig *ProvisionerCon
 			}
 		}
 	}
-	return ConfigMapDataToVolumeConfig(data, provisionerConfig)
+	if err := decodeConfigMapData(data, provisionerConfig); err != nil {
+		return err
+	}
+	if dropInDir != "" {
+		if err := mergeDropInConfigs(dropInDir, provisionerConfig); err != nil {
+			return err
+		}
+	}
+	return validateProvisionerConfig(provisionerConfig)
+}
+
+// ConfigLoader loads the provisioner configuration from a configuration source into provisionerConfig.
+type ConfigLoader func(provisionerConfig *ProvisionerConfiguration) error
+
+// ConfigMapLoader returns the ConfigLoader of the configmap mounted in configPath, merged with
+// the drop-in files of dropInDir, if it is not empty.
+func ConfigMapLoader(configPath, dropInDir string) ConfigLoader {
+	return func(provisionerConfig *ProvisionerConfiguration) error {
+		return LoadProvisionerConfigs(configPath, dropInDir, provisionerConfig)
+	}
 }
 
 // SetupClient created client using either in-cluster configuration or if KUBECONFIG environment variable is specified then using that config.
 func SetupClient() *kubernetes.Clientset {
+	clientset, err := kubernetes.NewForConfig(setupConfig())
+	if err != nil {
+		klog.Fatalf("Error creating clientset: %v\n", err)
+	}
+	return clientset
+}
+
+// SetupDynamicClient creates a dynamic client the same way as SetupClient.
+func SetupDynamicClient() dynamic.Interface {
+	client, err := dynamic.NewForConfig(setupConfig())
+	if err != nil {
+		klog.Fatalf("Error creating dynamic client: %v\n", err)
+	}
+	return client
+}
+
+func setupConfig() *rest.Config {
 	var config *rest.Config
 	var err error
 
@@ -475,12 +1020,7 @@ func SetupClient() *kubernetes.Clientset {
 		}
 		klog.Infof("Creating client using in-cluster config")
 	}
-
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		klog.Fatalf("Error creating clientset: %v\n", err)
-	}
-	return clientset
+	return config
 }
 
 // GenerateMountName generates a volumeMount.name for pod spec, based on volume configuration.
@@ -92,6 +92,8 @@ func TestLoadProvisionerConfigs(t *testing.T) {
 	defer func() {
 		os.RemoveAll(tmpConfigPath)
 	}()
+	backoffLimit := int32(2)
+	activeDeadlineSeconds := int64(0)
 	testcases := []struct {
 		data        map[string]string
 		expected    ProvisionerConfiguration
@@ -130,6 +132,8 @@ func TestLoadProvisionerConfigs(t *testing.T) {
 						VolumeMode:          "Filesystem",
 						FsType:              "ext4",
 						NamePattern:         "*",
+						MissingVolumePolicy: "Report",
+						PVNamingScheme:      "Legacy",
 					},
 				},
 				UseAlphaAPI: true,
@@ -227,6 +231,8 @@ func TestLoadProvisionerConfigs(t *testing.T) {
 						VolumeMode:          "Filesystem",
 						FsType:              "ext4",
 						NamePattern:         "nvm*,sdb*",
+						MissingVolumePolicy: "Report",
+						PVNamingScheme:      "Legacy",
 					},
 				},
 				UseAlphaAPI: true,
@@ -256,6 +262,8 @@ func TestLoadProvisionerConfigs(t *testing.T) {
 						BlockCleanerCommand: []string{"/scripts/quick_reset.sh"},
 						VolumeMode:          "Filesystem",
 						NamePattern:         "*",
+						MissingVolumePolicy: "Report",
+						PVNamingScheme:      "Legacy",
 						Selector: []v1.NodeSelectorTerm{
 							{
 								MatchExpressions: []v1.NodeSelectorRequirement{
@@ -276,6 +284,595 @@ func TestLoadProvisionerConfigs(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   missingVolumePolicy: Delete
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:             "/mnt/disks",
+						MountDir:            "/mnt/disks",
+						BlockCleanerCommand: []string{"/scripts/quick_reset.sh"},
+						VolumeMode:          "Filesystem",
+						NamePattern:         "*",
+						MissingVolumePolicy: "Delete",
+						PVNamingScheme:      "Legacy",
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+			},
+			nil,
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   missingVolumePolicy: Forget
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:             "/mnt/disks",
+						MountDir:            "/mnt/disks",
+						MissingVolumePolicy: "Forget",
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+			},
+			fmt.Errorf("unsupported missing volume policy \"Forget\" for class local-storage"),
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   pvNamingScheme: DeviceIdentity
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:             "/mnt/disks",
+						MountDir:            "/mnt/disks",
+						BlockCleanerCommand: []string{"/scripts/quick_reset.sh"},
+						VolumeMode:          "Filesystem",
+						NamePattern:         "*",
+						MissingVolumePolicy: "Report",
+						PVNamingScheme:      "DeviceIdentity",
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+			},
+			nil,
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   pvNamingScheme: Random
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:        "/mnt/disks",
+						MountDir:       "/mnt/disks",
+						PVNamingScheme: "Random",
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+			},
+			fmt.Errorf("unsupported PV naming scheme \"Random\" for class local-storage"),
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   blockCleanerCommand:
+     - "builtin:shred"
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:             "/mnt/disks",
+						MountDir:            "/mnt/disks",
+						BlockCleanerCommand: []string{"builtin:shred"},
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+			},
+			fmt.Errorf("Invalid block cleaner command for class local-storage: unknown built-in cleaner \"builtin:shred\""),
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   cleanupTimeout: 6h
+   maxCleanupAttempts: 3
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:             "/mnt/disks",
+						MountDir:            "/mnt/disks",
+						BlockCleanerCommand: []string{"/scripts/quick_reset.sh"},
+						VolumeMode:          "Filesystem",
+						NamePattern:         "*",
+						MissingVolumePolicy: "Report",
+						PVNamingScheme:      "Legacy",
+						CleanupTimeout:      metav1.Duration{Duration: 6 * time.Hour},
+						MaxCleanupAttempts:  3,
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+			},
+			nil,
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   maxCleanupAttempts: -1
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:            "/mnt/disks",
+						MountDir:           "/mnt/disks",
+						MaxCleanupAttempts: -1,
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+			},
+			fmt.Errorf("invalid negative max cleanup attempts -1 for class local-storage"),
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   jobTemplate:
+     serviceAccountName: fast-disks-cleaner
+`,
+				"jobTemplate": `priorityClassName: system-node-critical
+resources:
+  requests:
+    cpu: 100m
+backoffLimit: 2
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:             "/mnt/disks",
+						MountDir:            "/mnt/disks",
+						BlockCleanerCommand: []string{"/scripts/quick_reset.sh"},
+						VolumeMode:          "Filesystem",
+						NamePattern:         "*",
+						MissingVolumePolicy: "Report",
+						PVNamingScheme:      "Legacy",
+						JobTemplate: &JobTemplate{
+							ServiceAccountName: "fast-disks-cleaner",
+						},
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+				JobTemplate: &JobTemplate{
+					PriorityClassName: "system-node-critical",
+					Resources: &v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					},
+					BackoffLimit: &backoffLimit,
+				},
+			},
+			nil,
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   jobTemplate:
+     activeDeadlineSeconds: 0
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:  "/mnt/disks",
+						MountDir: "/mnt/disks",
+						JobTemplate: &JobTemplate{
+							ActiveDeadlineSeconds: &activeDeadlineSeconds,
+						},
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+				JobTemplate: &JobTemplate{
+					PriorityClassName: "system-node-critical",
+					Resources: &v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					},
+					BackoffLimit: &backoffLimit,
+				},
+			},
+			fmt.Errorf("Invalid job template for class local-storage: invalid non-positive active deadline seconds 0"),
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+`,
+				"failedCleanupJobTTL": "-1h",
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:  "/mnt/disks",
+						MountDir: "/mnt/disks",
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+				JobTemplate: &JobTemplate{
+					PriorityClassName: "system-node-critical",
+					Resources: &v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					},
+					BackoffLimit: &backoffLimit,
+				},
+				FailedCleanupJobTTL: metav1.Duration{Duration: -time.Hour},
+			},
+			fmt.Errorf("invalid negative failed cleanup job TTL -1h0m0s"),
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   filesystemCleanerCommand:
+   - /scripts/xfs_clean.sh
+   - --reset-quota
+`,
+				"failedCleanupJobTTL": "24h",
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:                  "/mnt/disks",
+						MountDir:                 "/mnt/disks",
+						BlockCleanerCommand:      []string{"/scripts/quick_reset.sh"},
+						FilesystemCleanerCommand: []string{"/scripts/xfs_clean.sh", "--reset-quota"},
+						VolumeMode:               "Filesystem",
+						NamePattern:              "*",
+						MissingVolumePolicy:      "Report",
+						PVNamingScheme:           "Legacy",
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+				JobTemplate: &JobTemplate{
+					PriorityClassName: "system-node-critical",
+					Resources: &v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					},
+					BackoffLimit: &backoffLimit,
+				},
+				FailedCleanupJobTTL: metav1.Duration{Duration: 24 * time.Hour},
+			},
+			nil,
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   filesystemCleanerCommand: []
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:                  "/mnt/disks",
+						MountDir:                 "/mnt/disks",
+						FilesystemCleanerCommand: []string{},
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+				JobTemplate: &JobTemplate{
+					PriorityClassName: "system-node-critical",
+					Resources: &v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					},
+					BackoffLimit: &backoffLimit,
+				},
+				FailedCleanupJobTTL: metav1.Duration{Duration: 24 * time.Hour},
+			},
+			fmt.Errorf("Invalid empty filesystem cleaner command for class local-storage"),
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   filesystemCleanerCommand:
+   - builtin:zeroout
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:                  "/mnt/disks",
+						MountDir:                 "/mnt/disks",
+						FilesystemCleanerCommand: []string{"builtin:zeroout"},
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+				JobTemplate: &JobTemplate{
+					PriorityClassName: "system-node-critical",
+					Resources: &v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					},
+					BackoffLimit: &backoffLimit,
+				},
+				FailedCleanupJobTTL: metav1.Duration{Duration: 24 * time.Hour},
+			},
+			fmt.Errorf("Invalid filesystem cleaner command for class local-storage: built-in cleaners only clean block devices"),
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   reformatOnRelease:
+     fsType: xfs
+     mkfsOptions:
+     - -f
+     mountOptions:
+     - noatime
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:             "/mnt/disks",
+						MountDir:            "/mnt/disks",
+						BlockCleanerCommand: []string{"/scripts/quick_reset.sh"},
+						ReformatOnRelease: &ReformatConfig{
+							FsType:       "xfs",
+							MkfsOptions:  []string{"-f"},
+							MountOptions: []string{"noatime"},
+						},
+						VolumeMode:          "Filesystem",
+						NamePattern:         "*",
+						MissingVolumePolicy: "Report",
+						PVNamingScheme:      "Legacy",
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+				JobTemplate: &JobTemplate{
+					PriorityClassName: "system-node-critical",
+					Resources: &v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					},
+					BackoffLimit: &backoffLimit,
+				},
+				FailedCleanupJobTTL: metav1.Duration{Duration: 24 * time.Hour},
+			},
+			nil,
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   reformatOnRelease:
+     mkfsOptions:
+     - -f
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:  "/mnt/disks",
+						MountDir: "/mnt/disks",
+						ReformatOnRelease: &ReformatConfig{
+							MkfsOptions: []string{"-f"},
+						},
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+				JobTemplate: &JobTemplate{
+					PriorityClassName: "system-node-critical",
+					Resources: &v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					},
+					BackoffLimit: &backoffLimit,
+				},
+				FailedCleanupJobTTL: metav1.Duration{Duration: 24 * time.Hour},
+			},
+			fmt.Errorf("Invalid reformat on release for class local-storage: missing fsType"),
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   volumeMode: Block
+   reformatOnRelease:
+     fsType: ext4
+`,
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:    "/mnt/disks",
+						MountDir:   "/mnt/disks",
+						VolumeMode: "Block",
+						ReformatOnRelease: &ReformatConfig{
+							FsType: "ext4",
+						},
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+				JobTemplate: &JobTemplate{
+					PriorityClassName: "system-node-critical",
+					Resources: &v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					},
+					BackoffLimit: &backoffLimit,
+				},
+				FailedCleanupJobTTL: metav1.Duration{Duration: 24 * time.Hour},
+			},
+			fmt.Errorf("Invalid reformat on release for class local-storage: volume mode is not Filesystem"),
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   maxConcurrentCleanups: 2
+`,
+				"maxConcurrentCleanups": "4",
+				"cleanupQueueOrder":     "SmallestFirst",
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:               "/mnt/disks",
+						MountDir:              "/mnt/disks",
+						BlockCleanerCommand:   []string{"/scripts/quick_reset.sh"},
+						VolumeMode:            "Filesystem",
+						NamePattern:           "*",
+						MissingVolumePolicy:   "Report",
+						PVNamingScheme:        "Legacy",
+						MaxConcurrentCleanups: 2,
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+				JobTemplate: &JobTemplate{
+					PriorityClassName: "system-node-critical",
+					Resources: &v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					},
+					BackoffLimit: &backoffLimit,
+				},
+				FailedCleanupJobTTL:   metav1.Duration{Duration: 24 * time.Hour},
+				MaxConcurrentCleanups: 4,
+				CleanupQueueOrder:     "SmallestFirst",
+			},
+			nil,
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+`,
+				"cleanupQueueOrder": "LargestFirst",
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:  "/mnt/disks",
+						MountDir: "/mnt/disks",
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+				JobTemplate: &JobTemplate{
+					PriorityClassName: "system-node-critical",
+					Resources: &v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					},
+					BackoffLimit: &backoffLimit,
+				},
+				FailedCleanupJobTTL:   metav1.Duration{Duration: 24 * time.Hour},
+				MaxConcurrentCleanups: 4,
+				CleanupQueueOrder:     "LargestFirst",
+			},
+			fmt.Errorf("unsupported cleanup queue order \"LargestFirst\""),
+		},
+		{
+			map[string]string{"storageClassMap": `local-storage:
+   hostDir: /mnt/disks
+   mountDir: /mnt/disks
+   maxConcurrentCleanups: -1
+`,
+				"cleanupQueueOrder": "OldestFirst",
+			},
+			ProvisionerConfiguration{
+				StorageClassConfig: map[string]MountConfig{
+					"local-storage": {
+						HostDir:               "/mnt/disks",
+						MountDir:              "/mnt/disks",
+						MaxConcurrentCleanups: -1,
+					},
+				},
+				UseAlphaAPI: true,
+				MinResyncPeriod: metav1.Duration{
+					Duration: time.Hour + time.Minute*30,
+				},
+				JobTemplate: &JobTemplate{
+					PriorityClassName: "system-node-critical",
+					Resources: &v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					},
+					BackoffLimit: &backoffLimit,
+				},
+				FailedCleanupJobTTL:   metav1.Duration{Duration: 24 * time.Hour},
+				MaxConcurrentCleanups: 4,
+				CleanupQueueOrder:     "OldestFirst",
+			},
+			fmt.Errorf("invalid negative max concurrent cleanups -1 for class local-storage"),
+		},
 	}
 	for _, v := range testcases {
 		for name, value := range v.data {
@@ -285,7 +882,7 @@ func TestLoadProvisionerConfigs(t *testing.T) {
 			}
 		}
 		provisionerConfig := ProvisionerConfiguration{}
-		err = LoadProvisionerConfigs(tmpConfigPath, &provisionerConfig)
+		err = LoadProvisionerConfigs(tmpConfigPath, "", &provisionerConfig)
 		if !reflect.DeepEqual(err, v.expectedErr) {
 			t.Errorf("LoadProvisionerConfigs error: expected %v, got %v", v.expectedErr, err)
 		}
@@ -295,6 +892,251 @@ func TestLoadProvisionerConfigs(t *testing.T) {
 	}
 }
 
+func TestConfigMapDataToVolumeConfig_Validation(t *testing.T) {
+	testcases := []struct {
+		name        string
+		data        map[string]string
+		expectedErr string
+	}{
+		{
+			name: "valid classes",
+			data: map[string]string{"storageClassMap": `fast:
+  hostDir: /mnt/disks
+  mountDir: /mnt/disks
+  namePattern: "nvme*"
+  accessMode: ReadWriteOncePod
+slow:
+  hostDir: /mnt/disks/
+  mountDir: /mnt/disks
+  namePattern: "sd*,hd?"
+other:
+  hostDir: /mnt/disks2
+  mountDir: /mnt/disks2
+`},
+		},
+		{
+			name:        "unknown top-level key",
+			data:        map[string]string{"useJobForClening": "true"},
+			expectedErr: `unknown field "useJobForClening"`,
+		},
+		{
+			name: "unknown class field",
+			data: map[string]string{"storageClassMap": `local-storage:
+  hostDir: /mnt/disks
+  mountDir: /mnt/disks
+  blockCleanerComand: ["/scripts/shred.sh"]
+`},
+			expectedErr: `unknown field "storageClassMap.local-storage.blockCleanerComand"`,
+		},
+		{
+			name: "miscased class field",
+			data: map[string]string{"storageClassMap": `local-storage:
+  hostDir: /mnt/disks
+  mountDir: /mnt/disks
+  volumemode: Block
+`},
+			expectedErr: `unknown field "storageClassMap.local-storage.volumemode"`,
+		},
+		{
+			name: "duplicate class field",
+			data: map[string]string{"storageClassMap": `local-storage:
+  hostDir: /mnt/disks
+  mountDir: /mnt/disks
+  hostDir: /mnt/other
+`},
+			expectedErr: `invalid storageClassMap: yaml: unmarshal errors:
+  line 4: key "hostDir" already set in map`,
+		},
+		{
+			name:        "wrong type",
+			data:        map[string]string{"maxConcurrentCleanups": "many"},
+			expectedErr: "json: cannot unmarshal string into Go struct field ProvisionerConfiguration.maxConcurrentCleanups of type int",
+		},
+		{
+			name: "unsupported access mode",
+			data: map[string]string{"storageClassMap": `local-storage:
+  hostDir: /mnt/disks
+  mountDir: /mnt/disks
+  accessMode: ReadWriteSometimes
+`},
+			expectedErr: `unsupported access mode "ReadWriteSometimes" for class local-storage`,
+		},
+		{
+			name: "bad name pattern",
+			data: map[string]string{"storageClassMap": `local-storage:
+  hostDir: /mnt/disks
+  mountDir: /mnt/disks
+  namePattern: "nvme*,sd[a-"
+`},
+			expectedErr: `invalid name pattern "sd[a-" for class local-storage: syntax error in pattern`,
+		},
+		{
+			name: "nested host dirs",
+			data: map[string]string{"storageClassMap": `outer:
+  hostDir: /mnt/disks
+  mountDir: /mnt/disks
+inner:
+  hostDir: /mnt/disks/ssd
+  mountDir: /mnt/ssd
+`},
+			expectedErr: `host dir "/mnt/disks/ssd" of class inner is within host dir "/mnt/disks" of class outer`,
+		},
+		{
+			name: "shared host dir without name pattern",
+			data: map[string]string{"storageClassMap": `fast:
+  hostDir: /mnt/disks
+  mountDir: /mnt/disks
+  namePattern: "nvme*"
+slow:
+  hostDir: /mnt/disks
+  mountDir: /mnt/disks
+`},
+			expectedErr: `classes fast and slow share host dir "/mnt/disks", which requires both of them to set a name pattern`,
+		},
+	}
+	for _, test := range testcases {
+		provisionerConfig := ProvisionerConfiguration{StorageClassConfig: map[string]MountConfig{}}
+		err := ConfigMapDataToVolumeConfig(test.data, &provisionerConfig)
+		if test.expectedErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.expectedErr {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.expectedErr, err)
+		}
+	}
+}
+
+func TestLoadProvisionerConfigs_DropIn(t *testing.T) {
+	configPath := t.TempDir()
+	writeFiles := func(dir string, files map[string]string) {
+		for name, contents := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	writeFiles(configPath, map[string]string{
+		"storageClassMap": `local-storage:
+  hostDir: /mnt/disks
+  mountDir: /mnt/disks
+nvme:
+  hostDir: /mnt/nvme
+  mountDir: /mnt/nvme
+`,
+		"labelsForPV": `pool: default
+tier: standard
+`,
+	})
+
+	testcases := []struct {
+		name          string
+		files         map[string]string
+		expectedNVMe  MountConfig
+		expectedLabel map[string]string
+		expectedErr   string
+	}{
+		{
+			name: "missing drop-in directory",
+			expectedNVMe: MountConfig{
+				HostDir:             "/mnt/nvme",
+				MountDir:            "/mnt/nvme",
+				BlockCleanerCommand: []string{DefaultBlockCleanerCommand},
+				VolumeMode:          DefaultVolumeMode,
+				NamePattern:         DefaultNamePattern,
+				MissingVolumePolicy: DefaultMissingVolumePolicy,
+				PVNamingScheme:      DefaultPVNamingScheme,
+			},
+			expectedLabel: map[string]string{"pool": "default", "tier": "standard"},
+		},
+		{
+			name: "later files take precedence",
+			files: map[string]string{
+				"10-nvme.yaml": `storageClassMap:
+  nvme:
+    hostDir: /mnt/nvme-array
+    mountDir: /mnt/nvme-array
+labelsForPV:
+  tier: fast
+`,
+				"20-nvme.yml": `storageClassMap:
+  nvme:
+    hostDir: /mnt/nvme-array
+    mountDir: /mnt/nvme-array
+    volumeMode: Block
+`,
+				// Only the *.yaml and *.yml files are merged.
+				"30-nvme.yaml.bak": "storageClassMap: {}",
+			},
+			expectedNVMe: MountConfig{
+				HostDir:             "/mnt/nvme-array",
+				MountDir:            "/mnt/nvme-array",
+				BlockCleanerCommand: []string{DefaultBlockCleanerCommand},
+				VolumeMode:          "Block",
+				NamePattern:         DefaultNamePattern,
+				MissingVolumePolicy: DefaultMissingVolumePolicy,
+				PVNamingScheme:      DefaultPVNamingScheme,
+			},
+			expectedLabel: map[string]string{"pool": "default", "tier": "fast"},
+		},
+		{
+			name: "unsupported key",
+			files: map[string]string{
+				"10-nvme.yaml": `useJobForCleaning: true
+`,
+			},
+			expectedErr: `invalid drop-in file %s: unknown field "useJobForCleaning"`,
+		},
+		{
+			name: "validated with the configmap",
+			files: map[string]string{
+				"10-nvme.yaml": `storageClassMap:
+  nvme:
+    hostDir: /mnt/disks/nvme
+    mountDir: /mnt/nvme
+`,
+			},
+			expectedErr: `host dir "/mnt/disks/nvme" of class nvme is within host dir "/mnt/disks" of class local-storage`,
+		},
+	}
+	for _, test := range testcases {
+		dropInDir := filepath.Join(t.TempDir(), "conf.d")
+		if test.files != nil {
+			if err := os.Mkdir(dropInDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			writeFiles(dropInDir, test.files)
+		}
+		provisionerConfig := ProvisionerConfiguration{StorageClassConfig: map[string]MountConfig{}}
+		err := LoadProvisionerConfigs(configPath, dropInDir, &provisionerConfig)
+		if test.expectedErr != "" {
+			expectedErr := test.expectedErr
+			if strings.Contains(expectedErr, "%s") {
+				expectedErr = fmt.Sprintf(expectedErr, filepath.Join(dropInDir, "10-nvme.yaml"))
+			}
+			if err == nil || err.Error() != expectedErr {
+				t.Errorf("%s: expected error %q, got %v", test.name, expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(provisionerConfig.StorageClassConfig["nvme"], test.expectedNVMe) {
+			t.Errorf("%s: expected class %+v, got %+v", test.name, test.expectedNVMe, provisionerConfig.StorageClassConfig["nvme"])
+		}
+		if !reflect.DeepEqual(provisionerConfig.LabelsForPV, test.expectedLabel) {
+			t.Errorf("%s: expected labels %v, got %v", test.name, test.expectedLabel, provisionerConfig.LabelsForPV)
+		}
+		if _, ok := provisionerConfig.StorageClassConfig["local-storage"]; !ok {
+			t.Errorf("%s: expected the class of the configmap to be kept", test.name)
+		}
+	}
+}
+
 func TestVolumeConfigToConfigMapData(t *testing.T) {
 	testcases := []struct {
 		provisionerConfig *ProvisionerConfiguration
@@ -689,3 +1531,111 @@ func removeAllNodeNames(pv *v1.PersistentVolume) *v1.PersistentVolume {
 	pv.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions[0].Values = []string{}
 	return pv
 }
+
+func TestJobTemplateMerge(t *testing.T) {
+	backoffLimit := int32(3)
+	base := &JobTemplate{
+		Labels:             map[string]string{"team": "storage", "tier": "base"},
+		PriorityClassName:  "system-node-critical",
+		ServiceAccountName: "cleaner",
+		BackoffLimit:       &backoffLimit,
+	}
+	override := &JobTemplate{
+		Labels:             map[string]string{"tier": "fast"},
+		ServiceAccountName: "fast-disks-cleaner",
+	}
+	expected := &JobTemplate{
+		Labels:             map[string]string{"team": "storage", "tier": "fast"},
+		PriorityClassName:  "system-node-critical",
+		ServiceAccountName: "fast-disks-cleaner",
+		BackoffLimit:       &backoffLimit,
+	}
+	if merged := base.Merge(override); !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected merged template %+v, got %+v", expected, merged)
+	}
+	if base.Labels["tier"] != "base" {
+		t.Errorf("Merge modified the base template labels: %v", base.Labels)
+	}
+
+	var none *JobTemplate
+	if merged := none.Merge(override); merged != override {
+		t.Errorf("Expected the override template, got %+v", merged)
+	}
+	if merged := base.Merge(nil); merged != base {
+		t.Errorf("Expected the base template, got %+v", merged)
+	}
+}
+
+func TestUseJobForCleaningVolume(t *testing.T) {
+	enabled, disabled := true, false
+	testcases := []struct {
+		name             string
+		userConfig       UserConfig
+		mode             v1.PersistentVolumeMode
+		classUseJob      *bool
+		reformat         *ReformatConfig
+		expected         bool
+		expectedAnyClass bool
+	}{
+		{
+			name:       "block, jobs disabled",
+			userConfig: UserConfig{},
+			mode:       v1.PersistentVolumeBlock,
+		},
+		{
+			name:             "block, jobs enabled for block",
+			userConfig:       UserConfig{UseJobForCleaning: true},
+			mode:             v1.PersistentVolumeBlock,
+			expected:         true,
+			expectedAnyClass: true,
+		},
+		{
+			name:             "filesystem, jobs enabled for block",
+			userConfig:       UserConfig{UseJobForCleaning: true},
+			mode:             v1.PersistentVolumeFilesystem,
+			expectedAnyClass: true,
+		},
+		{
+			name:             "filesystem, jobs enabled for filesystem",
+			userConfig:       UserConfig{UseJobForFilesystemCleaning: true},
+			mode:             v1.PersistentVolumeFilesystem,
+			expected:         true,
+			expectedAnyClass: true,
+		},
+		{
+			name:             "filesystem, jobs enabled for class",
+			userConfig:       UserConfig{},
+			mode:             v1.PersistentVolumeFilesystem,
+			classUseJob:      &enabled,
+			expected:         true,
+			expectedAnyClass: true,
+		},
+		{
+			name:             "block, jobs disabled for class",
+			userConfig:       UserConfig{UseJobForCleaning: true},
+			mode:             v1.PersistentVolumeBlock,
+			classUseJob:      &disabled,
+			expectedAnyClass: true,
+		},
+		{
+			name:             "filesystem, reformatted on release",
+			userConfig:       UserConfig{UseJobForFilesystemCleaning: true},
+			mode:             v1.PersistentVolumeFilesystem,
+			classUseJob:      &enabled,
+			reformat:         &ReformatConfig{FsType: "xfs"},
+			expectedAnyClass: true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := MountConfig{UseJobForCleaning: tc.classUseJob, ReformatOnRelease: tc.reformat}
+			tc.userConfig.DiscoveryMap = map[string]MountConfig{"local-storage": config}
+			if got := tc.userConfig.UseJobForCleaningVolume(tc.mode, config); got != tc.expected {
+				t.Errorf("Expected UseJobForCleaningVolume %v, got %v", tc.expected, got)
+			}
+			if got := tc.userConfig.UsesJobsForCleaning(); got != tc.expectedAnyClass {
+				t.Errorf("Expected UsesJobsForCleaning %v, got %v", tc.expectedAnyClass, got)
+			}
+		})
+	}
+}
@@ -17,9 +17,11 @@ limitations under the License.
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 
 	"k8s.io/klog/v2"
@@ -43,18 +45,37 @@ import (
 	"k8s.io/utils/mount"
 )
 
+// DiscoveryOptions controls how local volumes are discovered.
+type DiscoveryOptions struct {
+	// Period is the period of the sync loop deleting released PVs and discovering new volumes.
+	Period time.Duration
+	// Watch enables watching the discovery directories and the mount table, so that new
+	// volumes are discovered as soon as they show up instead of at the next full discovery.
+	Watch bool
+	// FullPeriod is the period of full discoveries when Watch is enabled. They act
+	// as a safety net for the changes missed by the watch.
+	FullPeriod time.Duration
+}
+
 // signal represents an indication to from client to terminate a service and waits for a callback
 // indicating that the service has successfully stopped.
 type signal struct {
 	closing chan chan struct{}
+	// updates receives the configurations to apply without restarting the service
+	updates chan *common.UserConfig
 }
 
 func newSignal() *signal {
 	return &signal{
 		closing: make(chan chan struct{}),
+		updates: make(chan *common.UserConfig),
 	}
 }
 
+func (s *signal) update(config *common.UserConfig) {
+	s.updates <- config
+}
+
 func (s *signal) stop() {
 	stopped := make(chan struct{})
 	s.closing <- stopped
@@ -65,30 +86,140 @@ func (s *signal) close() {
 	close(s.closing)
 }
 
+// discovererReadyzCheck reports the readiness of the discoverer of the running sync loop. The
+// readiness endpoint can only be installed once, while a new discoverer is created each time the
+// sync loop is restarted.
+type discovererReadyzCheck struct {
+	discoverer healthz.HealthChecker
+	readySync  sync.RWMutex
+}
+
+// Check returns an error if the discoverer of the running sync loop is not ready
+func (c *discovererReadyzCheck) Check(r *http.Request) error {
+	c.readySync.RLock()
+	defer c.readySync.RUnlock()
+	if c.discoverer == nil {
+		return errors.New("discovererNotReady")
+	}
+	return c.discoverer.Check(r)
+}
+
+// Name returns the name of this ReadyzCheck
+func (c *discovererReadyzCheck) Name() string {
+	return "DiscovererReadyzCheck"
+}
+
+func (c *discovererReadyzCheck) setDiscoverer(discoverer healthz.HealthChecker) {
+	c.readySync.Lock()
+	defer c.readySync.Unlock()
+	c.discoverer = discoverer
+}
+
 // RunLocalController facilitates and manages the sync loop.
 // It launches the main sync loop and if there is an updated configuration from the ConfigWatcher,
-// it will inform the main sync loop to terminate and then will launch a new sync loop with the
-// updated configuration.
-func RunLocalController(configUpdate <-chan common.ProvisionerConfiguration, client *kubernetes.Clientset, ptable deleter.ProcTable, discoveryPeriod time.Duration, node *v1.Node, namespace, jobImage string, config common.ProvisionerConfiguration) {
+// it will send it to the main sync loop to apply it in place or, if it changes settings which need
+// a restart, it will inform the main sync loop to terminate and then will launch a new sync loop
+// with the updated configuration. The readiness endpoint reports the readiness of the discoverer
+// and the given readyzChecks.
+func RunLocalController(configUpdate <-chan common.ProvisionerConfiguration, client *kubernetes.Clientset, ptable deleter.ProcTable, dirtyVolumes *deleter.DirtyVolumes, discoveryOpts DiscoveryOptions, node *v1.Node, namespace, jobImage string, config common.ProvisionerConfiguration, readyzChecks ...healthz.HealthChecker) {
 	s := newSignal()
 	defer s.close()
 
-	startController := func(config common.ProvisionerConfiguration) {
-		StartLocalController(s, client, ptable, discoveryPeriod, common.UserConfigFromProvisionerConfig(node, namespace, jobImage, config))
+	readyz := &discovererReadyzCheck{}
+	healthz.InstallPathHandler(http.DefaultServeMux, "/ready", append([]healthz.HealthChecker{readyz}, readyzChecks...)...)
+	startController := func(config *common.UserConfig) {
+		StartLocalController(s, client, ptable, dirtyVolumes, discoveryOpts, readyz, config)
 	}
-	go startController(config)
+	applied := common.UserConfigFromProvisionerConfig(node, namespace, jobImage, config)
+	go startController(applied)
 
 	for {
 		select {
 		case newConfig := <-configUpdate:
-			s.stop()
-			go startController(newConfig)
+			userConfig := common.UserConfigFromProvisionerConfig(node, namespace, jobImage, newConfig)
+			if needsRestart(applied, userConfig) {
+				klog.Infof("Restarting sync loop to apply updated configuration")
+				s.stop()
+				go startController(userConfig)
+			} else {
+				klog.Infof("Applying updated configuration without restarting sync loop")
+				s.update(userConfig)
+			}
+			applied = userConfig
+		}
+	}
+}
+
+// needsRestart returns true if the sync loop must be restarted to apply the new configuration,
+// because it changes the objects created when the sync loop starts, or settings read by the job
+// controller. The other settings are applied in place by updateConfig.
+func needsRestart(current, updated *common.UserConfig) bool {
+	return current.UseJobForCleaning != updated.UseJobForCleaning ||
+		current.UseJobForFilesystemCleaning != updated.UseJobForFilesystemCleaning ||
+		// The job controller is only created if some volumes are cleaned up by jobs.
+		current.UsesJobsForCleaning() != updated.UsesJobsForCleaning() ||
+		current.FailedCleanupJobTTL != updated.FailedCleanupJobTTL ||
+		current.MinResyncPeriod != updated.MinResyncPeriod ||
+		current.UseNodeNameOnly != updated.UseNodeNameOnly ||
+		current.RemoveNodeNotReadyTaint != updated.RemoveNodeNotReadyTaint ||
+		current.ProvisionerNotReadyNodeTaintKey != updated.ProvisionerNotReadyNodeTaintKey
+}
+
+// updateConfig applies in place the settings of the new configuration which don't need the sync
+// loop to be restarted. The added classes are discovered and cleaned up from now on, and the
+// removed ones no longer are. The labels only apply to the PVs created from now on.
+func updateConfig(runtimeConfig *common.RuntimeConfig, discoverer *discovery.Discoverer, config *common.UserConfig) {
+	for class := range config.DiscoveryMap {
+		if _, ok := runtimeConfig.DiscoveryMap[class]; !ok {
+			klog.Infof("Starting discovery of storage class %s", class)
+		}
+	}
+	for class := range runtimeConfig.DiscoveryMap {
+		if _, ok := config.DiscoveryMap[class]; !ok {
+			klog.Infof("Stopping discovery of storage class %s", class)
+		}
+	}
+	runtimeConfig.DiscoveryMap = config.DiscoveryMap
+	runtimeConfig.NodeLabelsForPV = config.NodeLabelsForPV
+	runtimeConfig.LabelsForPV = config.LabelsForPV
+	runtimeConfig.UseAlphaAPI = config.UseAlphaAPI
+	runtimeConfig.SetPVOwnerRef = config.SetPVOwnerRef
+	runtimeConfig.JobTolerations = config.JobTolerations
+	runtimeConfig.JobTemplate = config.JobTemplate
+	runtimeConfig.MaxConcurrentCleanups = config.MaxConcurrentCleanups
+	runtimeConfig.CleanupQueueOrder = config.CleanupQueueOrder
+	discoverer.UpdateLabels()
+}
+
+// sameDiscoveryDirs returns true if the classes of both discovery maps are discovered in the same
+// directories.
+func sameDiscoveryDirs(a, b map[string]common.MountConfig) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for class, config := range a {
+		if other, ok := b[class]; !ok || other.MountDir != config.MountDir {
+			return false
 		}
 	}
+	return true
+}
+
+// startVolumeWatcher starts watching the discovery directories of the classes until stopCh is
+// closed. It returns nil if the watch can't be set up, so that volumes are only discovered
+// periodically.
+func startVolumeWatcher(runtimeConfig *common.RuntimeConfig, stopCh <-chan struct{}) *discovery.VolumeWatcher {
+	volumeWatcher, err := discovery.NewVolumeWatcher(runtimeConfig.DiscoveryMap, runtimeConfig.Mounter)
+	if err != nil {
+		klog.Errorf("Error initializing volume watcher, falling back to periodic discovery: %v", err)
+		return nil
+	}
+	go volumeWatcher.Run(stopCh)
+	return volumeWatcher
 }
 
 // StartLocalController starts the sync loop for the local PV discovery and deleter
-func StartLocalController(signal *signal, client *kubernetes.Clientset, ptable deleter.ProcTable, discoveryPeriod time.Duration, config *common.UserConfig) {
+func StartLocalController(signal *signal, client *kubernetes.Clientset, ptable deleter.ProcTable, dirtyVolumes *deleter.DirtyVolumes, discoveryOpts DiscoveryOptions, readyz *discovererReadyzCheck, config *common.UserConfig) {
 	klog.Info("Initializing volume cache\n")
 
 	informerStopChan := make(chan struct{})
@@ -131,7 +262,7 @@ func StartLocalController(signal *signal, client *kubernetes.Clientset, ptable d
 	populator.NewPopulator(runtimeConfig)
 
 	var jobController deleter.JobController
-	if runtimeConfig.UseJobForCleaning {
+	if runtimeConfig.UsesJobsForCleaning() {
 		labels := map[string]string{common.NodeNameLabel: config.Node.Name}
 		jobController, err = deleter.NewJobController(labels, runtimeConfig)
 		if err != nil {
@@ -139,15 +270,15 @@ func StartLocalController(signal *signal, client *kubernetes.Clientset, ptable d
 		}
 		klog.Infof("Enabling Jobs based cleaning.")
 	}
-	cleanupTracker := &deleter.CleanupStatusTracker{ProcTable: ptable, JobController: jobController}
+	cleanupTracker := &deleter.CleanupStatusTracker{ProcTable: ptable, JobController: jobController, DirtyVolumes: dirtyVolumes}
 
-	discoverer, err := discovery.NewDiscoverer(runtimeConfig, cleanupTracker)
+	deleter := deleter.NewDeleter(runtimeConfig, cleanupTracker)
+
+	discoverer, err := discovery.NewDiscoverer(runtimeConfig, cleanupTracker, deleter)
 	if err != nil {
 		klog.Fatalf("Error initializing discoverer: %v", err)
 	}
-	healthz.InstallPathHandler(http.DefaultServeMux, "/ready", discoverer.Readyz)
-
-	deleter := deleter.NewDeleter(runtimeConfig, cleanupTracker)
+	readyz.setDiscoverer(discoverer.Readyz)
 
 	// Start informers after all event listeners are registered.
 	runtimeConfig.InformerFactory.Start(informerStopChan)
@@ -165,6 +296,16 @@ func StartLocalController(signal *signal, client *kubernetes.Clientset, ptable d
 
 	nodeTaintRemover := nodetaint.NewRemover(runtimeConfig)
 
+	var volumeWatcher *discovery.VolumeWatcher
+	watcherStopChan := make(chan struct{})
+	if discoveryOpts.Watch {
+		volumeWatcher = startVolumeWatcher(runtimeConfig, watcherStopChan)
+		if volumeWatcher != nil {
+			klog.Infof("Enabling watch based discovery.")
+		}
+	}
+
+	var lastFullDiscovery time.Time
 	for {
 		select {
 		case stopped := <-signal.closing:
@@ -172,16 +313,49 @@ func StartLocalController(signal *signal, client *kubernetes.Clientset, ptable d
 			if jobController != nil {
 				close(jobControllerStopChan)
 			}
+			close(watcherStopChan)
 			stopped <- struct{}{}
 			klog.Info("Controller stopped\n")
 			return
+		case newConfig := <-signal.updates:
+			dirsChanged := !sameDiscoveryDirs(runtimeConfig.DiscoveryMap, newConfig.DiscoveryMap)
+			updateConfig(runtimeConfig, discoverer, newConfig)
+			if volumeWatcher != nil && dirsChanged {
+				// Watch the directories of the new classes, and stop watching the removed ones.
+				close(watcherStopChan)
+				watcherStopChan = make(chan struct{})
+				volumeWatcher = startVolumeWatcher(runtimeConfig, watcherStopChan)
+			}
+			// Discover the volumes of the new classes right away.
+			lastFullDiscovery = time.Time{}
+			klog.Info("Controller updated\n")
 		default:
 			deleter.DeletePVs()
-			discoverer.DiscoverLocalVolumes()
+			if volumeWatcher != nil && volumeWatcher.NeedsFullDiscovery() {
+				// Changes have been missed, don't wait for the next scheduled full discovery.
+				lastFullDiscovery = time.Time{}
+			}
+			if volumeWatcher == nil || time.Since(lastFullDiscovery) >= discoveryOpts.FullPeriod {
+				if volumeWatcher != nil {
+					// The full discovery covers the pending changes.
+					volumeWatcher.Drain()
+				}
+				discoverer.DiscoverLocalVolumes()
+				lastFullDiscovery = time.Now()
+			} else if entries := volumeWatcher.Drain(); len(entries) > 0 {
+				discoverer.DiscoverVolumes(entries, volumeWatcher.MountPoints())
+			}
 			if !nodeTaintRemover.ShouldRemoveTaint() && discoverer.Readyz.Check(nil) == nil {
 				nodeTaintRemover.RemoveTaintWithBackoff()
 			}
-			time.Sleep(discoveryPeriod)
+			if volumeWatcher == nil {
+				time.Sleep(discoveryOpts.Period)
+			} else {
+				select {
+				case <-volumeWatcher.Changed():
+				case <-time.After(discoveryOpts.Period):
+				}
+			}
 		}
 	}
 }
@@ -16,7 +16,17 @@ limitations under the License.
 
 package controller
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/discovery"
+)
 
 func TestSignalStop(t *testing.T) {
 	s := newSignal()
@@ -42,3 +52,153 @@ func TestSignalStop(t *testing.T) {
 		t.Error("Expected service to be successfully stopped")
 	}
 }
+
+func TestSignalUpdate(t *testing.T) {
+	s := newSignal()
+	defer s.close()
+
+	updated := make(chan *common.UserConfig)
+	service := func(signal *signal) {
+		select {
+		case config := <-signal.updates:
+			updated <- config
+		}
+	}
+
+	go service(s)
+	config := &common.UserConfig{MaxConcurrentCleanups: 2}
+	s.update(config)
+
+	if <-updated != config {
+		t.Error("Expected service to receive the updated configuration")
+	}
+}
+
+func TestNeedsRestart(t *testing.T) {
+	useJob := true
+	base := func() *common.UserConfig {
+		return &common.UserConfig{
+			DiscoveryMap: map[string]common.MountConfig{
+				"local-storage": {HostDir: "/mnt/disks", MountDir: "/mnt/disks"},
+			},
+			MinResyncPeriod: metav1.Duration{Duration: 5 * time.Minute},
+		}
+	}
+	tests := []struct {
+		name     string
+		update   func(config *common.UserConfig)
+		expected bool
+	}{
+		{
+			name:     "no change",
+			update:   func(config *common.UserConfig) {},
+			expected: false,
+		},
+		{
+			name: "class added",
+			update: func(config *common.UserConfig) {
+				config.DiscoveryMap["fast-disks"] = common.MountConfig{HostDir: "/mnt/fast-disks", MountDir: "/mnt/fast-disks"}
+			},
+			expected: false,
+		},
+		{
+			name: "class removed",
+			update: func(config *common.UserConfig) {
+				delete(config.DiscoveryMap, "local-storage")
+			},
+			expected: false,
+		},
+		{
+			name: "labels changed",
+			update: func(config *common.UserConfig) {
+				config.LabelsForPV = map[string]string{"tier": "fast"}
+				config.NodeLabelsForPV = []string{"topology.kubernetes.io/zone"}
+			},
+			expected: false,
+		},
+		{
+			name: "cleanup limits changed",
+			update: func(config *common.UserConfig) {
+				config.MaxConcurrentCleanups = 2
+				config.CleanupQueueOrder = common.CleanupQueueOrderSmallestFirst
+			},
+			expected: false,
+		},
+		{
+			name: "jobs used for cleaning",
+			update: func(config *common.UserConfig) {
+				config.UseJobForCleaning = true
+			},
+			expected: true,
+		},
+		{
+			name: "jobs used for cleaning a new class",
+			update: func(config *common.UserConfig) {
+				config.DiscoveryMap["fast-disks"] = common.MountConfig{MountDir: "/mnt/fast-disks", UseJobForCleaning: &useJob}
+			},
+			expected: true,
+		},
+		{
+			name: "resync period changed",
+			update: func(config *common.UserConfig) {
+				config.MinResyncPeriod = metav1.Duration{Duration: time.Hour}
+			},
+			expected: true,
+		},
+		{
+			name: "failed cleanup job TTL changed",
+			update: func(config *common.UserConfig) {
+				config.FailedCleanupJobTTL = metav1.Duration{Duration: time.Hour}
+			},
+			expected: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updated := base()
+			test.update(updated)
+			if restart := needsRestart(base(), updated); restart != test.expected {
+				t.Errorf("Expected needsRestart to be %v, got %v", test.expected, restart)
+			}
+		})
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"zone": "a"}}}
+	runtimeConfig := &common.RuntimeConfig{
+		UserConfig: &common.UserConfig{
+			Node: node,
+			DiscoveryMap: map[string]common.MountConfig{
+				"local-storage": {HostDir: "/mnt/disks", MountDir: "/mnt/disks"},
+			},
+			MinResyncPeriod: metav1.Duration{Duration: 5 * time.Minute},
+		},
+	}
+	discoverer := &discovery.Discoverer{RuntimeConfig: runtimeConfig}
+	config := &common.UserConfig{
+		Node: node,
+		DiscoveryMap: map[string]common.MountConfig{
+			"fast-disks": {HostDir: "/mnt/fast-disks", MountDir: "/mnt/fast-disks"},
+		},
+		NodeLabelsForPV:       []string{"zone"},
+		LabelsForPV:           map[string]string{"tier": "fast"},
+		MaxConcurrentCleanups: 2,
+		MinResyncPeriod:       metav1.Duration{Duration: 5 * time.Minute},
+	}
+	if sameDiscoveryDirs(runtimeConfig.DiscoveryMap, config.DiscoveryMap) {
+		t.Errorf("Expected the discovery directories to differ")
+	}
+
+	updateConfig(runtimeConfig, discoverer, config)
+	if !reflect.DeepEqual(runtimeConfig.UserConfig, config) {
+		t.Errorf("Expected the configuration to be updated to %+v, got %+v", config, runtimeConfig.UserConfig)
+	}
+	expectedLabels := map[string]string{"zone": "a", "tier": "fast"}
+	if !reflect.DeepEqual(discoverer.Labels, expectedLabels) {
+		t.Errorf("Expected labels %v, got %v", expectedLabels, discoverer.Labels)
+	}
+	if !sameDiscoveryDirs(runtimeConfig.DiscoveryMap, config.DiscoveryMap) {
+		t.Errorf("Expected the discovery directories to be the same")
+	}
+}
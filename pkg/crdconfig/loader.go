@@ -0,0 +1,325 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crdconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+)
+
+const (
+	fieldManagerPrefix = "local-volume-provisioner-"
+	// maxFieldManagerLength is the maximum length of a field manager accepted by the API server.
+	maxFieldManagerLength = 128
+)
+
+var (
+	// mergedMapFields are the fields whose entries are merged across the objects.
+	mergedMapFields = map[string]bool{common.ProvisonerStorageClassConfig: true, "labelsForPV": true}
+	// mergedListFields are the fields whose items are concatenated across the objects.
+	mergedListFields = map[string]bool{common.ProvisionerNodeLabelsForPV: true, "jobTolerations": true}
+)
+
+// Loader loads the provisioner configuration of a node from the LocalVolumeProvisionerConfig
+// objects which select it, and reports in their status which configuration the node applied.
+type Loader struct {
+	client       dynamic.Interface
+	configLister cache.GenericLister
+	nodeLister   corelisters.NodeLister
+	nodeName     string
+	fieldManager string
+}
+
+// NewLoader creates a Loader for the node, and watches the LocalVolumeProvisionerConfig objects
+// and the node until stopCh is closed.
+func NewLoader(client kubernetes.Interface, dynamicClient dynamic.Interface, nodeName string, stopCh <-chan struct{}) (*Loader, error) {
+	// Fail early if the CRD is not installed, rather than waiting for the informer forever.
+	if _, err := dynamicClient.Resource(Resource).List(context.TODO(), metav1.ListOptions{Limit: 1}); err != nil {
+		return nil, fmt.Errorf("error listing %s objects: %v", Kind, err)
+	}
+	configInformerFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+	configInformer := configInformerFactory.ForResource(Resource)
+	nodeInformerFactory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", nodeName).String()
+		}))
+	nodeInformer := nodeInformerFactory.Core().V1().Nodes()
+	loader := &Loader{
+		client:       dynamicClient,
+		configLister: configInformer.Lister(),
+		nodeLister:   nodeInformer.Lister(),
+		nodeName:     nodeName,
+		fieldManager: fieldManager(nodeName),
+	}
+	configInformerFactory.Start(stopCh)
+	nodeInformerFactory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, configInformer.Informer().HasSynced, nodeInformer.Informer().HasSynced) {
+		return nil, fmt.Errorf("error syncing the %s objects and node %s", Kind, nodeName)
+	}
+	return loader, nil
+}
+
+// Load merges the LocalVolumeProvisionerConfig objects which select the node into
+// provisionerConfig, and reports the result in their status. The objects are merged in the order
+// of their names.
+func (l *Loader) Load(provisionerConfig *common.ProvisionerConfiguration) error {
+	node, err := l.nodeLister.Get(l.nodeName)
+	if err != nil {
+		return fmt.Errorf("error getting node %s: %v", l.nodeName, err)
+	}
+	objs, err := l.configLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("error listing %s objects: %v", Kind, err)
+	}
+	configs := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if config, ok := obj.(*unstructured.Unstructured); ok {
+			configs = append(configs, config)
+		}
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].GetName() < configs[j].GetName()
+	})
+
+	var selected []*unstructured.Unstructured
+	var loadErr error
+	for _, config := range configs {
+		selects, err := selectsNode(config, node)
+		if err != nil {
+			// The object may select the node, so the configuration of the node can't be known.
+			if loadErr == nil {
+				loadErr = err
+			}
+			selects = true
+		}
+		if selects {
+			selected = append(selected, config)
+		}
+	}
+	if loadErr == nil {
+		var data map[string]string
+		if data, loadErr = mergeSpecs(selected); loadErr == nil {
+			loadErr = common.ConfigMapDataToVolumeConfig(data, provisionerConfig)
+		}
+	}
+	l.reportStatus(configs, selected, loadErr)
+	return loadErr
+}
+
+// selectsNode returns true if the node selector of the object selects the node. An object
+// without node selector selects all the nodes.
+func selectsNode(config *unstructured.Unstructured, node *v1.Node) (bool, error) {
+	selectorField, found, err := unstructured.NestedMap(config.Object, "spec", NodeSelectorField)
+	if err != nil {
+		return false, fmt.Errorf("invalid node selector of %s: %v", config.GetName(), err)
+	}
+	if !found {
+		return true, nil
+	}
+	nodeSelector := &metav1.LabelSelector{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(selectorField, nodeSelector); err != nil {
+		return false, fmt.Errorf("invalid node selector of %s: %v", config.GetName(), err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(nodeSelector)
+	if err != nil {
+		return false, fmt.Errorf("invalid node selector of %s: %v", config.GetName(), err)
+	}
+	return selector.Matches(labels.Set(node.Labels)), nil
+}
+
+// mergeSpecs merges the specs of the objects into configmap data. The entries of
+// storageClassMap and labelsForPV, and the items of nodeLabelsForPV and jobTolerations, are
+// merged. The other fields, and the entries, can only be set by several objects to the same value.
+func mergeSpecs(configs []*unstructured.Unstructured) (map[string]string, error) {
+	merged := map[string]interface{}{}
+	// setBy is the object which set each field, and each entry of the merged maps.
+	setBy := map[string]string{}
+	for _, config := range configs {
+		spec, _, err := unstructured.NestedMap(config.Object, "spec")
+		if err != nil {
+			return nil, fmt.Errorf("invalid spec of %s: %v", config.GetName(), err)
+		}
+		delete(spec, NodeSelectorField)
+		for _, key := range sortedKeys(spec) {
+			value := spec[key]
+			current, set := merged[key]
+			entries, isMap := value.(map[string]interface{})
+			currentEntries, currentIsMap := current.(map[string]interface{})
+			items, isList := value.([]interface{})
+			currentItems, currentIsList := current.([]interface{})
+			switch {
+			case mergedMapFields[key] && isMap && (!set || currentIsMap):
+				if currentEntries == nil {
+					currentEntries = map[string]interface{}{}
+				}
+				for _, name := range sortedKeys(entries) {
+					field := key + "." + name
+					if existing, ok := currentEntries[name]; ok {
+						if !reflect.DeepEqual(existing, entries[name]) {
+							return nil, conflictError(field, setBy[field], config.GetName())
+						}
+						continue
+					}
+					currentEntries[name] = entries[name]
+					setBy[field] = config.GetName()
+				}
+				merged[key] = currentEntries
+			case mergedListFields[key] && isList && (!set || currentIsList):
+				merged[key] = append(currentItems, items...)
+			case set && !reflect.DeepEqual(current, value):
+				return nil, conflictError(key, setBy[key], config.GetName())
+			default:
+				merged[key] = value
+				setBy[key] = config.GetName()
+			}
+		}
+	}
+	data := make(map[string]string, len(merged))
+	for key, value := range merged {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("unable to Marshal %s: %v", key, err)
+		}
+		data[key] = string(raw)
+	}
+	return data, nil
+}
+
+func conflictError(field, config, otherConfig string) error {
+	return fmt.Errorf("%s is set to different values by %s objects %s and %s", field, Kind, config, otherConfig)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// reportStatus updates the entry of the node in the status of the objects: the selected objects
+// record the configuration applied on the node, or the error loading it, and the others have no
+// entry for the node.
+func (l *Loader) reportStatus(configs, selected []*unstructured.Unstructured, loadErr error) {
+	names := make([]string, 0, len(selected))
+	isSelected := map[string]bool{}
+	for _, config := range selected {
+		names = append(names, config.GetName())
+		isSelected[config.GetName()] = true
+	}
+	for _, config := range configs {
+		status := &Status{}
+		if statusField, found, err := unstructured.NestedMap(config.Object, "status"); err == nil && found {
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(statusField, status); err != nil {
+				klog.Warningf("Ignoring invalid status of %s %s: %v", Kind, config.GetName(), err)
+			}
+		}
+		var current *NodeStatus
+		for i := range status.Nodes {
+			if status.Nodes[i].NodeName == l.nodeName {
+				current = &status.Nodes[i]
+				break
+			}
+		}
+		entry, changed := nodeStatusUpdate(current, l.nodeName, isSelected[config.GetName()], config.GetGeneration(), names, loadErr)
+		if !changed {
+			continue
+		}
+		if err := l.applyNodeStatus(config.GetName(), entry); err != nil {
+			klog.Errorf("Error updating status of %s %s: %v", Kind, config.GetName(), err)
+		}
+	}
+}
+
+// nodeStatusUpdate returns the entry of the node in the status of an object, nil if it has none,
+// and whether it differs from the current one. If the configuration could not be loaded, the
+// entry keeps the configuration applied before.
+func nodeStatusUpdate(current *NodeStatus, nodeName string, selected bool, generation int64, applied []string, loadErr error) (*NodeStatus, bool) {
+	if !selected {
+		return nil, current != nil
+	}
+	entry := NodeStatus{NodeName: nodeName}
+	if current != nil {
+		entry = *current
+	}
+	if loadErr == nil {
+		entry.AppliedGeneration = generation
+		entry.AppliedConfigs = applied
+		entry.Error = ""
+	} else {
+		entry.Error = loadErr.Error()
+	}
+	if current != nil && entry.AppliedGeneration == current.AppliedGeneration &&
+		reflect.DeepEqual(entry.AppliedConfigs, current.AppliedConfigs) && entry.Error == current.Error {
+		return &entry, false
+	}
+	entry.LastUpdateTime = metav1.Now()
+	return &entry, true
+}
+
+// applyNodeStatus sets the entry of the node in the status of the object, or removes it if entry
+// is nil. The entries are server-side applied by each node, so that they don't conflict.
+func (l *Loader) applyNodeStatus(name string, entry *NodeStatus) error {
+	status := map[string]interface{}{}
+	if entry != nil {
+		nodeStatus, err := runtime.DefaultUnstructuredConverter.ToUnstructured(entry)
+		if err != nil {
+			return err
+		}
+		status["nodes"] = []interface{}{nodeStatus}
+	}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": Resource.GroupVersion().String(),
+		"kind":       Kind,
+		"metadata":   map[string]interface{}{"name": name},
+		"status":     status,
+	}}
+	_, err := l.client.Resource(Resource).ApplyStatus(context.TODO(), name, obj, metav1.ApplyOptions{FieldManager: l.fieldManager, Force: true})
+	return err
+}
+
+// fieldManager returns the field manager of the status entries of the node.
+func fieldManager(nodeName string) string {
+	manager := fieldManagerPrefix + nodeName
+	if len(manager) > maxFieldManagerLength {
+		h := fnv.New64a()
+		h.Write([]byte(nodeName))
+		manager = fmt.Sprintf("%s%x", fieldManagerPrefix, h.Sum64())
+	}
+	return manager
+}
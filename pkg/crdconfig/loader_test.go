@@ -0,0 +1,276 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crdconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+)
+
+const testNodeName = "node1"
+
+func newConfig(t *testing.T, name string, generation int64, spec, status string) *unstructured.Unstructured {
+	config := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	config.SetAPIVersion(Resource.GroupVersion().String())
+	config.SetKind(Kind)
+	config.SetName(name)
+	config.SetGeneration(generation)
+	for field, value := range map[string]string{"spec": spec, "status": status} {
+		if value == "" {
+			continue
+		}
+		content := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(value), &content); err != nil {
+			t.Fatalf("invalid %s of %s: %v", field, name, err)
+		}
+		config.Object[field] = content
+	}
+	return config
+}
+
+// appliedStatuses returns the status applied to each object, by object name.
+func appliedStatuses(t *testing.T, actions []core.Action) map[string]Status {
+	statuses := map[string]Status{}
+	for _, action := range actions {
+		patch, ok := action.(core.PatchAction)
+		if !ok || action.GetSubresource() != "status" {
+			continue
+		}
+		obj := struct {
+			Status Status `json:"status"`
+		}{}
+		if err := json.Unmarshal(patch.GetPatch(), &obj); err != nil {
+			t.Fatalf("invalid status applied to %s: %v", patch.GetName(), err)
+		}
+		for i := range obj.Status.Nodes {
+			obj.Status.Nodes[i].LastUpdateTime = metav1.Time{}
+		}
+		statuses[patch.GetName()] = obj.Status
+	}
+	return statuses
+}
+
+func TestLoad(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: testNodeName, Labels: map[string]string{"disks": "nvme"}}}
+	configs := []runtime.Object{
+		newConfig(t, "base", 3, `
+storageClassMap:
+  local-storage:
+    hostDir: /mnt/disks
+    mountDir: /mnt/disks
+nodeLabelsForPV: ["kubernetes.io/hostname"]
+`, ""),
+		newConfig(t, "nvme", 1, `
+nodeSelector:
+  matchLabels:
+    disks: nvme
+storageClassMap:
+  nvme:
+    hostDir: /mnt/nvme
+    mountDir: /mnt/nvme
+    volumeMode: Block
+nodeLabelsForPV: ["topology.kubernetes.io/zone"]
+`, `
+nodes:
+- nodeName: node1
+  appliedGeneration: 1
+  appliedConfigs: [base, nvme]
+  error: previous error
+`),
+		newConfig(t, "ssd", 2, `
+nodeSelector:
+  matchExpressions:
+  - key: disks
+    operator: In
+    values: [ssd]
+storageClassMap:
+  ssd:
+    hostDir: /mnt/ssd
+    mountDir: /mnt/ssd
+`, `
+nodes:
+- nodeName: node1
+  appliedGeneration: 1
+  appliedConfigs: [base, ssd]
+`),
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{Resource: Kind + "List"}, configs...)
+	dynamicClient.PrependReactor("patch", Resource.Resource, func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	loader, err := NewLoader(fake.NewSimpleClientset(node), dynamicClient, testNodeName, stopCh)
+	if err != nil {
+		t.Fatalf("NewLoader failed: %v", err)
+	}
+
+	provisionerConfig := common.ProvisionerConfiguration{StorageClassConfig: map[string]common.MountConfig{}}
+	if err := loader.Load(&provisionerConfig); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	classes := []string{}
+	for class := range provisionerConfig.StorageClassConfig {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	if expected := []string{"local-storage", "nvme"}; !reflect.DeepEqual(classes, expected) {
+		t.Errorf("Expected classes %v, got %v", expected, classes)
+	}
+	if expected := []string{"kubernetes.io/hostname", "topology.kubernetes.io/zone"}; !reflect.DeepEqual(provisionerConfig.NodeLabelsForPV, expected) {
+		t.Errorf("Expected node labels %v, got %v", expected, provisionerConfig.NodeLabelsForPV)
+	}
+
+	expectedStatuses := map[string]Status{
+		"base": {Nodes: []NodeStatus{{NodeName: testNodeName, AppliedGeneration: 3, AppliedConfigs: []string{"base", "nvme"}}}},
+		"nvme": {Nodes: []NodeStatus{{NodeName: testNodeName, AppliedGeneration: 1, AppliedConfigs: []string{"base", "nvme"}}}},
+		// The node is no longer selected.
+		"ssd": {},
+	}
+	if statuses := appliedStatuses(t, dynamicClient.Actions()); !reflect.DeepEqual(statuses, expectedStatuses) {
+		t.Errorf("Expected statuses %+v, got %+v", expectedStatuses, statuses)
+	}
+	for _, action := range dynamicClient.Actions() {
+		if patch, ok := action.(core.PatchAction); ok && patch.GetSubresource() == "status" {
+			if patch.GetPatchType() != "application/apply-patch+yaml" {
+				t.Errorf("Expected the status of %s to be server-side applied, got %s", patch.GetName(), patch.GetPatchType())
+			}
+		}
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: testNodeName}}
+	configs := []runtime.Object{
+		newConfig(t, "base", 2, `
+storageClassMap:
+  local-storage:
+    hostDir: /mnt/disks
+    mountDir: /mnt/disks
+    volumemode: Block
+`, `
+nodes:
+- nodeName: node1
+  appliedGeneration: 1
+  appliedConfigs: [base]
+`),
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{Resource: Kind + "List"}, configs...)
+	dynamicClient.PrependReactor("patch", Resource.Resource, func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	loader, err := NewLoader(fake.NewSimpleClientset(node), dynamicClient, testNodeName, stopCh)
+	if err != nil {
+		t.Fatalf("NewLoader failed: %v", err)
+	}
+
+	provisionerConfig := common.ProvisionerConfiguration{StorageClassConfig: map[string]common.MountConfig{}}
+	err = loader.Load(&provisionerConfig)
+	expectedErr := `unknown field "storageClassMap.local-storage.volumemode"`
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("Expected error %q, got %v", expectedErr, err)
+	}
+	// The previously applied generation is kept.
+	expectedStatuses := map[string]Status{
+		"base": {Nodes: []NodeStatus{{NodeName: testNodeName, AppliedGeneration: 1, AppliedConfigs: []string{"base"}, Error: expectedErr}}},
+	}
+	if statuses := appliedStatuses(t, dynamicClient.Actions()); !reflect.DeepEqual(statuses, expectedStatuses) {
+		t.Errorf("Expected statuses %+v, got %+v", expectedStatuses, statuses)
+	}
+}
+
+func TestMergeSpecs(t *testing.T) {
+	tests := []struct {
+		name        string
+		specs       []string
+		expected    map[string]string
+		expectedErr error
+	}{
+		{
+			name: "merged entries and items",
+			specs: []string{
+				`{"storageClassMap": {"a": {"hostDir": "/mnt/a"}}, "labelsForPV": {"x": "1"}, "jobTolerations": [{"key": "k1"}], "useJobForCleaning": true}`,
+				`{"nodeSelector": {"matchLabels": {"pool": "b"}}, "storageClassMap": {"a": {"hostDir": "/mnt/a"}, "b": {"hostDir": "/mnt/b"}}, "labelsForPV": {"y": "2"}, "jobTolerations": [{"key": "k2"}], "useJobForCleaning": true}`,
+			},
+			expected: map[string]string{
+				"storageClassMap":   `{"a":{"hostDir":"/mnt/a"},"b":{"hostDir":"/mnt/b"}}`,
+				"labelsForPV":       `{"x":"1","y":"2"}`,
+				"jobTolerations":    `[{"key":"k1"},{"key":"k2"}]`,
+				"useJobForCleaning": "true",
+			},
+		},
+		{
+			name: "conflicting class",
+			specs: []string{
+				`{"storageClassMap": {"a": {"hostDir": "/mnt/a"}}}`,
+				`{"storageClassMap": {"a": {"hostDir": "/mnt/other"}}}`,
+			},
+			expectedErr: fmt.Errorf("storageClassMap.a is set to different values by LocalVolumeProvisionerConfig objects config0 and config1"),
+		},
+		{
+			name: "conflicting field",
+			specs: []string{
+				`{"minResyncPeriod": "5m"}`,
+				`{"storageClassMap": {}}`,
+				`{"minResyncPeriod": "1h"}`,
+			},
+			expectedErr: fmt.Errorf("minResyncPeriod is set to different values by LocalVolumeProvisionerConfig objects config0 and config2"),
+		},
+	}
+	for _, test := range tests {
+		var configs []*unstructured.Unstructured
+		for i, spec := range test.specs {
+			configs = append(configs, newConfig(t, fmt.Sprintf("config%d", i), 1, spec, ""))
+		}
+		data, err := mergeSpecs(configs)
+		if !reflect.DeepEqual(err, test.expectedErr) {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.expectedErr, err)
+		}
+		if err == nil && !reflect.DeepEqual(data, test.expected) {
+			t.Errorf("%s: expected data %v, got %v", test.name, test.expected, data)
+		}
+	}
+}
+
+func TestFieldManager(t *testing.T) {
+	if manager := fieldManager("node1"); manager != "local-volume-provisioner-node1" {
+		t.Errorf("Unexpected field manager %q", manager)
+	}
+	long := fmt.Sprintf("%0120d", 1)
+	if manager := fieldManager(long); len(manager) > maxFieldManagerLength || manager == fieldManager(long+"2") {
+		t.Errorf("Unexpected field manager %q for a long node name", manager)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crdconfig
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Group is the API group of the LocalVolumeProvisionerConfig objects.
+	Group = "local-static-provisioner.sigs.k8s.io"
+	// Version is the API version of the LocalVolumeProvisionerConfig objects.
+	Version = "v1alpha1"
+	// Kind is the kind of the LocalVolumeProvisionerConfig objects.
+	Kind = "LocalVolumeProvisionerConfig"
+	// NodeSelectorField is the field of the spec which selects the nodes the object applies to.
+	// The other fields of the spec are the keys of the provisioner configmap.
+	NodeSelectorField = "nodeSelector"
+)
+
+// Resource is the resource of the LocalVolumeProvisionerConfig objects.
+var Resource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "localvolumeprovisionerconfigs"}
+
+// Status is the status of a LocalVolumeProvisionerConfig.
+type Status struct {
+	// Nodes has an entry for each node selected by the object.
+	Nodes []NodeStatus `json:"nodes,omitempty"`
+}
+
+// NodeStatus is the status of a LocalVolumeProvisionerConfig on a node it selects, written by the
+// provisioner of the node.
+type NodeStatus struct {
+	// NodeName is the name of the node.
+	NodeName string `json:"nodeName"`
+	// AppliedGeneration is the generation of the object in the configuration applied on the node.
+	AppliedGeneration int64 `json:"appliedGeneration,omitempty"`
+	// AppliedConfigs are the names of the objects merged into the configuration applied on the
+	// node, in the order they are merged.
+	AppliedConfigs []string `json:"appliedConfigs,omitempty"`
+	// Error is why the latest configuration could not be applied on the node, if it could not. The
+	// node keeps the configuration applied before.
+	Error string `json:"error,omitempty"`
+	// LastUpdateTime is when the entry last changed.
+	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deleter
+
+import (
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/metrics"
+)
+
+// pendingCleanup is a cleanup waiting for the concurrency limits.
+type pendingCleanup struct {
+	pv          *v1.PersistentVolume
+	volMode     v1.PersistentVolumeMode
+	mountPath   string
+	config      common.MountConfig
+	runjob      bool
+	queuedSince time.Time
+}
+
+// queueCleanup starts the cleanup of the PV right away if concurrent cleanups are not limited.
+// Otherwise the cleanup is queued, and started by DeletePVs once the limits allow it.
+func (d *Deleter) queueCleanup(pv *v1.PersistentVolume, volMode v1.PersistentVolumeMode, mountPath string,
+	config common.MountConfig, runjob bool) error {
+	if d.MaxConcurrentCleanups == 0 && config.MaxConcurrentCleanups == 0 {
+		return d.startCleanup(pv, volMode, mountPath, config, runjob)
+	}
+	queuedSince, ok := d.queuedSince[pv.Name]
+	if !ok {
+		queuedSince = time.Now()
+		d.queuedSince[pv.Name] = queuedSince
+	}
+	d.pendingCleanups = append(d.pendingCleanups, &pendingCleanup{
+		pv:          pv,
+		volMode:     volMode,
+		mountPath:   mountPath,
+		config:      config,
+		runjob:      runjob,
+		queuedSince: queuedSince,
+	})
+	return nil
+}
+
+// startQueuedCleanups starts the queued cleanups, in the configured order, as long as the cleanups
+// in progress on the node and in their storage class are below the limits. The others stay queued.
+func (d *Deleter) startQueuedCleanups() {
+	pending := d.pendingCleanups
+	d.pendingCleanups = nil
+	sort.SliceStable(pending, func(i, j int) bool {
+		return d.cleanupBefore(pending[i], pending[j])
+	})
+
+	running := 0
+	for _, count := range d.runningCleanups {
+		running += count
+	}
+	queuedSince := map[string]time.Time{}
+	for _, cleanup := range pending {
+		class := cleanup.pv.Spec.StorageClassName
+		if (d.MaxConcurrentCleanups > 0 && running >= d.MaxConcurrentCleanups) ||
+			(cleanup.config.MaxConcurrentCleanups > 0 && d.runningCleanups[class] >= cleanup.config.MaxConcurrentCleanups) {
+			klog.V(4).Infof("Cleanup of pv %s is queued", cleanup.pv.Name)
+			queuedSince[cleanup.pv.Name] = cleanup.queuedSince
+			continue
+		}
+		klog.Infof("Starting queued cleanup of pv %s", cleanup.pv.Name)
+		if err := d.startCleanup(cleanup.pv, cleanup.volMode, cleanup.mountPath, cleanup.config, cleanup.runjob); err != nil {
+			d.reportDeleteFailure(cleanup.pv, err)
+			continue
+		}
+		running++
+		d.runningCleanups[class]++
+	}
+	d.queuedSince = queuedSince
+	metrics.CleanupQueueDepth.Set(float64(len(queuedSince)))
+}
+
+// cleanupBefore returns true if the cleanup a is started before the cleanup b.
+func (d *Deleter) cleanupBefore(a, b *pendingCleanup) bool {
+	if d.CleanupQueueOrder == common.CleanupQueueOrderSmallestFirst {
+		capacityA, capacityB := a.pv.Spec.Capacity[v1.ResourceStorage], b.pv.Spec.Capacity[v1.ResourceStorage]
+		if cmp := capacityA.Cmp(capacityB); cmp != 0 {
+			return cmp < 0
+		}
+	}
+	if !a.queuedSince.Equal(b.queuedSince) {
+		return a.queuedSince.Before(b.queuedSince)
+	}
+	return a.pv.Name < b.pv.Name
+}
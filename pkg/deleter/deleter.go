@@ -18,21 +18,36 @@ package deleter
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
-	"strings"
 	"sync"
 	"time"
 
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/cleaner"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/metrics"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/util"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 )
 
+// progressUpdatePeriod is the minimum period between two updates of the cleanup progress annotation of a PV.
+var progressUpdatePeriod = 30 * time.Second
+
+// mkfsCommand is the command formatting the devices of the volumes which are formatted again on release.
+var mkfsCommand = "mkfs"
+
+var (
+	// initialCleanupBackoff is the delay before retrying a failed cleanup, doubled on each failure.
+	initialCleanupBackoff = 30 * time.Second
+	// maxCleanupBackoff is the maximum delay before retrying a failed cleanup.
+	maxCleanupBackoff = 30 * time.Minute
+)
+
 // CleanupState indicates the state of the cleanup process.
 type CleanupState int
 
@@ -47,6 +62,8 @@ const (
 	CSFailed
 	// CSSucceeded Cleanup process has ended successfully.
 	CSSucceeded
+	// CSInterrupted Cleanup process was still running when the provisioner restarted.
+	CSInterrupted
 )
 
 // Deleter handles PV cleanup and object deletion
@@ -54,20 +71,43 @@ const (
 type Deleter struct {
 	*common.RuntimeConfig
 	CleanupStatus *CleanupStatusTracker
+	// cleanupFailures tracks the PVs whose cleanup failed, by PV name
+	cleanupFailures map[string]*cleanupFailure
+	// runningCleanups counts the cleanups in progress when the current DeletePVs started, and the
+	// ones it started, by storage class
+	runningCleanups map[string]int
+	// processClasses records the storage class of the cleanup processes started, by PV name
+	processClasses map[string]string
+	// pendingCleanups are the cleanups waiting for the concurrency limits found by the last discovery
+	// and the current DeletePVs
+	pendingCleanups []*pendingCleanup
+	// queuedSince tracks when the cleanups waiting for the concurrency limits were queued, by PV name
+	queuedSince map[string]time.Time
+}
+
+// cleanupFailure tracks the failed cleanup attempts of a PV.
+type cleanupFailure struct {
+	attempts   int
+	retryAfter time.Time
 }
 
 // NewDeleter creates a Deleter object to handle the cleanup and deletion of local PVs
 // allocated by this provisioner
 func NewDeleter(config *common.RuntimeConfig, cleanupTracker *CleanupStatusTracker) *Deleter {
 	return &Deleter{
-		RuntimeConfig: config,
-		CleanupStatus: cleanupTracker,
+		RuntimeConfig:   config,
+		CleanupStatus:   cleanupTracker,
+		cleanupFailures: map[string]*cleanupFailure{},
+		runningCleanups: map[string]int{},
+		processClasses:  map[string]string{},
+		queuedSince:     map[string]time.Time{},
 	}
 }
 
 // DeletePVs will scan through all the existing PVs that are released, and cleanup and
 // delete them
 func (d *Deleter) DeletePVs() {
+	d.runningCleanups = d.countRunningCleanups()
 	for _, pv := range d.Cache.ListPVs() {
 		if pv.Status.Phase != v1.VolumeReleased {
 			continue
@@ -89,18 +129,7 @@ func (d *Deleter) DeletePVs() {
 			// Cleanup volume
 			err := d.deletePV(pv)
 			if err != nil {
-				mode, modeErr := d.getVolMode(pv)
-				if modeErr != nil {
-					mode = "unknown"
-				}
-				deleteType := metrics.DeleteTypeProcess
-				if d.shouldRunJob(mode) {
-					deleteType = metrics.DeleteTypeJob
-				}
-				metrics.PersistentVolumeDeleteFailedTotal.WithLabelValues(string(mode), deleteType).Inc()
-				cleaningLocalPVErr := fmt.Errorf("Error cleaning PV %q: %v", name, err.Error())
-				d.RuntimeConfig.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeFailedDelete, cleaningLocalPVErr.Error())
-				klog.Error(err)
+				d.reportDeleteFailure(pv, err)
 				continue
 			}
 		default:
@@ -108,6 +137,57 @@ func (d *Deleter) DeletePVs() {
 			d.RuntimeConfig.Recorder.Eventf(pv, v1.EventTypeWarning, "VolumeUnknownReclaimPolicy", "Volume has unrecognized PersistentVolumeReclaimPolicy")
 		}
 	}
+	d.startQueuedCleanups()
+}
+
+// countRunningCleanups counts the cleanup processes and jobs in progress by storage class, whether
+// their PV is still released or not, e.g. for the cleanups of the dirty volumes found by discovery.
+// The cleanups whose storage class is unknown only count for the node-wide limit.
+func (d *Deleter) countRunningCleanups() map[string]int {
+	running := map[string]int{}
+	processClasses := map[string]string{}
+	for _, pvName := range d.CleanupStatus.ProcTable.ListRunning() {
+		class, ok := d.processClasses[pvName]
+		if !ok {
+			class = d.pvStorageClass(pvName)
+		}
+		processClasses[pvName] = class
+		running[class]++
+	}
+	// Forget the processes which have ended.
+	d.processClasses = processClasses
+	if d.CleanupStatus.JobController != nil {
+		for pvName, class := range d.CleanupStatus.JobController.ListRunningJobs() {
+			if class == "" {
+				class = d.pvStorageClass(pvName)
+			}
+			running[class]++
+		}
+	}
+	return running
+}
+
+// pvStorageClass returns the storage class of the PV, or "" if it is unknown.
+func (d *Deleter) pvStorageClass(pvName string) string {
+	if pv, exists := d.Cache.GetPV(pvName); exists {
+		return pv.Spec.StorageClassName
+	}
+	return ""
+}
+
+func (d *Deleter) reportDeleteFailure(pv *v1.PersistentVolume, err error) {
+	mode, modeErr := d.getVolMode(pv)
+	if modeErr != nil {
+		mode = "unknown"
+	}
+	deleteType := metrics.DeleteTypeProcess
+	if d.shouldRunJob(mode, d.DiscoveryMap[pv.Spec.StorageClassName]) {
+		deleteType = metrics.DeleteTypeJob
+	}
+	metrics.PersistentVolumeDeleteFailedTotal.WithLabelValues(string(mode), deleteType).Inc()
+	cleaningLocalPVErr := fmt.Errorf("Error cleaning PV %q: %v", pv.Name, err.Error())
+	d.RuntimeConfig.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeFailedDelete, cleaningLocalPVErr.Error())
+	klog.Error(err)
 }
 
 func (d *Deleter) getVolMode(pv *v1.PersistentVolume) (v1.PersistentVolumeMode, error) {
@@ -129,8 +209,8 @@ func (d *Deleter) getVolMode(pv *v1.PersistentVolume) (v1.PersistentVolumeMode,
 	return volMode, nil
 }
 
-func (d *Deleter) shouldRunJob(mode v1.PersistentVolumeMode) bool {
-	return mode == v1.PersistentVolumeBlock && d.RuntimeConfig.UseJobForCleaning
+func (d *Deleter) shouldRunJob(mode v1.PersistentVolumeMode, config common.MountConfig) bool {
+	return d.RuntimeConfig.UseJobForCleaningVolume(mode, config)
 }
 
 func (d *Deleter) deletePV(pv *v1.PersistentVolume) error {
@@ -147,11 +227,21 @@ func (d *Deleter) deletePV(pv *v1.PersistentVolume) error {
 	if err != nil {
 		return err
 	}
+	// The volume holds the data of its previous user as soon as its PV is released, whether its
+	// cleanup starts right away, waits in the queue or backs off after a failure.
+	if err := d.CleanupStatus.DirtyVolumes.Mark(pv.Spec.Local.Path); err != nil {
+		return err
+	}
+	// Exit if the PV has been quarantined after too many failed cleanups.
+	if _, quarantined := pv.Annotations[common.AnnCleanupQuarantined]; quarantined {
+		klog.V(4).Infof("Cleanup of pv %s is quarantined, skipping", pv.Name)
+		return nil
+	}
 	volMode, err := d.getVolMode(pv)
 	if err != nil {
 		return fmt.Errorf("failed to get volume mode of path %q: %v", mountPath, err)
 	}
-	runjob := d.shouldRunJob(volMode)
+	runjob := d.shouldRunJob(volMode, config)
 
 	// Exit if cleaning is still in progress.
 	if d.CleanupStatus.InProgress(pv.Name, runjob) {
@@ -168,6 +258,11 @@ func (d *Deleter) deletePV(pv *v1.PersistentVolume) error {
 	case CSSucceeded:
 		// Found a completed cleaning entry
 		klog.Infof("Deleting pv %s after successful cleanup", pv.Name)
+		delete(d.cleanupFailures, pv.Name)
+		if err := d.CleanupStatus.DirtyVolumes.Clear(pv.Spec.Local.Path); err != nil {
+			// The volume is then cleaned up again by discovery before it is published.
+			klog.Error(err)
+		}
 		if err = d.APIUtil.DeletePV(pv.Name); err != nil {
 			if !errors.IsNotFound(err) {
 				d.RuntimeConfig.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeFailedDelete,
@@ -188,25 +283,105 @@ func (d *Deleter) deletePV(pv *v1.PersistentVolume) error {
 			}
 			capacityBreakDown := metrics.CapacityBreakDown(capacityBytes)
 			cleanupCommand := ""
-			if len(config.BlockCleanerCommand) > 0 {
+			if volMode == v1.PersistentVolumeFilesystem && len(config.FilesystemCleanerCommand) > 0 {
+				cleanupCommand = config.FilesystemCleanerCommand[0]
+			} else if len(config.BlockCleanerCommand) > 0 {
 				cleanupCommand = config.BlockCleanerCommand[0]
 			}
 			metrics.PersistentVolumeDeleteDurationSeconds.WithLabelValues(mode, deleteType, capacityBreakDown, cleanupCommand).Observe(time.Since(*startTime).Seconds())
 		}
 		return nil
 	case CSFailed:
-		klog.Infof("Cleanup for pv %s failed. Restarting cleanup", pv.Name)
+		d.recordCleanupFailure(pv.Name)
+	case CSInterrupted:
+		klog.Infof("Cleanup for pv %s was interrupted by a provisioner restart. Restarting cleanup", pv.Name)
 	case CSNotFound:
-		klog.Infof("Start cleanup for pv %s", pv.Name)
 	default:
 		return fmt.Errorf("Unexpected state %d for pv %s", state, pv.Name)
 	}
 
+	if failure, ok := d.cleanupFailures[pv.Name]; ok {
+		if config.MaxCleanupAttempts > 0 && failure.attempts >= config.MaxCleanupAttempts {
+			return d.quarantinePV(pv, failure.attempts)
+		}
+		if time.Now().Before(failure.retryAfter) {
+			return nil
+		}
+		klog.Infof("Restarting cleanup for pv %s after %d failed attempts", pv.Name, failure.attempts)
+	} else {
+		klog.Infof("Start cleanup for pv %s", pv.Name)
+	}
+
+	return d.queueCleanup(pv, volMode, mountPath, config, runjob)
+}
+
+// CleanVolume cleans up a dirty volume whose PV is gone, e.g. because the PV was deleted by hand
+// before its cleanup completed. pv is the PV to be created for the volume once it is clean.
+// It returns true once the volume has been cleaned up and can be published again. The cleanup is
+// queued, retried and quarantined like the ones of the released PVs, the quarantine being recorded
+// on the node since there is no PV to annotate.
+func (d *Deleter) CleanVolume(pv *v1.PersistentVolume, volMode v1.PersistentVolumeMode, mountPath string,
+	config common.MountConfig) (bool, error) {
+	quarantined, err := d.CleanupStatus.DirtyVolumes.IsQuarantined(pv.Spec.Local.Path)
+	if err != nil {
+		return false, err
+	}
+	if quarantined {
+		klog.V(4).Infof("Cleanup of dirty volume %q is quarantined, skipping", pv.Spec.Local.Path)
+		return false, nil
+	}
+	runjob := d.shouldRunJob(volMode, config)
+	if d.CleanupStatus.InProgress(pv.Name, runjob) {
+		return false, nil
+	}
+	state, _, err := d.CleanupStatus.RemoveStatus(pv.Name, runjob)
+	if err != nil {
+		return false, err
+	}
+	switch state {
+	case CSSucceeded:
+		klog.Infof("Dirty volume %q of pv %s has been cleaned up", pv.Spec.Local.Path, pv.Name)
+		delete(d.cleanupFailures, pv.Name)
+		if err := d.CleanupStatus.DirtyVolumes.Clear(pv.Spec.Local.Path); err != nil {
+			return false, err
+		}
+		return true, nil
+	case CSFailed:
+		d.recordCleanupFailure(pv.Name)
+	}
+	if failure, ok := d.cleanupFailures[pv.Name]; ok {
+		if config.MaxCleanupAttempts > 0 && failure.attempts >= config.MaxCleanupAttempts {
+			return false, d.quarantineVolume(pv, failure.attempts)
+		}
+		if time.Now().Before(failure.retryAfter) {
+			return false, nil
+		}
+	}
+	klog.Infof("Start cleanup of dirty volume %q before creating pv %s", pv.Spec.Local.Path, pv.Name)
+	return false, d.queueCleanup(pv, volMode, mountPath, config, runjob)
+}
+
+// startCleanup marks the volume of the PV as dirty, and starts cleaning it up.
+func (d *Deleter) startCleanup(pv *v1.PersistentVolume, volMode v1.PersistentVolumeMode, mountPath string,
+	config common.MountConfig, runjob bool) error {
+	// Never clean up anything outside of the mount dir of the class.
+	if !util.IsStrictlyBeneath(config.MountDir, mountPath) {
+		return fmt.Errorf("refusing to clean pv %q: mountPath %s is not beneath mount dir %s", pv.Name, mountPath,
+			config.MountDir)
+	}
 	if volMode == v1.PersistentVolumeBlock {
 		if len(config.BlockCleanerCommand) < 1 {
 			return fmt.Errorf("Blockcleaner command was empty for pv %q mountPath %s but mount dir is %s", pv.Name,
 				mountPath, config.MountDir)
 		}
+		if err := d.verifyBlockDeviceIdentity(pv, mountPath); err != nil {
+			return err
+		}
+	}
+
+	// Never start a cleanup that could be interrupted without the volume being known as dirty.
+	if err := d.CleanupStatus.DirtyVolumes.Mark(pv.Spec.Local.Path); err != nil {
+		return err
 	}
 
 	if runjob {
@@ -217,6 +392,83 @@ func (d *Deleter) deletePV(pv *v1.PersistentVolume) error {
 	return d.runProcess(pv, volMode, mountPath, config)
 }
 
+// recordCleanupFailure counts a failed cleanup of the PV, and delays its next attempt with an
+// exponential backoff.
+func (d *Deleter) recordCleanupFailure(pvName string) {
+	failure, ok := d.cleanupFailures[pvName]
+	if !ok {
+		failure = &cleanupFailure{}
+		d.cleanupFailures[pvName] = failure
+	}
+	failure.attempts++
+	backoff := initialCleanupBackoff
+	for i := 1; i < failure.attempts && backoff < maxCleanupBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, maxCleanupBackoff)
+	failure.retryAfter = time.Now().Add(backoff)
+	klog.Infof("Cleanup for pv %s failed %d times. Retrying in %v", pvName, failure.attempts, backoff)
+}
+
+// quarantinePV marks the PV as quarantined, so that its cleanup is no longer retried until an
+// admin removes the annotation.
+func (d *Deleter) quarantinePV(pv *v1.PersistentVolume, attempts int) error {
+	pvCopy := pv.DeepCopy()
+	if pvCopy.Annotations == nil {
+		pvCopy.Annotations = map[string]string{}
+	}
+	pvCopy.Annotations[common.AnnCleanupQuarantined] = fmt.Sprintf("cleanup failed %d times", attempts)
+	if _, err := d.APIUtil.UpdatePV(pvCopy); err != nil {
+		return fmt.Errorf("Error quarantining pv %q: %v", pv.Name, err)
+	}
+	// The attempts are counted again from zero once the annotation is removed.
+	delete(d.cleanupFailures, pv.Name)
+	msg := fmt.Sprintf("Cleanup failed %d times, not retrying it until the %s annotation is removed", attempts,
+		common.AnnCleanupQuarantined)
+	d.RuntimeConfig.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeCleanupQuarantined, msg)
+	klog.Warningf("Quarantined pv %s: %s", pv.Name, msg)
+	return nil
+}
+
+// quarantineVolume records on the node that the dirty volume of the PV to be created is quarantined,
+// so that its cleanup is no longer retried until an admin removes the record.
+func (d *Deleter) quarantineVolume(pv *v1.PersistentVolume, attempts int) error {
+	reason := fmt.Sprintf("cleanup failed %d times", attempts)
+	if err := d.CleanupStatus.DirtyVolumes.Quarantine(pv.Spec.Local.Path, reason); err != nil {
+		return err
+	}
+	// The attempts are counted again from zero once the record is removed.
+	delete(d.cleanupFailures, pv.Name)
+	klog.Warningf("Quarantined dirty volume %q of pv %s: cleanup failed %d times, not retrying it until its record "+
+		"is removed from the dirty/quarantined directory of the cleanup journal", pv.Spec.Local.Path, pv.Name, attempts)
+	return nil
+}
+
+// verifyBlockDeviceIdentity makes sure that the device currently behind blkdevPath is the one
+// that was recorded on the PV when it was discovered. PVs created without a recorded identity
+// are not checked. The partition UUID is only compared when it can currently be read.
+func (d *Deleter) verifyBlockDeviceIdentity(pv *v1.PersistentVolume, blkdevPath string) error {
+	expected := common.BlockDeviceIdentityFromAnnotations(pv)
+	if expected == nil {
+		return nil
+	}
+	actual, err := d.VolUtil.GetBlockDeviceIdentity(blkdevPath)
+	if err != nil {
+		err = fmt.Errorf("refusing to clean pv %q: failed to get identity of device %q: %v", pv.Name, blkdevPath, err)
+		d.RuntimeConfig.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeDeviceUnknown, err.Error())
+		return err
+	}
+	if expected.WWN != "" && expected.WWN != actual.WWN ||
+		expected.Serial != "" && expected.Serial != actual.Serial ||
+		expected.PartUUID != "" && actual.PartUUID != "" && expected.PartUUID != actual.PartUUID {
+		err = fmt.Errorf("refusing to clean pv %q: device %q is %+v but pv was created for %+v", pv.Name, blkdevPath,
+			*actual, *expected)
+		d.RuntimeConfig.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeDeviceMismatch, err.Error())
+		return err
+	}
+	return nil
+}
+
 func (d *Deleter) runProcess(pv *v1.PersistentVolume, volMode v1.PersistentVolumeMode, mountPath string,
 	config common.MountConfig) error {
 	// Run as exec script.
@@ -224,6 +476,7 @@ func (d *Deleter) runProcess(pv *v1.PersistentVolume, volMode v1.PersistentVolum
 	if err != nil {
 		return err
 	}
+	d.processClasses[pv.Name] = pv.Spec.StorageClassName
 
 	go d.asyncCleanPV(pv, volMode, mountPath, config)
 	return nil
@@ -250,7 +503,7 @@ func (d *Deleter) asyncCleanPV(pv *v1.PersistentVolume, volMode v1.PersistentVol
 func (d *Deleter) cleanPV(pv *v1.PersistentVolume, volMode v1.PersistentVolumeMode, mountPath string,
 	config common.MountConfig) error {
 	// Make absolutely sure here that we are not deleting anything outside of mounted dir
-	if !strings.HasPrefix(mountPath, config.MountDir) {
+	if !util.IsStrictlyBeneath(config.MountDir, mountPath) {
 		return fmt.Errorf("Unexpected error pv %q mountPath %s but mount dir is %s", pv.Name, mountPath,
 			config.MountDir)
 	}
@@ -268,10 +521,146 @@ func (d *Deleter) cleanPV(pv *v1.PersistentVolume, volMode v1.PersistentVolumeMo
 }
 
 func (d *Deleter) cleanFilePV(pv *v1.PersistentVolume, mountPath string, config common.MountConfig) error {
-	klog.Infof("Deleting PV file volume %q contents at hostpath %q, mountpath %q", pv.Name, pv.Spec.Local.Path,
-		mountPath)
+	if config.ReformatOnRelease != nil {
+		return d.reformatFilePV(pv, mountPath, config)
+	}
+	if len(config.FilesystemCleanerCommand) == 0 {
+		klog.Infof("Deleting PV file volume %q contents at hostpath %q, mountpath %q", pv.Name, pv.Spec.Local.Path,
+			mountPath)
+		hostPath := pv.Spec.Local.Path
+		removed, err := d.VolUtil.DeleteContents(hostPath, mountPath, config.MountDir)
+		klog.Infof("Deleted %d entries of PV file volume %q", removed, pv.Name)
+		if contentsErr, ok := err.(*util.DeleteContentsError); ok {
+			d.RuntimeConfig.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeFailedDelete,
+				"Error cleaning PV %q: %v", pv.Name, contentsErr)
+		}
+		return err
+	}
+
+	klog.Infof("Cleaning PV file volume %q at hostpath %q, mountpath %q with %q", pv.Name, pv.Spec.Local.Path,
+		mountPath, config.FilesystemCleanerCommand)
+	progress := d.cleanupProgressReporter(pv)
+	defer metrics.CleanupProgressRatio.DeleteLabelValues(pv.Name)
+
+	ctx, cancel := cleanupContext(config)
+	defer cancel()
+	err := d.execScript(ctx, pv.Name, common.LocalFilesystemEnv, mountPath, progress, config.FilesystemCleanerCommand[0], config.FilesystemCleanerCommand[1:]...)
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("cleanup of pv %q timed out after %v: %v", pv.Name, config.CleanupTimeout.Duration, err)
+	}
+	if err != nil {
+		return err
+	}
+	klog.Infof("Completed cleanup of pv %q", pv.Name)
+	return nil
+}
+
+// reformatFilePV cleans up a filesystem volume by unmounting it, formatting its device again and
+// mounting the new filesystem back. The device and its identity are recorded before the volume is
+// unmounted, so that a cleanup interrupted before the volume is mounted again can be resumed, and the
+// identity is checked again before the device is formatted, as its kernel name may have changed.
+func (d *Deleter) reformatFilePV(pv *v1.PersistentVolume, mountPath string, config common.MountConfig) error {
+	reformat := config.ReformatOnRelease
 	hostPath := pv.Spec.Local.Path
-	return d.VolUtil.DeleteContents(hostPath, mountPath)
+	mountPoints, err := d.RuntimeConfig.Mounter.List()
+	if err != nil {
+		return fmt.Errorf("error listing mount points to reformat pv %q: %v", pv.Name, err)
+	}
+	device := ""
+	for _, mp := range mountPoints {
+		if mp.Path == mountPath {
+			device = mp.Device
+		}
+	}
+	identity := ""
+	if device != "" {
+		// Formatting the device of a bind mounted subdirectory would wipe the rest of its filesystem.
+		root, err := d.VolUtil.GetMountRoot(mountPath)
+		if err != nil {
+			return fmt.Errorf("error getting mount root of pv %q at %q: %v", pv.Name, mountPath, err)
+		}
+		if root != "/" {
+			return fmt.Errorf("refusing to reformat pv %q: %q is a bind mount of %q on device %q", pv.Name,
+				mountPath, root, device)
+		}
+		identity, err = d.reformatIdentity(pv, device)
+		if err != nil {
+			return err
+		}
+		if err := d.CleanupStatus.DirtyVolumes.RecordDevice(hostPath, device, identity); err != nil {
+			return err
+		}
+		klog.Infof("Unmounting PV file volume %q at mountpath %q from device %q", pv.Name, mountPath, device)
+		if err := d.RuntimeConfig.Mounter.Unmount(mountPath); err != nil {
+			return fmt.Errorf("error unmounting pv %q at %q: %v", pv.Name, mountPath, err)
+		}
+	} else {
+		// The volume was unmounted by an interrupted cleanup.
+		device, identity, err = d.CleanupStatus.DirtyVolumes.Device(hostPath)
+		if err != nil {
+			return err
+		}
+		if device == "" {
+			return fmt.Errorf("cannot reformat pv %q: %q is not mounted and its device is unknown", pv.Name, mountPath)
+		}
+	}
+	actual, err := d.reformatIdentity(pv, device)
+	if err != nil {
+		return err
+	}
+	if actual != identity {
+		err = fmt.Errorf("refusing to reformat pv %q: device %q is %q but %q was recorded", pv.Name, device, actual,
+			identity)
+		d.RuntimeConfig.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeDeviceMismatch, err.Error())
+		return err
+	}
+
+	ctx, cancel := cleanupContext(config)
+	defer cancel()
+	klog.Infof("Formatting device %q of PV file volume %q as %s", device, pv.Name, reformat.FsType)
+	args := append([]string{"-t", reformat.FsType}, reformat.MkfsOptions...)
+	err = d.execScript(ctx, pv.Name, common.LocalFilesystemEnv, mountPath, func(done, total int64) {}, mkfsCommand, append(args, device)...)
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("cleanup of pv %q timed out after %v: %v", pv.Name, config.CleanupTimeout.Duration, err)
+	}
+	if err != nil {
+		return fmt.Errorf("error formatting device %q of pv %q: %v", device, pv.Name, err)
+	}
+
+	if err := d.RuntimeConfig.Mounter.Mount(device, mountPath, reformat.FsType, reformat.MountOptions); err != nil {
+		return fmt.Errorf("error mounting device %q of pv %q at %q: %v", device, pv.Name, mountPath, err)
+	}
+	klog.Infof("Completed reformat of pv %q", pv.Name)
+	return nil
+}
+
+// reformatIdentity returns the stable identity of the device of the PV to reformat: the WWN or serial
+// of the disk with the partition number, or else the UUID of its filesystem, which changes once the
+// device is formatted again.
+func (d *Deleter) reformatIdentity(pv *v1.PersistentVolume, device string) (string, error) {
+	id, err := d.VolUtil.GetBlockDeviceIdentity(device)
+	if err != nil {
+		err = fmt.Errorf("refusing to reformat pv %q: failed to get identity of device %q: %v", pv.Name, device, err)
+		d.RuntimeConfig.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeDeviceUnknown, err.Error())
+		return "", err
+	}
+	identity := ""
+	if id.WWN != "" {
+		identity = "wwn:" + id.WWN
+	} else if id.Serial != "" {
+		identity = "serial:" + id.Serial
+	}
+	switch {
+	case identity != "" && id.Partition != "":
+		identity += ",partition:" + id.Partition
+	case identity == "" && id.FsUUID != "":
+		identity = "fsuuid:" + id.FsUUID
+	case identity == "":
+		err = fmt.Errorf("refusing to reformat pv %q: device %q has no WWN, serial nor filesystem UUID", pv.Name, device)
+		d.RuntimeConfig.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeDeviceUnknown, err.Error())
+		return "", err
+	}
+	return identity, nil
 }
 
 func (d *Deleter) cleanBlockPV(pv *v1.PersistentVolume, blkdevPath string, config common.MountConfig) error {
@@ -280,7 +669,21 @@ func (d *Deleter) cleanBlockPV(pv *v1.PersistentVolume, blkdevPath string, confi
 	klog.Infof("Deleting PV block volume %q device hostpath %q, mountpath %q", pv.Name, pv.Spec.Local.Path,
 		blkdevPath)
 
-	err := d.execScript(pv.Name, blkdevPath, config.BlockCleanerCommand[0], config.BlockCleanerCommand[1:]...)
+	progress := d.cleanupProgressReporter(pv)
+	defer metrics.CleanupProgressRatio.DeleteLabelValues(pv.Name)
+
+	ctx, cancel := cleanupContext(config)
+	defer cancel()
+
+	var err error
+	if cleaner.IsBuiltin(config.BlockCleanerCommand) {
+		err = d.runBuiltinCleaner(ctx, blkdevPath, config.BlockCleanerCommand, progress)
+	} else {
+		err = d.execScript(ctx, pv.Name, common.LocalPVEnv, blkdevPath, progress, config.BlockCleanerCommand[0], config.BlockCleanerCommand[1:]...)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("cleanup of pv %q timed out after %v: %v", pv.Name, config.CleanupTimeout.Duration, err)
+	}
 	if err != nil {
 		klog.Error(err)
 		return err
@@ -290,9 +693,57 @@ func (d *Deleter) cleanBlockPV(pv *v1.PersistentVolume, blkdevPath string, confi
 	return nil
 }
 
-func (d *Deleter) execScript(pvName string, blkdevPath string, exe string, exeArgs ...string) error {
-	cmd := exec.Command(exe, exeArgs...)
-	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", common.LocalPVEnv, blkdevPath))
+// cleanupContext returns the context of a cleanup, which is done after the cleanup timeout of the
+// class if it has one.
+func cleanupContext(config common.MountConfig) (context.Context, context.CancelFunc) {
+	if config.CleanupTimeout.Duration > 0 {
+		return context.WithTimeout(context.Background(), config.CleanupTimeout.Duration)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// cleanupProgressReporter returns the function reporting the cleanup progress of pv in the
+// cleanup progress metric and, at most once per progressUpdatePeriod, in its annotations.
+func (d *Deleter) cleanupProgressReporter(pv *v1.PersistentVolume) cleaner.ProgressFunc {
+	updateAnnotation := cleaner.Throttled(progressUpdatePeriod, func(done, total int64) {
+		d.updateCleanupProgress(pv.Name, done, total)
+	})
+	return func(done, total int64) {
+		metrics.CleanupProgressRatio.WithLabelValues(pv.Name).Set(float64(done) / float64(total))
+		updateAnnotation(done, total)
+	}
+}
+
+func (d *Deleter) updateCleanupProgress(pvName string, done, total int64) {
+	pv, exists := d.Cache.GetPV(pvName)
+	if !exists {
+		return
+	}
+	pv = pv.DeepCopy()
+	if pv.Annotations == nil {
+		pv.Annotations = map[string]string{}
+	}
+	pv.Annotations[common.AnnCleanupProgress] = fmt.Sprintf("%d%% (%d/%d bytes)", done*100/total, done, total)
+	if _, err := d.APIUtil.UpdatePV(pv); err != nil {
+		// The next update will retry.
+		klog.Warningf("Error updating cleanup progress of pv %q: %v", pvName, err)
+	}
+}
+
+func (d *Deleter) runBuiltinCleaner(ctx context.Context, blkdevPath string, command []string, progress cleaner.ProgressFunc) error {
+	opts, err := cleaner.ParseCommand(command)
+	if err != nil {
+		return err
+	}
+	return cleaner.Clean(ctx, blkdevPath, opts, progress)
+}
+
+// execScript runs a cleaner command with the path of the volume in the pathEnv environment variable.
+func (d *Deleter) execScript(ctx context.Context, pvName string, pathEnv string, volumePath string, progress cleaner.ProgressFunc, exe string, exeArgs ...string) error {
+	cmd := exec.CommandContext(ctx, exe, exeArgs...)
+	// Kill the children of the script too when the context is done, as they hold its output open.
+	killProcessGroupOnCancel(cmd)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", pathEnv, volumePath))
 	var wg sync.WaitGroup
 	// Wait for stderr & stdout  go routines
 	wg.Add(2)
@@ -307,6 +758,10 @@ func (d *Deleter) execScript(pvName string, blkdevPath string, exe string, exeAr
 		outScanner := bufio.NewScanner(outReader)
 		for outScanner.Scan() {
 			outstr := outScanner.Text()
+			if done, total, ok := cleaner.ParseProgress(outstr); ok {
+				progress(done, total)
+				continue
+			}
 			klog.Infof("Cleanup pv %q: StdoutBuf - %q", pvName, outstr)
 		}
 	}()
@@ -354,16 +809,16 @@ func (d *Deleter) execScript(pvName string, blkdevPath string, exe string, exeAr
 // To achieve these advantages, the provisioner names the cleaning job with a constant name based on the PV name.
 // If a job completes successfully, then the job is first deleted and then the cleaned PV (to enable its rediscovery).
 // A failed Job is left "as is" (after a few retries to execute) for admins to intervene/debug and resolve. This is the
-// safest thing to do in this scenario as it is even in a non-Job based approach. Please note that for successful jobs,
-// deleting it does delete the logs of the job run. This is probably an acceptable initial implementation as the logs
-// of successful run are not as interesting. Long term, we might want to fetch the logs of the successful Jobs too,
-// before deleting them, but for the initial implementation we will keep things simple and perhaps decide the
-// enhancement based on user feedback.
+// safest thing to do in this scenario as it is even in a non-Job based approach. The job controller reports it with
+// an event on the PV. Once failedCleanupJobTTL has passed, if configured, the job is deleted and counted as a failed
+// cleanup, so that the cleanup is retried with a new job, or quarantined. Please note that for successful jobs,
+// deleting it does delete the logs of the job run, so the tail of these logs is first recorded in the provisioner log
+// and in an event on the PV.
 func (d *Deleter) runJob(pv *v1.PersistentVolume, volMode v1.PersistentVolumeMode, mountPath string, config common.MountConfig) error {
 	if d.JobContainerImage == "" {
 		return fmt.Errorf("cannot run cleanup job without specifying job image name in the environment variable")
 	}
-	job, err := NewCleanupJob(pv, volMode, d.JobContainerImage, d.JobTolerations, d.Node.Name, d.Namespace, mountPath, config)
+	job, err := NewCleanupJob(pv, volMode, d.JobContainerImage, d.JobTolerations, d.JobTemplate, d.Node.Name, d.Namespace, mountPath, config)
 	if err != nil {
 		return err
 	}
@@ -374,6 +829,8 @@ func (d *Deleter) runJob(pv *v1.PersistentVolume, volMode v1.PersistentVolumeMod
 type CleanupStatusTracker struct {
 	ProcTable     ProcTable
 	JobController JobController
+	// DirtyVolumes records the volumes not cleaned up yet, may be nil
+	DirtyVolumes *DirtyVolumes
 }
 
 // InProgress returns true if the cleaning for the specified PV is in progress.
@@ -384,6 +841,15 @@ func (c *CleanupStatusTracker) InProgress(pvName string, isJob bool) bool {
 	return c.ProcTable.IsRunning(pvName)
 }
 
+// Interrupted returns true if the cleaning for the specified PV was interrupted by a provisioner
+// restart, and has not been restarted yet.
+func (c *CleanupStatusTracker) Interrupted(pvName string, isJob bool) bool {
+	if isJob {
+		return false
+	}
+	return c.ProcTable.IsInterrupted(pvName)
+}
+
 // RemoveStatus removes and returns the status and start time of a completed cleaning process.
 // The method returns an error if the process has not yet completed.
 func (c *CleanupStatusTracker) RemoveStatus(pvName string, isJob bool) (CleanupState, *time.Time, error) {
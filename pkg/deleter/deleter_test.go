@@ -17,26 +17,37 @@ limitations under the License.
 package deleter
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/cache"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/metrics"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/util"
 
 	batch_v1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
 	core "k8s.io/client-go/testing"
+	clientcache "k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/mount"
 )
 
 const (
@@ -74,6 +85,14 @@ type testVol struct {
 	VolumeMode        string
 	reclaimPolicy     v1.PersistentVolumeReclaimPolicy
 	deletionTimestamp *meta_v1.Time
+	// Device identity recorded on the PV at discovery time
+	recordedIdentity *util.BlockDeviceIdentity
+	// Identity of the device currently behind the PV path
+	deviceIdentity *util.BlockDeviceIdentity
+	// Entries of the filesystem volume which could not be removed
+	deleteFailures []string
+	// Root of the mount of the filesystem volume, "/" if empty
+	mountRoot string
 }
 
 func TestDeleteVolumes_Basic(t *testing.T) {
@@ -274,6 +293,7 @@ func TestDeleteVolumes_UnknownReclaimPolicy(t *testing.T) {
 }
 
 func TestDeleteVolumes_CleanupFails(t *testing.T) {
+	defer setCleanupBackoff(0)()
 	vols := map[string]*testVol{
 		"pv4": {
 			pvPhase: v1.VolumeReleased,
@@ -339,18 +359,18 @@ func TestDeleteBlock_BasicProcessExec(t *testing.T) {
 	verifyDeletedPVs(t, test)
 }
 
-func TestDeleteBlock_FailedProcess(t *testing.T) {
+func TestDeleteBlock_ProcessProgress(t *testing.T) {
 	vols := map[string]*testVol{
 		"pv4": {
 			pvPhase:    v1.VolumeReleased,
 			VolumeMode: util.FakeEntryBlock,
 		},
 	}
-	// Nothing should be deleted as it was a failed cleanup process
-	expectedDeletedPVs := map[string]string{}
-
+	expectedDeletedPVs := map[string]string{"pv4": ""}
 	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
-	d := testSetupForProcCleaning(t, test, []string{"sh", "-c", "exit 10"})
+	d := testSetupForProcCleaning(t, test, []string{"sh", "-c",
+		"echo \"progress: 25/100\"; echo \"progress: 50/100\"; echo \"progress: 100/100\""})
+
 	err := d.deletePV(test.generatedPVs["pv4"])
 	if err != nil {
 		t.Error(err)
@@ -358,188 +378,1532 @@ func TestDeleteBlock_FailedProcess(t *testing.T) {
 
 	waitForAsyncToComplete(t, d)
 
-	// A few checks to see if its still running.
-	if test.procTable.IsRunningCount == 0 {
-		t.Errorf("Unexpected isRunning count %d", test.procTable.IsRunningCount)
-	}
-	// Must have marked itself as running twice, because when the first attempt failed, it would try again.
-	if test.procTable.MarkRunningCount != 2 {
-		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
+	// The first report and the completion are written right away, the others are throttled.
+	var progress []string
+	for _, action := range test.clientset.Actions() {
+		if update, ok := action.(core.UpdateAction); ok && action.GetResource().Resource == "persistentvolumes" {
+			pv := update.GetObject().(*v1.PersistentVolume)
+			if value, found := pv.Annotations[common.AnnCleanupProgress]; found {
+				progress = append(progress, value)
+			}
+		}
 	}
-	// Must have marked itself has done
-	if test.procTable.MarkDoneCount != 1 {
-		t.Errorf("Unexpected MarkDone count %d", test.procTable.MarkDoneCount)
+	expectedProgress := []string{"25% (25/100 bytes)", "100% (100/100 bytes)"}
+	if !reflect.DeepEqual(progress, expectedProgress) {
+		t.Errorf("Expected cleanup progress updates %v, got %v", expectedProgress, progress)
 	}
 
 	verifyDeletedPVs(t, test)
-
 }
 
-func TestDeleteBlock_DuplicateAttempts(t *testing.T) {
+func TestDeleteFilesystem_CleanerCommand(t *testing.T) {
 	vols := map[string]*testVol{
 		"pv4": {
 			pvPhase:    v1.VolumeReleased,
-			VolumeMode: util.FakeEntryBlock,
+			VolumeMode: util.FakeEntryFile,
 		},
 	}
 	expectedDeletedPVs := map[string]string{"pv4": ""}
 	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+	d := testSetupForProcCleaning(t, test, nil)
+	marker := filepath.Join(t.TempDir(), "cleaned")
+	config := d.DiscoveryMap[testStorageClass]
+	config.FilesystemCleanerCommand = []string{"sh", "-c",
+		"test \"$LOCAL_PV_FILESYSTEM\" = /discoveryPath/test1/entry-pv4 && touch " + marker}
+	d.DiscoveryMap[testStorageClass] = config
 
-	d := testSetupForProcCleaning(t, test, []string{"sh", "-c", "echo \"hello\""})
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
 
-	// Simulate a currently running process by marking it as running in process table
-	test.procTable.MarkRunning("pv4")
+	waitForAsyncToComplete(t, d)
+
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("Expected the filesystem cleaner command to run: %v", err)
+	}
+	verifyDeletedPVs(t, test)
+}
+
+func TestDeleteFilesystem_DeleteFailures(t *testing.T) {
+	defer setCleanupBackoff(0)()
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:        v1.VolumeReleased,
+			VolumeMode:     util.FakeEntryFile,
+			deleteFailures: []string{"/discoveryPath/test1/entry-pv4/busy: error unmounting: device or resource busy"},
+		},
+	}
+	// The volume must not be deleted, and the entries which could not be removed are reported.
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+	d := testSetupForProcCleaning(t, test, nil)
 
 	err := d.deletePV(test.generatedPVs["pv4"])
 	if err != nil {
 		t.Error(err)
 	}
+	waitForAsyncToComplete(t, d)
 
-	// The second execution must have checked to see if something is already running.
-	if test.procTable.IsRunningCount != 1 {
-		t.Errorf("Unexpected isrrunning %d", test.procTable.IsRunningCount)
+	if test.procTable.MarkDoneCount != 1 {
+		t.Errorf("Unexpected MarkDone count %d", test.procTable.MarkDoneCount)
 	}
+	recorderChan := d.RuntimeConfig.Recorder.(*record.FakeRecorder).Events
+	select {
+	case event := <-recorderChan:
+		if !strings.HasPrefix(event, v1.EventTypeWarning+" "+common.EventVolumeFailedDelete) ||
+			!strings.Contains(event, vols["pv4"].deleteFailures[0]) {
+			t.Errorf("Unexpected event %q", event)
+		}
+	default:
+		t.Errorf("Expected a %s event", common.EventVolumeFailedDelete)
+	}
+	verifyDeletedPVs(t, test)
+	verifyPVExists(t, test)
+}
 
-	// The second process should not have attempted to mark itself running.
-	if test.procTable.MarkRunningCount != 1 {
-		t.Errorf("Unexpected MarkRunning %d", test.procTable.MarkRunningCount)
+func TestCleanVolume_OutsideMountDir(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryFile,
+		},
 	}
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+	d := testSetupForProcCleaning(t, test, nil)
 
-	// Nothing should have marked itself as done, since the first run was a fake and second run did not happen
-	if test.procTable.MarkDoneCount != 0 {
-		t.Errorf("Unexpected MarkDone %d", test.procTable.MarkDoneCount)
+	// None of the mount paths are strictly beneath the mount dir.
+	for _, mountPath := range []string{testMountDir + "2/test1/entry-pv4", testMountDir + "/../test1/entry-pv4", testMountDir} {
+		if _, err := d.CleanVolume(test.generatedPVs["pv4"], v1.PersistentVolumeFilesystem, mountPath,
+			d.DiscoveryMap[testStorageClass]); err == nil {
+			t.Errorf("Expected cleaning %q to fail", mountPath)
+		}
+	}
+	if test.procTable.MarkRunningCount != 0 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
 	}
 }
 
-func TestDeleteBlock_Jobs(t *testing.T) {
+func TestCleanVolume_Quarantine(t *testing.T) {
+	defer setCleanupBackoff(0)()
 	vols := map[string]*testVol{
 		"pv4": {
 			pvPhase:    v1.VolumeReleased,
 			VolumeMode: util.FakeEntryBlock,
 		},
 	}
-	expectedDeletedPVs := map[string]string{"pv4": ""}
-	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
-
-	cmd := []string{"sh", "-c", "echo \"hello\""}
-	d := testSetupForJobCleaning(t, test, cmd)
-
-	err := d.deletePV(test.generatedPVs["pv4"])
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+	d := testSetupForProcCleaning(t, test, []string{"sh", "-c", "exit 10"})
+	dirtyVolumes, err := NewDirtyVolumes(t.TempDir())
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	d.CleanupStatus.DirtyVolumes = dirtyVolumes
+	config := d.DiscoveryMap[testStorageClass]
+	config.MaxCleanupAttempts = 2
+	d.DiscoveryMap[testStorageClass] = config
+	pv := test.generatedPVs["pv4"]
+	mountPath, err := common.GetContainerPath(pv, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanVolume := func() {
+		t.Helper()
+		if cleaned, err := d.CleanVolume(pv, v1.PersistentVolumeBlock, mountPath, config); err != nil || cleaned {
+			t.Errorf("Expected volume not to be cleaned, got cleaned %v, err %v", cleaned, err)
+		}
+		for count := 0; count < 30 && d.CleanupStatus.ProcTable.IsRunning("pv4"); count++ {
+			time.Sleep(200 * time.Millisecond)
+		}
 	}
 
-	// The second execution must have checked to see if something is already running.
-	if test.jobControl.IsRunningCount != 1 {
-		t.Errorf("Unexpected isrrunning %d", test.procTable.IsRunningCount)
+	// The first failure is retried, the second one quarantines the volume.
+	cleanVolume()
+	cleanVolume()
+	cleanVolume()
+	if test.procTable.MarkRunningCount != 2 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
+	}
+	if quarantined, err := dirtyVolumes.IsQuarantined(pv.Spec.Local.Path); err != nil || !quarantined {
+		t.Errorf("Expected volume to be quarantined, got quarantined %v, err %v", quarantined, err)
 	}
 
-	jobs := getCreatedJobs(test.clientset)
-	if len(jobs) != 1 {
-		t.Fatalf("Job creation was not invoked correctly %+v", jobs)
+	// A quarantined volume isn't cleaned up again.
+	cleanVolume()
+	if test.procTable.MarkRunningCount != 2 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
 	}
+}
 
-	for k, job := range jobs {
-		nsjob := strings.Split(k, "/")
-		if nsjob[0] != "kubesystem" {
-			t.Fatalf("Invalid namespace in key %s", k)
-		}
-		if nsjob[1] != JobNamePrefix+"pv4" {
-			t.Fatalf("Invalid namespace in key %s", k)
-		}
+func TestDeleteFilesystem_Reformat(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryFile,
+		},
+		"pv5": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryFile,
+		},
+	}
+	// pv5 is not mounted and its device is unknown, so it can't be reformatted.
+	expectedDeletedPVs := map[string]string{"pv4": ""}
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+	d := testSetupForProcCleaning(t, test, nil)
+	dirtyVolumes, err := NewDirtyVolumes(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.CleanupStatus.DirtyVolumes = dirtyVolumes
+	addFakeDevice(test, "sdb", &util.BlockDeviceIdentity{WWN: "0x5000c500a1b2c3d4"})
+	mountPath := "/discoveryPath/test1/entry-pv4"
+	mounter := mount.NewFakeMounter([]mount.MountPoint{{Device: "/dev/sdb", Path: mountPath, Type: "ext4"}})
+	d.RuntimeConfig.Mounter = mounter
+	mkfsArgs := filepath.Join(t.TempDir(), "mkfs-args")
+	defer setMkfsCommand(t, mkfsArgs)()
+	config := d.DiscoveryMap[testStorageClass]
+	config.ReformatOnRelease = &common.ReformatConfig{
+		FsType:       "xfs",
+		MkfsOptions:  []string{"-f"},
+		MountOptions: []string{"noatime"},
+	}
+	d.DiscoveryMap[testStorageClass] = config
 
-		if job.Namespace != nsjob[0] {
-			t.Fatalf("Invalid namespace in job %s", job.Namespace)
+	for _, pvName := range []string{"pv4", "pv5"} {
+		if err := d.deletePV(test.generatedPVs[pvName]); err != nil {
+			t.Error(err)
 		}
+	}
 
-		if job.Name != nsjob[1] {
-			t.Fatalf("Invalid name in job %s", job.Name)
-		}
+	waitForAsyncToComplete(t, d)
 
-		if job.Spec.Template.Spec.Containers[0].Env[0].Name != common.LocalPVEnv {
-			t.Fatalf("Invalid environment variable set in job container %s",
-				job.Spec.Template.Spec.Containers[0].Env[0].Name)
-		}
-		if job.Spec.Template.Spec.Containers[0].Env[0].Value != "/discoveryPath/test1/entry-pv4" {
-			t.Fatalf("Invalid blkdevpath environment value set in job container %s",
-				job.Spec.Template.Spec.Containers[0].Env[0].Value)
-		}
-		if !reflect.DeepEqual(job.Spec.Template.Spec.Containers[0].Command, cmd) {
-			t.Fatalf("Invalid command set in job container - %+v",
-				job.Spec.Template.Spec.Containers[0].Command)
-		}
-		if job.Annotations[DeviceAnnotation] != "/discoveryPath/test1/entry-pv4" {
-			t.Fatalf("Invalid device annotation on job %s", job.Annotations[DeviceAnnotation])
-		}
-		if job.Labels[PVLabel] != "pv4" {
-			t.Fatalf("Invalid PV label on job %s", job.Labels[PVLabel])
-		}
-		if job.Labels[PVUuidLabel] != "" {
-			t.Fatalf("Invalid PV uuid label on job %s", job.Labels[PVUuidLabel])
-		}
+	args, err := os.ReadFile(mkfsArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "-t xfs -f /dev/sdb\n"; string(args) != expected {
+		t.Errorf("Expected mkfs arguments %q, got %q", expected, string(args))
+	}
+	expectedLog := []mount.FakeAction{
+		{Action: mount.FakeActionUnmount, Target: mountPath},
+		{Action: mount.FakeActionMount, Target: mountPath, Source: "/dev/sdb", FSType: "xfs"},
+	}
+	if log := mounter.GetLog(); !reflect.DeepEqual(log, expectedLog) {
+		t.Errorf("Expected mount actions %+v, got %+v", expectedLog, log)
 	}
+	if test.procTable.MarkDoneCount != 2 {
+		t.Errorf("Unexpected MarkDone count %d", test.procTable.MarkDoneCount)
+	}
+	verifyDeletedPVs(t, test)
 }
 
-func TestDeleteBlock_DuplicateAttempts_Jobs(t *testing.T) {
+func TestDeleteFilesystem_ResumeReformat(t *testing.T) {
 	vols := map[string]*testVol{
 		"pv4": {
 			pvPhase:    v1.VolumeReleased,
-			VolumeMode: util.FakeEntryBlock,
+			VolumeMode: util.FakeEntryFile,
 		},
 	}
 	expectedDeletedPVs := map[string]string{"pv4": ""}
 	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+	d := testSetupForProcCleaning(t, test, nil)
+	dirtyVolumes, err := NewDirtyVolumes(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.CleanupStatus.DirtyVolumes = dirtyVolumes
+	// A previous cleanup was interrupted after the volume was unmounted.
+	if err := dirtyVolumes.RecordDevice(test.generatedPVs["pv4"].Spec.Local.Path, "/dev/sdb",
+		"serial:S4EWNX0R123456,partition:1"); err != nil {
+		t.Fatal(err)
+	}
+	addFakeDevice(test, "sdb", &util.BlockDeviceIdentity{Serial: "S4EWNX0R123456", Partition: "1"})
+	mountPath := "/discoveryPath/test1/entry-pv4"
+	mounter := mount.NewFakeMounter(nil)
+	d.RuntimeConfig.Mounter = mounter
+	defer setMkfsCommand(t, filepath.Join(t.TempDir(), "mkfs-args"))()
+	config := d.DiscoveryMap[testStorageClass]
+	config.ReformatOnRelease = &common.ReformatConfig{FsType: "ext4"}
+	d.DiscoveryMap[testStorageClass] = config
+
+	if err := d.deletePV(test.generatedPVs["pv4"]); err != nil {
+		t.Error(err)
+	}
 
-	d := testSetupForJobCleaning(t, test, []string{"sh", "-c", "echo \"hello\""})
+	waitForAsyncToComplete(t, d, "pv4")
 
-	// Simulate a currently running process by marking it as running in process table
-	test.jobControl.MarkRunning("pv4")
+	expectedLog := []mount.FakeAction{
+		{Action: mount.FakeActionMount, Target: mountPath, Source: "/dev/sdb", FSType: "ext4"},
+	}
+	if log := mounter.GetLog(); !reflect.DeepEqual(log, expectedLog) {
+		t.Errorf("Expected mount actions %+v, got %+v", expectedLog, log)
+	}
+	verifyDeletedPVs(t, test)
+}
+
+func TestDeleteFilesystem_ReformatChecks(t *testing.T) {
+	tests := map[string]struct {
+		// mountRoot is the root of the mount of the volume, which is unmounted if empty
+		mountRoot string
+		// recordedIdentity is the identity recorded by an interrupted cleanup
+		recordedIdentity string
+		identity         *util.BlockDeviceIdentity
+		expectedEvent    string
+	}{
+		"bind mounted subdirectory": {
+			mountRoot: "/vol1",
+			identity:  &util.BlockDeviceIdentity{WWN: "0x5000c500a1b2c3d4"},
+		},
+		"unknown identity": {
+			mountRoot:     "/",
+			identity:      &util.BlockDeviceIdentity{},
+			expectedEvent: common.EventVolumeDeviceUnknown,
+		},
+		"renamed device": {
+			recordedIdentity: "wwn:0x5000c500a1b2c3d4",
+			identity:         &util.BlockDeviceIdentity{WWN: "0x5000c500e5f60718"},
+			expectedEvent:    common.EventVolumeDeviceMismatch,
+		},
+		"formatted filesystem": {
+			recordedIdentity: "fsuuid:2f1c5e0a-6d1b-4c8e-9a57-0c1d2e3f4a5b",
+			identity:         &util.BlockDeviceIdentity{FsUUID: "5b1e0c7d-2a4f-4e8b-8c1d-3f4a5b6c7d8e"},
+			expectedEvent:    common.EventVolumeDeviceMismatch,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			vols := map[string]*testVol{
+				"pv4": {
+					pvPhase:    v1.VolumeReleased,
+					VolumeMode: util.FakeEntryFile,
+					mountRoot:  tc.mountRoot,
+				},
+			}
+			test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+			d := testSetupForProcCleaning(t, test, nil)
+			dirtyVolumes, err := NewDirtyVolumes(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.CleanupStatus.DirtyVolumes = dirtyVolumes
+			addFakeDevice(test, "sdb", tc.identity)
+			mountPath := "/discoveryPath/test1/entry-pv4"
+			var mountPoints []mount.MountPoint
+			if tc.mountRoot != "" {
+				mountPoints = append(mountPoints, mount.MountPoint{Device: "/dev/sdb", Path: mountPath, Type: "ext4"})
+			} else if err := dirtyVolumes.RecordDevice(test.generatedPVs["pv4"].Spec.Local.Path, "/dev/sdb",
+				tc.recordedIdentity); err != nil {
+				t.Fatal(err)
+			}
+			mounter := mount.NewFakeMounter(mountPoints)
+			d.RuntimeConfig.Mounter = mounter
+			mkfsArgs := filepath.Join(t.TempDir(), "mkfs-args")
+			defer setMkfsCommand(t, mkfsArgs)()
+			config := d.DiscoveryMap[testStorageClass]
+			config.ReformatOnRelease = &common.ReformatConfig{FsType: "ext4"}
+			d.DiscoveryMap[testStorageClass] = config
+
+			if err := d.reformatFilePV(test.generatedPVs["pv4"], mountPath, config); err == nil {
+				t.Errorf("Expected the reformat to be refused")
+			}
+			if _, err := os.Stat(mkfsArgs); !os.IsNotExist(err) {
+				t.Errorf("Expected mkfs not to run, got %v", err)
+			}
+			if log := mounter.GetLog(); len(log) != 0 {
+				t.Errorf("Expected no mount actions, got %+v", log)
+			}
+			if tc.expectedEvent != "" && !hasEvent(d, tc.expectedEvent) {
+				t.Errorf("Expected a %s event", tc.expectedEvent)
+			}
+		})
+	}
+}
+
+func TestDeleteBlock_FailedProcess(t *testing.T) {
+	defer setCleanupBackoff(0)()
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	// Nothing should be deleted as it was a failed cleanup process
+	expectedDeletedPVs := map[string]string{}
 
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+	d := testSetupForProcCleaning(t, test, []string{"sh", "-c", "exit 10"})
 	err := d.deletePV(test.generatedPVs["pv4"])
 	if err != nil {
 		t.Error(err)
 	}
 
-	// The second execution must have checked to see if something is already running.
-	if test.jobControl.IsRunningCount != 1 {
-		t.Errorf("Unexpected isrrunning %d", test.procTable.IsRunningCount)
-	}
+	waitForAsyncToComplete(t, d)
 
-	jobs := getCreatedJobs(test.clientset)
-	if len(jobs) != 0 {
-		t.Errorf("Unexpected job was created. %+v", jobs)
-		t.Fatalf("No job should have been created when one is already simulated as running.")
+	// A few checks to see if its still running.
+	if test.procTable.IsRunningCount == 0 {
+		t.Errorf("Unexpected isRunning count %d", test.procTable.IsRunningCount)
+	}
+	// Must have marked itself as running twice, because when the first attempt failed, it would try again.
+	if test.procTable.MarkRunningCount != 2 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
+	}
+	// Must have marked itself has done
+	if test.procTable.MarkDoneCount != 1 {
+		t.Errorf("Unexpected MarkDone count %d", test.procTable.MarkDoneCount)
 	}
-}
 
-func testSetupForProcCleaning(t *testing.T, config *testConfig, cleanupCmd []string) *Deleter {
-	return testSetup(t, config, cleanupCmd, false)
-}
+	verifyDeletedPVs(t, test)
 
-func testSetupForJobCleaning(t *testing.T, config *testConfig, cleanupCmd []string) *Deleter {
-	return testSetup(t, config, cleanupCmd, true)
 }
 
-func testSetup(t *testing.T, config *testConfig, cleanupCmd []string, useJobForCleaning bool) *Deleter {
-	config.cache = cache.NewVolumeCache()
-	config.clientset = fake.NewSimpleClientset()
+func TestDeleteBlock_FailedProcessBackoff(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	expectedDeletedPVs := map[string]string{}
 
-	config.clientset.PrependReactor("create", "persistentvolumes", func(action core.Action) (bool, runtime.Object, error) {
-		obj := action.(core.CreateAction).GetObject()
-		pv := obj.(*v1.PersistentVolume)
-		config.cache.AddPV(pv)
-		return false, nil, nil
-	})
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+	d := testSetupForProcCleaning(t, test, []string{"sh", "-c", "exit 10"})
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
 
-	config.clientset.PrependReactor("delete", "persistentvolumes", func(action core.Action) (bool, runtime.Object, error) {
-		if config.apiShouldFail {
-			return true, nil, fmt.Errorf("API failed")
-		}
+	waitForAsyncToComplete(t, d)
 
-		pvName := action.(core.DeleteAction).GetName()
-		_, exists := config.cache.GetPV(pvName)
-		if exists {
-			config.cache.DeletePV(pvName)
+	// Must have marked itself as running once, because the next attempt is delayed by the backoff.
+	if test.procTable.MarkRunningCount != 1 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
+	}
+	if d.cleanupFailures["pv4"] == nil || d.cleanupFailures["pv4"].attempts != 1 {
+		t.Errorf("Expected 1 failed cleanup attempt, got %+v", d.cleanupFailures["pv4"])
+	}
+
+	verifyDeletedPVs(t, test)
+}
+
+func TestDeleteBlock_InterruptedProcess(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	expectedDeletedPVs := map[string]string{"pv4": ""}
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+	d := testSetupForProcCleaning(t, test, []string{"sh", "-c", "echo \"hello\""})
+
+	// Restore a cleanup of pv4 which was running when the provisioner restarted.
+	journal, err := NewCleanupJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.record("pv4", ProcEntry{StartTime: time.Now(), Status: CSRunning}); err != nil {
+		t.Fatal(err)
+	}
+	test.procTable.realTable, err = NewJournaledProcTable(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
+
+	waitForAsyncToComplete(t, d)
+
+	// The cleanup is restarted right away, and not counted as failed.
+	if test.procTable.MarkRunningCount != 1 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
+	}
+	if failure := d.cleanupFailures["pv4"]; failure != nil {
+		t.Errorf("Unexpected failed cleanup attempts %+v", failure)
+	}
+
+	verifyDeletedPVs(t, test)
+}
+
+func TestDeleteVolumes_DirtyVolume(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase: v1.VolumeReleased,
+		},
+	}
+	expectedDeletedPVs := map[string]string{"pv4": ""}
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+	d := testSetupForProcCleaning(t, test, nil)
+	dirtyVolumes, err := NewDirtyVolumes(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.CleanupStatus.DirtyVolumes = dirtyVolumes
+	hostPath := test.generatedPVs["pv4"].Spec.Local.Path
+
+	err = d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
+	if dirty, err := dirtyVolumes.IsDirty(hostPath); err != nil || !dirty {
+		t.Errorf("Expected volume %q to be dirty while it is cleaned up, got dirty %v, err %v", hostPath, dirty, err)
+	}
+
+	waitForAsyncToComplete(t, d, "pv4")
+
+	if dirty, err := dirtyVolumes.IsDirty(hostPath); err != nil || dirty {
+		t.Errorf("Expected volume %q to be clean, got dirty %v, err %v", hostPath, dirty, err)
+	}
+	verifyDeletedPVs(t, test)
+}
+
+func TestDeleteVolumes_DirtyVolumeBackoff(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase: v1.VolumeReleased,
+		},
+	}
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+	d := testSetupForProcCleaning(t, test, nil)
+	dirtyVolumes, err := NewDirtyVolumes(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.CleanupStatus.DirtyVolumes = dirtyVolumes
+	hostPath := test.generatedPVs["pv4"].Spec.Local.Path
+	// The cleanup waits for the backoff of a previous failure.
+	d.cleanupFailures["pv4"] = &cleanupFailure{attempts: 1, retryAfter: time.Now().Add(time.Hour)}
+
+	if err := d.deletePV(test.generatedPVs["pv4"]); err != nil {
+		t.Error(err)
+	}
+	if test.procTable.MarkRunningCount != 0 {
+		t.Errorf("Expected no cleanup to start during the backoff, got %d", test.procTable.MarkRunningCount)
+	}
+	if dirty, err := dirtyVolumes.IsDirty(hostPath); err != nil || !dirty {
+		t.Errorf("Expected released volume %q to be dirty, got dirty %v, err %v", hostPath, dirty, err)
+	}
+}
+
+func TestDeleteBlock_Quarantine(t *testing.T) {
+	defer setCleanupBackoff(0)()
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	expectedDeletedPVs := map[string]string{}
+
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+	d := testSetupForProcCleaning(t, test, []string{"sh", "-c", "exit 10"})
+	config := d.DiscoveryMap[testStorageClass]
+	config.MaxCleanupAttempts = 2
+	d.DiscoveryMap[testStorageClass] = config
+
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
+	// The first run retries the failed cleanup, the second one quarantines the PV.
+	waitForAsyncToComplete(t, d)
+	waitForAsyncToComplete(t, d)
+
+	if test.procTable.MarkRunningCount != 2 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
+	}
+	pv, err := test.clientset.CoreV1().PersistentVolumes().Get(context.TODO(), "pv4", meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Error getting pv: %v", err)
+	}
+	if pv.Annotations[common.AnnCleanupQuarantined] != "cleanup failed 2 times" {
+		t.Errorf("Expected pv to be quarantined, got annotations %v", pv.Annotations)
+	}
+	if !hasEvent(d, common.EventVolumeCleanupQuarantined) {
+		t.Errorf("Expected a %s event", common.EventVolumeCleanupQuarantined)
+	}
+
+	// A quarantined PV isn't cleaned up again.
+	if err := d.deletePV(pv); err != nil {
+		t.Error(err)
+	}
+	if test.procTable.MarkRunningCount != 2 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
+	}
+
+	verifyDeletedPVs(t, test)
+}
+
+func TestDeleteBlock_Quarantine_Jobs(t *testing.T) {
+	defer setCleanupBackoff(0)()
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+	d := testSetupForJobCleaning(t, test, []string{"sh", "-c", "exit 10"})
+	config := d.DiscoveryMap[testStorageClass]
+	config.MaxCleanupAttempts = 2
+	d.DiscoveryMap[testStorageClass] = config
+
+	// The first failed job is replaced by a new one, the second one quarantines the PV.
+	test.jobControl.MarkFailed("pv4")
+	if err := d.deletePV(test.generatedPVs["pv4"]); err != nil {
+		t.Error(err)
+	}
+	verifyCreatedJobs(t, test, "pv4")
+	test.jobControl.MarkFailed("pv4")
+	if err := d.deletePV(test.generatedPVs["pv4"]); err != nil {
+		t.Error(err)
+	}
+
+	pv, err := test.clientset.CoreV1().PersistentVolumes().Get(context.TODO(), "pv4", meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Error getting pv: %v", err)
+	}
+	if pv.Annotations[common.AnnCleanupQuarantined] != "cleanup failed 2 times" {
+		t.Errorf("Expected pv to be quarantined, got annotations %v", pv.Annotations)
+	}
+	if !hasEvent(d, common.EventVolumeCleanupQuarantined) {
+		t.Errorf("Expected a %s event", common.EventVolumeCleanupQuarantined)
+	}
+	verifyDeletedPVs(t, test)
+}
+
+func TestDeleteBlock_Timeout(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	expectedDeletedPVs := map[string]string{}
+
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+	// The child process of the script holds its output open, it must be killed too.
+	d := testSetupForProcCleaning(t, test, []string{"sh", "-c", "sleep 30; echo done"})
+	config := d.DiscoveryMap[testStorageClass]
+	config.CleanupTimeout = meta_v1.Duration{Duration: time.Second}
+	d.DiscoveryMap[testStorageClass] = config
+
+	start := time.Now()
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
+
+	waitForAsyncToComplete(t, d, "pv4")
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Cleanup was not stopped by its timeout, took %v", elapsed)
+	}
+	if d.cleanupFailures["pv4"] == nil || d.cleanupFailures["pv4"].attempts != 1 {
+		t.Errorf("Expected 1 failed cleanup attempt, got %+v", d.cleanupFailures["pv4"])
+	}
+
+	verifyDeletedPVs(t, test)
+}
+
+func setCleanupBackoff(backoff time.Duration) func() {
+	oldInitial, oldMax := initialCleanupBackoff, maxCleanupBackoff
+	initialCleanupBackoff, maxCleanupBackoff = backoff, backoff
+	return func() {
+		initialCleanupBackoff, maxCleanupBackoff = oldInitial, oldMax
+	}
+}
+
+func TestDeleteBlock_DuplicateAttempts(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	expectedDeletedPVs := map[string]string{"pv4": ""}
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+
+	d := testSetupForProcCleaning(t, test, []string{"sh", "-c", "echo \"hello\""})
+
+	// Simulate a currently running process by marking it as running in process table
+	test.procTable.MarkRunning("pv4")
+
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
+
+	// The second execution must have checked to see if something is already running.
+	if test.procTable.IsRunningCount != 1 {
+		t.Errorf("Unexpected isrrunning %d", test.procTable.IsRunningCount)
+	}
+
+	// The second process should not have attempted to mark itself running.
+	if test.procTable.MarkRunningCount != 1 {
+		t.Errorf("Unexpected MarkRunning %d", test.procTable.MarkRunningCount)
+	}
+
+	// Nothing should have marked itself as done, since the first run was a fake and second run did not happen
+	if test.procTable.MarkDoneCount != 0 {
+		t.Errorf("Unexpected MarkDone %d", test.procTable.MarkDoneCount)
+	}
+}
+
+func TestDeleteBlock_Jobs(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	expectedDeletedPVs := map[string]string{"pv4": ""}
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+
+	cmd := []string{"sh", "-c", "echo \"hello\""}
+	d := testSetupForJobCleaning(t, test, cmd)
+
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
+
+	// The second execution must have checked to see if something is already running.
+	if test.jobControl.IsRunningCount != 1 {
+		t.Errorf("Unexpected isrrunning %d", test.procTable.IsRunningCount)
+	}
+
+	jobs := getCreatedJobs(test.clientset)
+	if len(jobs) != 1 {
+		t.Fatalf("Job creation was not invoked correctly %+v", jobs)
+	}
+
+	for k, job := range jobs {
+		nsjob := strings.Split(k, "/")
+		if nsjob[0] != "kubesystem" {
+			t.Fatalf("Invalid namespace in key %s", k)
+		}
+		if nsjob[1] != JobNamePrefix+"pv4" {
+			t.Fatalf("Invalid namespace in key %s", k)
+		}
+
+		if job.Namespace != nsjob[0] {
+			t.Fatalf("Invalid namespace in job %s", job.Namespace)
+		}
+
+		if job.Name != nsjob[1] {
+			t.Fatalf("Invalid name in job %s", job.Name)
+		}
+
+		if job.Spec.Template.Spec.Containers[0].Env[0].Name != common.LocalPVEnv {
+			t.Fatalf("Invalid environment variable set in job container %s",
+				job.Spec.Template.Spec.Containers[0].Env[0].Name)
+		}
+		if job.Spec.Template.Spec.Containers[0].Env[0].Value != "/discoveryPath/test1/entry-pv4" {
+			t.Fatalf("Invalid blkdevpath environment value set in job container %s",
+				job.Spec.Template.Spec.Containers[0].Env[0].Value)
+		}
+		if !reflect.DeepEqual(job.Spec.Template.Spec.Containers[0].Command, cmd) {
+			t.Fatalf("Invalid command set in job container - %+v",
+				job.Spec.Template.Spec.Containers[0].Command)
+		}
+		if job.Annotations[DeviceAnnotation] != "/discoveryPath/test1/entry-pv4" {
+			t.Fatalf("Invalid device annotation on job %s", job.Annotations[DeviceAnnotation])
+		}
+		if job.Labels[PVLabel] != "pv4" {
+			t.Fatalf("Invalid PV label on job %s", job.Labels[PVLabel])
+		}
+		if job.Labels[PVUuidLabel] != "" {
+			t.Fatalf("Invalid PV uuid label on job %s", job.Labels[PVUuidLabel])
+		}
+	}
+}
+
+func TestDeleteFilesystem_Jobs(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryFile,
+		},
+	}
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+	d := testSetupForJobCleaning(t, test, nil)
+	d.UseJobForCleaning = false
+	d.UseJobForFilesystemCleaning = true
+
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
+	if test.procTable.MarkRunningCount != 0 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
+	}
+
+	job, ok := getCreatedJobs(test.clientset)["kubesystem/"+JobNamePrefix+"pv4"]
+	if !ok {
+		t.Fatalf("Expected a cleanup job for pv4")
+	}
+	container := job.Spec.Template.Spec.Containers[0]
+	if !reflect.DeepEqual(container.Command, []string{"/scripts/fsclean.sh"}) {
+		t.Errorf("Invalid command set in job container - %+v", container.Command)
+	}
+	expectedEnv := []v1.EnvVar{{Name: common.LocalFilesystemEnv, Value: "/discoveryPath/test1/entry-pv4"}}
+	if !reflect.DeepEqual(container.Env, expectedEnv) {
+		t.Errorf("Expected environment %+v, got %+v", expectedEnv, container.Env)
+	}
+	verifyDeletedPVs(t, test)
+}
+
+func TestDeleteBlock_ClassDisablesJobs(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	expectedDeletedPVs := map[string]string{"pv4": ""}
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+	d := testSetupForJobCleaning(t, test, []string{"sh", "-c", "echo \"hello\""})
+	useJob := false
+	config := d.DiscoveryMap[testStorageClass]
+	config.UseJobForCleaning = &useJob
+	d.DiscoveryMap[testStorageClass] = config
+
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
+	waitForAsyncToComplete(t, d, "pv4")
+
+	if jobs := getCreatedJobs(test.clientset); len(jobs) != 0 {
+		t.Errorf("Unexpected cleanup jobs %+v", jobs)
+	}
+	if test.procTable.MarkRunningCount != 1 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
+	}
+	verifyDeletedPVs(t, test)
+}
+
+func TestDeleteBlock_BuiltinCleanerJobs(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	expectedDeletedPVs := map[string]string{"pv4": ""}
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+
+	d := testSetupForJobCleaning(t, test, []string{"builtin:zeroout", "--bytes-per-second=100Mi"})
+
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
+
+	jobs := getCreatedJobs(test.clientset)
+	if len(jobs) != 1 {
+		t.Fatalf("Job creation was not invoked correctly %+v", jobs)
+	}
+	expectedCmd := []string{common.ProvisionerBinaryPath, "clean-block", "builtin:zeroout", "--bytes-per-second=100Mi"}
+	for _, job := range jobs {
+		if !reflect.DeepEqual(job.Spec.Template.Spec.Containers[0].Command, expectedCmd) {
+			t.Fatalf("Invalid command set in job container - %+v",
+				job.Spec.Template.Spec.Containers[0].Command)
+		}
+	}
+}
+
+func TestDeletePVs_MaxConcurrentCleanups(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+		"pv5": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+		"pv6": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+	d := testSetupForJobCleaning(t, test, []string{"/scripts/shred.sh"})
+	d.MaxConcurrentCleanups = 2
+	d.CleanupQueueOrder = common.CleanupQueueOrderSmallestFirst
+	for pvName, capacity := range map[string]string{"pv4": "3Gi", "pv5": "1Gi", "pv6": "2Gi"} {
+		pv := test.generatedPVs[pvName].DeepCopy()
+		pv.Spec.Capacity = v1.ResourceList{v1.ResourceStorage: resource.MustParse(capacity)}
+		test.cache.UpdatePV(pv)
+	}
+
+	// The two smallest volumes are cleaned up first.
+	d.DeletePVs()
+	verifyCreatedJobs(t, test, "pv5", "pv6")
+	if depth := testutil.ToFloat64(metrics.CleanupQueueDepth); depth != 1 {
+		t.Errorf("Expected a cleanup queue depth of 1, got %v", depth)
+	}
+
+	test.jobControl.MarkRunning("pv5")
+	test.jobControl.MarkRunning("pv6")
+	d.DeletePVs()
+	verifyCreatedJobs(t, test)
+
+	// pv4 is cleaned up once the cleanup of pv5 completes.
+	test.jobControl.MarkSucceeded("pv5")
+	d.DeletePVs()
+	verifyCreatedJobs(t, test, "pv4")
+	if depth := testutil.ToFloat64(metrics.CleanupQueueDepth); depth != 0 {
+		t.Errorf("Expected an empty cleanup queue, got %v", depth)
+	}
+}
+
+func TestDeletePVs_ClassMaxConcurrentCleanups(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+		"pv5": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+	d := testSetupForJobCleaning(t, test, []string{"/scripts/shred.sh"})
+	config := d.DiscoveryMap[testStorageClass]
+	config.MaxConcurrentCleanups = 1
+	d.DiscoveryMap[testStorageClass] = config
+	// pv5 was released first.
+	d.queuedSince["pv5"] = time.Now().Add(-time.Minute)
+
+	d.DeletePVs()
+	verifyCreatedJobs(t, test, "pv5")
+
+	test.jobControl.MarkRunning("pv5")
+	d.DeletePVs()
+	verifyCreatedJobs(t, test)
+	if depth := testutil.ToFloat64(metrics.CleanupQueueDepth); depth != 1 {
+		t.Errorf("Expected a cleanup queue depth of 1, got %v", depth)
+	}
+}
+
+func TestDeletePVs_MaxConcurrentCleanupsCountsUnreleasedPVs(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+	d := testSetupForJobCleaning(t, test, []string{"/scripts/shred.sh"})
+	d.MaxConcurrentCleanups = 1
+	// The cleanup of a volume whose PV has already been deleted is still running.
+	test.jobControl.MarkRunning("pv-deleted")
+
+	d.DeletePVs()
+	verifyCreatedJobs(t, test)
+	if depth := testutil.ToFloat64(metrics.CleanupQueueDepth); depth != 1 {
+		t.Errorf("Expected a cleanup queue depth of 1, got %v", depth)
+	}
+
+	test.jobControl.MarkSucceeded("pv-deleted")
+	test.jobControl.RemoveJob("pv-deleted")
+	d.DeletePVs()
+	verifyCreatedJobs(t, test, "pv4")
+}
+
+func TestCleanVolume_MaxConcurrentCleanups(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeBound,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+	d := testSetupForJobCleaning(t, test, []string{"/scripts/shred.sh"})
+	d.MaxConcurrentCleanups = 1
+	config := d.DiscoveryMap[testStorageClass]
+	pv := test.generatedPVs["pv4"]
+	mountPath, err := common.GetContainerPath(pv, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.jobControl.MarkRunning("pv-other")
+
+	// The cleanup of the dirty volume waits in the queue for the running cleanup.
+	if _, err := d.CleanVolume(pv, v1.PersistentVolumeBlock, mountPath, config); err != nil {
+		t.Fatal(err)
+	}
+	d.DeletePVs()
+	verifyCreatedJobs(t, test)
+	if depth := testutil.ToFloat64(metrics.CleanupQueueDepth); depth != 1 {
+		t.Errorf("Expected a cleanup queue depth of 1, got %v", depth)
+	}
+
+	test.jobControl.MarkSucceeded("pv-other")
+	test.jobControl.RemoveJob("pv-other")
+	if _, err := d.CleanVolume(pv, v1.PersistentVolumeBlock, mountPath, config); err != nil {
+		t.Fatal(err)
+	}
+	d.DeletePVs()
+	verifyCreatedJobs(t, test, "pv4")
+}
+
+// addFakeDevice makes the fake volume util know the device /dev/<name> with the given identity.
+func addFakeDevice(config *testConfig, name string, identity *util.BlockDeviceIdentity) {
+	config.volUtil.AddNewDirEntries("/dev", map[string][]*util.FakeDirEntry{
+		"": {{Name: name, VolumeType: util.FakeEntryBlock, Identity: identity}},
+	})
+}
+
+// verifyCreatedJobs checks that the cleanup jobs of the given PVs have been created since the last call.
+func verifyCreatedJobs(t *testing.T, config *testConfig, pvNames ...string) {
+	t.Helper()
+	jobs := getCreatedJobs(config.clientset)
+	config.clientset.ClearActions()
+	expected := map[string]bool{}
+	for _, pvName := range pvNames {
+		expected["kubesystem/"+JobNamePrefix+pvName] = true
+	}
+	created := map[string]bool{}
+	for name := range jobs {
+		created[name] = true
+	}
+	if !reflect.DeepEqual(created, expected) {
+		t.Errorf("Expected created jobs %v, got %v", expected, created)
+	}
+}
+
+func TestNewCleanupJob_CleanupLimits(t *testing.T) {
+	pv := &v1.PersistentVolume{ObjectMeta: meta_v1.ObjectMeta{Name: "pv4"}}
+	config := common.MountConfig{
+		HostDir:             testHostDir,
+		MountDir:            testMountDir,
+		BlockCleanerCommand: []string{"/scripts/shred.sh"},
+		CleanupTimeout:      meta_v1.Duration{Duration: time.Hour},
+		MaxCleanupAttempts:  3,
+	}
+	backoffLimit := int32(10)
+	// The cleanup limits of the class take precedence over the job template.
+	template := &common.JobTemplate{BackoffLimit: &backoffLimit}
+	job, err := NewCleanupJob(pv, v1.PersistentVolumeBlock, "busybox/busybox", nil, template, testNodeName, "kubesystem",
+		"/discoveryPath/test1/entry-pv4", config)
+	if err != nil {
+		t.Fatalf("Error creating job: %v", err)
+	}
+	if job.Spec.ActiveDeadlineSeconds == nil || *job.Spec.ActiveDeadlineSeconds != 3600 {
+		t.Errorf("Expected an active deadline of 3600s, got %v", job.Spec.ActiveDeadlineSeconds)
+	}
+	// Each job is a single attempt, the failed jobs are retried by the deleter.
+	if job.Spec.BackoffLimit == nil || *job.Spec.BackoffLimit != 0 {
+		t.Errorf("Expected a backoff limit of 0, got %v", job.Spec.BackoffLimit)
+	}
+	if job.Annotations[MaxCleanupAttemptsAnnotation] != "3" {
+		t.Errorf("Expected %s annotation 3, got %q", MaxCleanupAttemptsAnnotation, job.Annotations[MaxCleanupAttemptsAnnotation])
+	}
+}
+
+func TestNewCleanupJob_SubSecondTimeout(t *testing.T) {
+	pv := &v1.PersistentVolume{ObjectMeta: meta_v1.ObjectMeta{Name: "pv4"}}
+	config := common.MountConfig{
+		HostDir:             testHostDir,
+		MountDir:            testMountDir,
+		BlockCleanerCommand: []string{"/scripts/shred.sh"},
+		CleanupTimeout:      meta_v1.Duration{Duration: 1500 * time.Millisecond},
+	}
+	job, err := NewCleanupJob(pv, v1.PersistentVolumeBlock, "busybox/busybox", nil, nil, testNodeName, "kubesystem",
+		"/discoveryPath/test1/entry-pv4", config)
+	if err != nil {
+		t.Fatalf("Error creating job: %v", err)
+	}
+	if job.Spec.ActiveDeadlineSeconds == nil || *job.Spec.ActiveDeadlineSeconds != 2 {
+		t.Errorf("Expected an active deadline of 2s, got %v", job.Spec.ActiveDeadlineSeconds)
+	}
+}
+
+func TestNewCleanupJob_FilesystemCleanerCommand(t *testing.T) {
+	pv := &v1.PersistentVolume{ObjectMeta: meta_v1.ObjectMeta{Name: "pv4"}}
+	config := common.MountConfig{
+		HostDir:                  testHostDir,
+		MountDir:                 testMountDir,
+		FilesystemCleanerCommand: []string{"/scripts/xfs_clean.sh", "--reset-quota"},
+	}
+	job, err := NewCleanupJob(pv, v1.PersistentVolumeFilesystem, "busybox/busybox", nil, nil, testNodeName, "kubesystem",
+		"/discoveryPath/test1/entry-pv4", config)
+	if err != nil {
+		t.Fatalf("Error creating job: %v", err)
+	}
+	container := job.Spec.Template.Spec.Containers[0]
+	if !reflect.DeepEqual(container.Command, config.FilesystemCleanerCommand) {
+		t.Errorf("Expected command %v, got %v", config.FilesystemCleanerCommand, container.Command)
+	}
+	expectedEnv := []v1.EnvVar{{Name: common.LocalFilesystemEnv, Value: "/discoveryPath/test1/entry-pv4"}}
+	if !reflect.DeepEqual(container.Env, expectedEnv) {
+		t.Errorf("Expected environment %+v, got %+v", expectedEnv, container.Env)
+	}
+}
+
+func TestNewCleanupJob_JobTemplate(t *testing.T) {
+	pv := &v1.PersistentVolume{ObjectMeta: meta_v1.ObjectMeta{Name: "pv4"}}
+	backoffLimit := int32(4)
+	nonRoot := true
+	template := &common.JobTemplate{
+		Labels:             map[string]string{"team": "storage", PVLabel: "overridden"},
+		Annotations:        map[string]string{"sidecar.istio.io/inject": "false"},
+		PriorityClassName:  "system-node-critical",
+		ServiceAccountName: "local-storage-cleaner",
+		Resources: &v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+		},
+		BackoffLimit: &backoffLimit,
+	}
+	config := common.MountConfig{
+		HostDir:             testHostDir,
+		MountDir:            testMountDir,
+		BlockCleanerCommand: []string{"/scripts/shred.sh"},
+		JobTemplate: &common.JobTemplate{
+			Labels:             map[string]string{"class": "fast"},
+			PodSecurityContext: &v1.PodSecurityContext{RunAsNonRoot: &nonRoot},
+			ServiceAccountName: "fast-disks-cleaner",
+		},
+	}
+	job, err := NewCleanupJob(pv, v1.PersistentVolumeBlock, "busybox/busybox", nil, template, testNodeName, "kubesystem",
+		"/discoveryPath/test1/entry-pv4", config)
+	if err != nil {
+		t.Fatalf("Error creating job: %v", err)
+	}
+
+	expectedLabels := map[string]string{
+		common.NodeNameLabel: testNodeName,
+		PVLabel:              "pv4",
+		PVUuidLabel:          "",
+		"team":               "storage",
+		"class":              "fast",
+	}
+	if !reflect.DeepEqual(job.Labels, expectedLabels) {
+		t.Errorf("Expected job labels %v, got %v", expectedLabels, job.Labels)
+	}
+	if job.Annotations["sidecar.istio.io/inject"] != "false" || job.Spec.Template.Annotations["sidecar.istio.io/inject"] != "false" {
+		t.Errorf("Expected template annotations on the job and its pod, got %v and %v", job.Annotations, job.Spec.Template.Annotations)
+	}
+	podSpec := job.Spec.Template.Spec
+	if podSpec.PriorityClassName != "system-node-critical" {
+		t.Errorf("Expected priority class %q, got %q", "system-node-critical", podSpec.PriorityClassName)
+	}
+	if podSpec.ServiceAccountName != "fast-disks-cleaner" {
+		t.Errorf("Expected service account %q, got %q", "fast-disks-cleaner", podSpec.ServiceAccountName)
+	}
+	if podSpec.SecurityContext == nil || podSpec.SecurityContext.RunAsNonRoot == nil || !*podSpec.SecurityContext.RunAsNonRoot {
+		t.Errorf("Expected pod security context %v, got %v", config.JobTemplate.PodSecurityContext, podSpec.SecurityContext)
+	}
+	container := podSpec.Containers[0]
+	if !reflect.DeepEqual(container.Resources, *template.Resources) {
+		t.Errorf("Expected resources %v, got %v", *template.Resources, container.Resources)
+	}
+	// The container stays privileged unless the template replaces its security context.
+	if container.SecurityContext == nil || container.SecurityContext.Privileged == nil || !*container.SecurityContext.Privileged {
+		t.Errorf("Expected a privileged container, got %v", container.SecurityContext)
+	}
+	if job.Spec.BackoffLimit == nil || *job.Spec.BackoffLimit != 4 {
+		t.Errorf("Expected a backoff limit of 4, got %v", job.Spec.BackoffLimit)
+	}
+	if job.Spec.ActiveDeadlineSeconds != nil {
+		t.Errorf("Expected no active deadline, got %v", *job.Spec.ActiveDeadlineSeconds)
+	}
+}
+
+func TestRemoveJob_CollectsLogs(t *testing.T) {
+	job := &batch_v1.Job{
+		ObjectMeta: meta_v1.ObjectMeta{Name: JobNamePrefix + "pv4", Namespace: "kubesystem"},
+		Spec: batch_v1.JobSpec{
+			Selector: &meta_v1.LabelSelector{MatchLabels: map[string]string{"controller-uid": "1234"}},
+		},
+		Status: batch_v1.JobStatus{Succeeded: 1},
+	}
+	pods := []runtime.Object{
+		&v1.Pod{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "cleanup-pv4-failed", Namespace: "kubesystem",
+				Labels: map[string]string{"controller-uid": "1234"}},
+			Status: v1.PodStatus{Phase: v1.PodFailed},
+		},
+		&v1.Pod{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "cleanup-pv4-succeeded", Namespace: "kubesystem",
+				Labels: map[string]string{"controller-uid": "1234"}},
+			Status: v1.PodStatus{Phase: v1.PodSucceeded},
+		},
+	}
+	client := fake.NewSimpleClientset(append(pods, job)...)
+	recorder := record.NewFakeRecorder(10)
+	indexer := clientcache.NewIndexer(clientcache.MetaNamespaceKeyFunc, clientcache.Indexers{clientcache.NamespaceIndex: clientcache.MetaNamespaceIndexFunc})
+	if err := indexer.Add(job); err != nil {
+		t.Fatal(err)
+	}
+	c := &jobController{
+		RuntimeConfig: &common.RuntimeConfig{
+			Client:   client,
+			APIUtil:  util.NewAPIUtil(client),
+			Recorder: recorder,
+		},
+		namespace: "kubesystem",
+		jobLister: batchlisters.NewJobLister(indexer),
+	}
+
+	state, _, err := c.RemoveJob("pv4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != CSSucceeded {
+		t.Errorf("Expected state %v, got %v", CSSucceeded, state)
+	}
+
+	var logRequests []string
+	for _, action := range client.Actions() {
+		if action.GetSubresource() == "log" {
+			logRequests = append(logRequests, action.(core.GenericAction).GetValue().(*v1.PodLogOptions).Container)
+		}
+	}
+	if !reflect.DeepEqual(logRequests, []string{JobContainerName}) {
+		t.Errorf("Expected the logs of container %q to be fetched once, got %v", JobContainerName, logRequests)
+	}
+	select {
+	case event := <-recorder.Events:
+		// The fake clientset returns "fake logs" as the logs of any pod.
+		if !strings.Contains(event, common.EventVolumeCleanupLogs) || !strings.Contains(event, "fake logs") {
+			t.Errorf("Unexpected event %q", event)
+		}
+	default:
+		t.Errorf("Expected an event with the logs of the cleanup job")
+	}
+	if _, err := client.BatchV1().Jobs("kubesystem").Get(context.TODO(), job.Name, meta_v1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("Expected job %s to be deleted, got %v", job.Name, err)
+	}
+}
+
+func TestProcessItem_FailedJobs(t *testing.T) {
+	failedJob := func(name string, failedAt time.Time) *batch_v1.Job {
+		return &batch_v1.Job{
+			ObjectMeta: meta_v1.ObjectMeta{Name: JobNamePrefix + name, Namespace: "kubesystem",
+				UID: types.UID(name), Labels: map[string]string{PVLabel: name}},
+			Status: batch_v1.JobStatus{
+				Failed: 3,
+				Conditions: []batch_v1.JobCondition{{
+					Type:               batch_v1.JobFailed,
+					Status:             v1.ConditionTrue,
+					Reason:             "BackoffLimitExceeded",
+					Message:            "Job has reached the specified backoff limit",
+					LastTransitionTime: meta_v1.NewTime(failedAt),
+				}},
+			},
+		}
+	}
+	jobs := []*batch_v1.Job{
+		failedJob("pv1", time.Now().Add(-2*time.Hour)),
+		failedJob("pv2", time.Now().Add(-time.Minute)),
+		{
+			ObjectMeta: meta_v1.ObjectMeta{Name: JobNamePrefix + "pv3", Namespace: "kubesystem",
+				Labels: map[string]string{PVLabel: "pv3"}},
+		},
+	}
+	client := fake.NewSimpleClientset()
+	indexer := clientcache.NewIndexer(clientcache.MetaNamespaceKeyFunc, clientcache.Indexers{clientcache.NamespaceIndex: clientcache.MetaNamespaceIndexFunc})
+	for _, job := range jobs {
+		if _, err := client.BatchV1().Jobs("kubesystem").Create(context.TODO(), job, meta_v1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := indexer.Add(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorder := record.NewFakeRecorder(10)
+	c := &jobController{
+		RuntimeConfig: &common.RuntimeConfig{
+			UserConfig: &common.UserConfig{FailedCleanupJobTTL: meta_v1.Duration{Duration: time.Hour}},
+			Client:     client,
+			APIUtil:    util.NewAPIUtil(client),
+			Recorder:   recorder,
+		},
+		namespace:        "kubesystem",
+		queue:            workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		jobLister:        batchlisters.NewJobLister(indexer),
+		reportedFailures: map[string]types.UID{},
+	}
+	defer c.queue.ShutDown()
+
+	// Process every job twice, as on updates and resyncs.
+	for i := 0; i < 2; i++ {
+		for _, job := range jobs {
+			if err := c.processItem("kubesystem/" + job.Name); err != nil {
+				t.Errorf("Error processing job %s: %v", job.Name, err)
+			}
+		}
+	}
+
+	// Each failure is reported once, and the failed jobs are left to the deleter.
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	expectedReasons := []string{common.EventVolumeCleanupJobFailed, common.EventVolumeCleanupJobFailed}
+	if len(events) != len(expectedReasons) {
+		t.Fatalf("Expected %d events, got %q", len(expectedReasons), events)
+	}
+	for i, reason := range expectedReasons {
+		if !strings.Contains(events[i], reason) {
+			t.Errorf("Expected event %q to have reason %s", events[i], reason)
+		}
+	}
+	remaining, err := client.BatchV1().Jobs("kubesystem").List(context.TODO(), meta_v1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining.Items) != len(jobs) {
+		t.Errorf("Expected %d remaining jobs, got %d", len(jobs), len(remaining.Items))
+	}
+	if failed := testutil.ToFloat64(metrics.CleanupJobsFailed); failed != 2 {
+		t.Errorf("Expected 2 failed jobs, got %v", failed)
+	}
+
+	// The job failed for longer than the TTL is removed as a failed cleanup, the other one is kept.
+	if c.IsCleaningJobRunning("pv1") {
+		t.Errorf("Expected the expired failed job of pv1 not to be running")
+	}
+	state, _, err := c.RemoveJob("pv1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != CSFailed {
+		t.Errorf("Expected state %v, got %v", CSFailed, state)
+	}
+	if _, err := client.BatchV1().Jobs("kubesystem").Get(context.TODO(), JobNamePrefix+"pv1", meta_v1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("Expected job %s to be deleted, got %v", JobNamePrefix+"pv1", err)
+	}
+	if !c.IsCleaningJobRunning("pv2") {
+		t.Errorf("Expected the failed job of pv2 to be kept until it expires")
+	}
+	if _, _, err := c.RemoveJob("pv2"); err == nil {
+		t.Errorf("Expected an error removing the failed job of pv2 before it expires")
+	}
+	events = nil
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	if len(events) != 1 || !strings.Contains(events[0], common.EventVolumeCleanupJobExpired) {
+		t.Errorf("Expected a %s event, got %q", common.EventVolumeCleanupJobExpired, events)
+	}
+}
+
+func TestFailedJobExpired(t *testing.T) {
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		failedAt    time.Time
+		annotations map[string]string
+		expected    bool
+	}{
+		{name: "kept without TTL", failedAt: time.Now().Add(-24 * time.Hour), expected: false},
+		{name: "bounded attempts without TTL", failedAt: time.Now(),
+			annotations: map[string]string{MaxCleanupAttemptsAnnotation: "3"}, expected: true},
+		{name: "within TTL", ttl: time.Hour, failedAt: time.Now().Add(-time.Minute),
+			annotations: map[string]string{MaxCleanupAttemptsAnnotation: "3"}, expected: false},
+		{name: "after TTL", ttl: time.Hour, failedAt: time.Now().Add(-2 * time.Hour), expected: true},
+	}
+	for _, test := range tests {
+		c := &jobController{RuntimeConfig: &common.RuntimeConfig{
+			UserConfig: &common.UserConfig{FailedCleanupJobTTL: meta_v1.Duration{Duration: test.ttl}},
+		}}
+		job := &batch_v1.Job{ObjectMeta: meta_v1.ObjectMeta{Annotations: test.annotations}}
+		failure := &batch_v1.JobCondition{LastTransitionTime: meta_v1.NewTime(test.failedAt)}
+		if expired := c.failedJobExpired(job, failure); expired != test.expected {
+			t.Errorf("%s: expected expired %v, got %v", test.name, test.expected, expired)
+		}
+	}
+}
+
+func TestDeleteBlock_DuplicateAttempts_Jobs(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:    v1.VolumeReleased,
+			VolumeMode: util.FakeEntryBlock,
+		},
+	}
+	expectedDeletedPVs := map[string]string{"pv4": ""}
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+
+	d := testSetupForJobCleaning(t, test, []string{"sh", "-c", "echo \"hello\""})
+
+	// Simulate a currently running process by marking it as running in process table
+	test.jobControl.MarkRunning("pv4")
+
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
+
+	// The second execution must have checked to see if something is already running.
+	if test.jobControl.IsRunningCount != 1 {
+		t.Errorf("Unexpected isrrunning %d", test.procTable.IsRunningCount)
+	}
+
+	jobs := getCreatedJobs(test.clientset)
+	if len(jobs) != 0 {
+		t.Errorf("Unexpected job was created. %+v", jobs)
+		t.Fatalf("No job should have been created when one is already simulated as running.")
+	}
+}
+
+func TestDeleteBlock_DeviceIdentityMatches(t *testing.T) {
+	identity := &util.BlockDeviceIdentity{WWN: "0x5000c500a1b2c3d4", Serial: "ZA1234"}
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:          v1.VolumeReleased,
+			VolumeMode:       util.FakeEntryBlock,
+			recordedIdentity: identity,
+			deviceIdentity:   identity,
+		},
+	}
+	expectedDeletedPVs := map[string]string{"pv4": ""}
+	test := &testConfig{vols: vols, expectedDeletedPVs: expectedDeletedPVs}
+	d := testSetupForProcCleaning(t, test, []string{"sh", "-c", "echo \"hello\""})
+
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err != nil {
+		t.Error(err)
+	}
+	waitForAsyncToComplete(t, d)
+
+	if test.procTable.MarkRunningCount != 1 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
+	}
+	verifyDeletedPVs(t, test)
+}
+
+func TestDeleteBlock_DeviceIdentityPartUUIDUnavailable(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:          v1.VolumeReleased,
+			VolumeMode:       util.FakeEntryBlock,
+			recordedIdentity: &util.BlockDeviceIdentity{WWN: "naa.5000c500a1b2c3d4", PartUUID: "8f3d2c1a-0001"},
+			// The udev database can't be read, so the partition UUID is unknown
+			deviceIdentity: &util.BlockDeviceIdentity{WWN: "naa.5000c500a1b2c3d4"},
+		},
+	}
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{"pv4": ""}}
+	d := testSetupForProcCleaning(t, test, []string{"sh", "-c", "echo \"hello\""})
+
+	if err := d.deletePV(test.generatedPVs["pv4"]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForAsyncToComplete(t, d)
+
+	if test.procTable.MarkRunningCount != 1 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
+	}
+}
+
+func TestDeleteBlock_DeviceIdentityMismatch(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:          v1.VolumeReleased,
+			VolumeMode:       util.FakeEntryBlock,
+			recordedIdentity: &util.BlockDeviceIdentity{WWN: "0x5000c500a1b2c3d4", Serial: "ZA1234"},
+			deviceIdentity:   &util.BlockDeviceIdentity{WWN: "0x5000c500ffffffff", Serial: "ZB9876"},
+		},
+	}
+	// The volume must not be cleaned nor deleted, since the device behind its path has changed.
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+	d := testSetupForProcCleaning(t, test, []string{"sh", "-c", "echo \"hello\""})
+
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err == nil {
+		t.Errorf("Expected error when device identity does not match")
+	}
+	waitForAsyncToComplete(t, d)
+
+	if test.procTable.MarkRunningCount != 0 {
+		t.Errorf("Unexpected MarkRunning count %d", test.procTable.MarkRunningCount)
+	}
+	recorderChan := d.RuntimeConfig.Recorder.(*record.FakeRecorder).Events
+	select {
+	case event := <-recorderChan:
+		if !strings.HasPrefix(event, v1.EventTypeWarning+" "+common.EventVolumeDeviceMismatch) {
+			t.Errorf("Unexpected event %q", event)
+		}
+	default:
+		t.Errorf("Expected a %s event", common.EventVolumeDeviceMismatch)
+	}
+	verifyDeletedPVs(t, test)
+	verifyPVExists(t, test)
+}
+
+func TestDeleteBlock_DeviceIdentityMismatch_Jobs(t *testing.T) {
+	vols := map[string]*testVol{
+		"pv4": {
+			pvPhase:          v1.VolumeReleased,
+			VolumeMode:       util.FakeEntryBlock,
+			recordedIdentity: &util.BlockDeviceIdentity{PartUUID: "8f3d2c1a-0001"},
+			deviceIdentity:   &util.BlockDeviceIdentity{PartUUID: "8f3d2c1a-0002"},
+		},
+	}
+	test := &testConfig{vols: vols, expectedDeletedPVs: map[string]string{}}
+	d := testSetupForJobCleaning(t, test, []string{"sh", "-c", "echo \"hello\""})
+
+	err := d.deletePV(test.generatedPVs["pv4"])
+	if err == nil {
+		t.Errorf("Expected error when device identity does not match")
+	}
+
+	jobs := getCreatedJobs(test.clientset)
+	if len(jobs) != 0 {
+		t.Fatalf("No job should have been created for a mismatched device, got %+v", jobs)
+	}
+}
+
+// setMkfsCommand replaces mkfs by a script writing its arguments to argsPath, until the returned
+// function is called.
+func setMkfsCommand(t *testing.T, argsPath string) func() {
+	script := filepath.Join(t.TempDir(), "mkfs")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > "+argsPath+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	saved := mkfsCommand
+	mkfsCommand = script
+	return func() {
+		mkfsCommand = saved
+	}
+}
+
+func testSetupForProcCleaning(t *testing.T, config *testConfig, cleanupCmd []string) *Deleter {
+	return testSetup(t, config, cleanupCmd, false)
+}
+
+func testSetupForJobCleaning(t *testing.T, config *testConfig, cleanupCmd []string) *Deleter {
+	return testSetup(t, config, cleanupCmd, true)
+}
+
+func testSetup(t *testing.T, config *testConfig, cleanupCmd []string, useJobForCleaning bool) *Deleter {
+	config.cache = cache.NewVolumeCache()
+	config.clientset = fake.NewSimpleClientset()
+
+	config.clientset.PrependReactor("create", "persistentvolumes", func(action core.Action) (bool, runtime.Object, error) {
+		obj := action.(core.CreateAction).GetObject()
+		pv := obj.(*v1.PersistentVolume)
+		config.cache.AddPV(pv)
+		return false, nil, nil
+	})
+
+	config.clientset.PrependReactor("delete", "persistentvolumes", func(action core.Action) (bool, runtime.Object, error) {
+		if config.apiShouldFail {
+			return true, nil, fmt.Errorf("API failed")
+		}
+
+		pvName := action.(core.DeleteAction).GetName()
+		_, exists := config.cache.GetPV(pvName)
+		if exists {
+			config.cache.DeletePV(pvName)
 			return false, nil, nil
 		}
 		return true, nil, errors.NewNotFound(v1.Resource("persistentvolumes"), pvName)
@@ -584,6 +1948,7 @@ func testSetup(t *testing.T, config *testConfig, cleanupCmd []string, useJobForC
 		} else {
 			lpvConfig.ReclaimPolicy = v1.PersistentVolumeReclaimDelete
 		}
+		lpvConfig.Annotations = common.BlockDeviceIdentityToAnnotations(vol.recordedIdentity)
 		pv := common.CreateLocalPVSpec(&lpvConfig)
 		pv.Status.Phase = vol.pvPhase
 		pv.DeletionTimestamp = vol.deletionTimestamp
@@ -599,7 +1964,8 @@ func testSetup(t *testing.T, config *testConfig, cleanupCmd []string, useJobForC
 			vol.VolumeMode = util.FakeEntryFile
 		}
 		newVols["test1"] = append(newVols["test1"], &util.FakeDirEntry{Name: "entry-" + pvName, Hash: 0xf34b8003,
-			VolumeType: vol.VolumeMode})
+			VolumeType: vol.VolumeMode, Identity: vol.deviceIdentity, DeleteFailures: vol.deleteFailures,
+			MountRoot: vol.mountRoot})
 	}
 	// Update volume util
 	config.volUtil.AddNewDirEntries(testMountDir, newVols)
@@ -666,6 +2032,22 @@ func verifyPVExists(t *testing.T, config *testConfig) {
 	}
 }
 
+// hasEvent drains the events recorded so far, and returns true if one of them has the given reason.
+func hasEvent(d *Deleter, reason string) bool {
+	found := false
+	recorderChan := d.RuntimeConfig.Recorder.(*record.FakeRecorder).Events
+	for {
+		select {
+		case event := <-recorderChan:
+			if strings.HasPrefix(event, v1.EventTypeWarning+" "+reason+" ") {
+				found = true
+			}
+		default:
+			return found
+		}
+	}
+}
+
 // waitForAsyncToComplete Since commands are all async, this function helps wait for commands to complete.
 func waitForAsyncToComplete(t *testing.T, d *Deleter, pvNames ...string) {
 	for count := 0; count < 30 && !d.CleanupStatus.ProcTable.IsEmpty(); count++ {
@@ -0,0 +1,166 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deleter
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DirtyVolumes records on the node the volumes whose PV has been released and which have not been
+// cleaned up successfully yet, one marker file per volume host path, so that they are never
+// published again with the data of their previous user. It also records the devices of the dirty
+// volumes which are formatted again, as they are unmounted during their cleanup, and the dirty
+// volumes whose PV is gone and whose cleanup has been quarantined. A nil DirtyVolumes records nothing.
+type DirtyVolumes struct {
+	dir string
+}
+
+// NewDirtyVolumes returns a DirtyVolumes recording the markers in dir, which is created if needed.
+func NewDirtyVolumes(dir string) (*DirtyVolumes, error) {
+	for _, subdir := range []string{devicesDir, quarantinedDir} {
+		if err := os.MkdirAll(filepath.Join(dir, subdir), 0700); err != nil {
+			return nil, fmt.Errorf("error creating dirty volumes directory %q: %v", dir, err)
+		}
+	}
+	return &DirtyVolumes{dir: dir}, nil
+}
+
+// devicesDir is the subdirectory of the device records, which can't collide with the markers
+// since the escaped host paths start with %2F.
+const devicesDir = "devices"
+
+// quarantinedDir is the subdirectory of the quarantine records.
+const quarantinedDir = "quarantined"
+
+func (v *DirtyVolumes) markerPath(hostPath string) string {
+	return filepath.Join(v.dir, url.PathEscape(hostPath))
+}
+
+func (v *DirtyVolumes) devicePath(hostPath string) string {
+	return filepath.Join(v.dir, devicesDir, url.PathEscape(hostPath))
+}
+
+func (v *DirtyVolumes) quarantinePath(hostPath string) string {
+	return filepath.Join(v.dir, quarantinedDir, url.PathEscape(hostPath))
+}
+
+// Mark records that the volume at hostPath must be cleaned up before it is published again.
+func (v *DirtyVolumes) Mark(hostPath string) error {
+	if v == nil {
+		return nil
+	}
+	// Released PVs are marked on every deleter run until they are cleaned up.
+	if dirty, err := v.IsDirty(hostPath); err != nil || dirty {
+		return err
+	}
+	if err := os.WriteFile(v.markerPath(hostPath), []byte(hostPath), 0600); err != nil {
+		return fmt.Errorf("error marking volume %q as dirty: %v", hostPath, err)
+	}
+	return nil
+}
+
+// Clear records that the volume at hostPath has been cleaned up.
+func (v *DirtyVolumes) Clear(hostPath string) error {
+	if v == nil {
+		return nil
+	}
+	if err := os.Remove(v.devicePath(hostPath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error clearing device of volume %q: %v", hostPath, err)
+	}
+	if err := os.Remove(v.quarantinePath(hostPath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error clearing quarantine of volume %q: %v", hostPath, err)
+	}
+	if err := os.Remove(v.markerPath(hostPath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error clearing dirty marker of volume %q: %v", hostPath, err)
+	}
+	return nil
+}
+
+// RecordDevice records the device of the volume at hostPath and its stable identity, until the
+// volume is cleaned up.
+func (v *DirtyVolumes) RecordDevice(hostPath, device, identity string) error {
+	if v == nil {
+		return nil
+	}
+	if err := os.WriteFile(v.devicePath(hostPath), []byte(device+"\n"+identity), 0600); err != nil {
+		return fmt.Errorf("error recording device of volume %q: %v", hostPath, err)
+	}
+	return nil
+}
+
+// Device returns the recorded device of the volume at hostPath and its identity, or "" if none is
+// recorded.
+func (v *DirtyVolumes) Device(hostPath string) (string, string, error) {
+	if v == nil {
+		return "", "", nil
+	}
+	record, err := os.ReadFile(v.devicePath(hostPath))
+	if os.IsNotExist(err) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error reading device of volume %q: %v", hostPath, err)
+	}
+	device, identity, _ := strings.Cut(string(record), "\n")
+	return device, identity, nil
+}
+
+// IsDirty returns true if the volume at hostPath must be cleaned up before it is published again.
+func (v *DirtyVolumes) IsDirty(hostPath string) (bool, error) {
+	if v == nil {
+		return false, nil
+	}
+	_, err := os.Stat(v.markerPath(hostPath))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error checking dirty marker of volume %q: %v", hostPath, err)
+	}
+	return true, nil
+}
+
+// Quarantine records that the cleanup of the volume at hostPath must not be retried, until an admin
+// removes the record or the volume is cleaned up.
+func (v *DirtyVolumes) Quarantine(hostPath, reason string) error {
+	if v == nil {
+		return nil
+	}
+	if err := os.WriteFile(v.quarantinePath(hostPath), []byte(reason), 0600); err != nil {
+		return fmt.Errorf("error quarantining volume %q: %v", hostPath, err)
+	}
+	return nil
+}
+
+// IsQuarantined returns true if the cleanup of the volume at hostPath has been quarantined.
+func (v *DirtyVolumes) IsQuarantined(hostPath string) (bool, error) {
+	if v == nil {
+		return false, nil
+	}
+	_, err := os.Stat(v.quarantinePath(hostPath))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error checking quarantine of volume %q: %v", hostPath, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deleter
+
+import (
+	"testing"
+)
+
+func TestDirtyVolumes(t *testing.T) {
+	dirtyVolumes, err := NewDirtyVolumes(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{"/mnt/disks/vol1", "/mnt/disks/vol1/sub", "/mnt/disks/vol2"}
+	if err := dirtyVolumes.Mark(paths[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dirtyVolumes.Mark(paths[1]); err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []bool{true, true, false} {
+		dirty, err := dirtyVolumes.IsDirty(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dirty != expected {
+			t.Errorf("Expected volume %q dirty %v, got %v", paths[i], expected, dirty)
+		}
+	}
+
+	if err := dirtyVolumes.Clear(paths[0]); err != nil {
+		t.Fatal(err)
+	}
+	// Clearing a volume which isn't dirty is a no-op.
+	if err := dirtyVolumes.Clear(paths[2]); err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []bool{false, true, false} {
+		dirty, err := dirtyVolumes.IsDirty(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dirty != expected {
+			t.Errorf("Expected volume %q dirty %v, got %v", paths[i], expected, dirty)
+		}
+	}
+
+	// A nil DirtyVolumes records nothing.
+	var disabled *DirtyVolumes
+	if err := disabled.Mark(paths[0]); err != nil {
+		t.Fatal(err)
+	}
+	if dirty, err := disabled.IsDirty(paths[0]); err != nil || dirty {
+		t.Errorf("Expected no dirty volume, got dirty %v, err %v", dirty, err)
+	}
+}
+
+func TestDirtyVolumes_Device(t *testing.T) {
+	dirtyVolumes, err := NewDirtyVolumes(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostPath := "/mnt/disks/vol1"
+	if err := dirtyVolumes.Mark(hostPath); err != nil {
+		t.Fatal(err)
+	}
+	if device, identity, err := dirtyVolumes.Device(hostPath); err != nil || device != "" || identity != "" {
+		t.Errorf("Expected no device, got %q with identity %q, err %v", device, identity, err)
+	}
+	if err := dirtyVolumes.RecordDevice(hostPath, "/dev/sdb", "wwn:0x5000c500a1b2c3d4"); err != nil {
+		t.Fatal(err)
+	}
+	if device, identity, err := dirtyVolumes.Device(hostPath); err != nil || device != "/dev/sdb" ||
+		identity != "wwn:0x5000c500a1b2c3d4" {
+		t.Errorf("Expected device /dev/sdb with identity wwn:0x5000c500a1b2c3d4, got %q with identity %q, err %v",
+			device, identity, err)
+	}
+
+	// The device is forgotten once the volume is cleaned up.
+	if err := dirtyVolumes.Clear(hostPath); err != nil {
+		t.Fatal(err)
+	}
+	if device, identity, err := dirtyVolumes.Device(hostPath); err != nil || device != "" || identity != "" {
+		t.Errorf("Expected no device, got %q with identity %q, err %v", device, identity, err)
+	}
+}
+
+func TestDirtyVolumes_Quarantine(t *testing.T) {
+	dirtyVolumes, err := NewDirtyVolumes(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostPath := "/mnt/disks/vol1"
+	if err := dirtyVolumes.Mark(hostPath); err != nil {
+		t.Fatal(err)
+	}
+	if quarantined, err := dirtyVolumes.IsQuarantined(hostPath); err != nil || quarantined {
+		t.Errorf("Expected volume not to be quarantined, got %v, err %v", quarantined, err)
+	}
+	if err := dirtyVolumes.Quarantine(hostPath, "cleanup failed 3 times"); err != nil {
+		t.Fatal(err)
+	}
+	if quarantined, err := dirtyVolumes.IsQuarantined(hostPath); err != nil || !quarantined {
+		t.Errorf("Expected volume to be quarantined, got %v, err %v", quarantined, err)
+	}
+
+	// The quarantine is lifted once the volume is cleaned up.
+	if err := dirtyVolumes.Clear(hostPath); err != nil {
+		t.Fatal(err)
+	}
+	if quarantined, err := dirtyVolumes.IsQuarantined(hostPath); err != nil || quarantined {
+		t.Errorf("Expected volume not to be quarantined, got %v, err %v", quarantined, err)
+	}
+}
@@ -17,17 +17,23 @@ limitations under the License.
 package deleter
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"strconv"
 	"time"
 
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/cleaner"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/metrics"
 
 	batch_v1 "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
@@ -54,6 +60,19 @@ const (
 	// volume deletion time.
 	// Time is formatted in time.RFC3339Nano.
 	StartTimeAnnotation = "start-time"
+	// StorageClassAnnotation is the annotation that specifies the storage class of the PV, which
+	// the concurrency limits of the cleanups of the class count the running jobs by.
+	StorageClassAnnotation = "storage-class"
+	// MaxCleanupAttemptsAnnotation is the annotation that specifies the maximum number of cleanup
+	// attempts of the class of the PV. A failed job with this annotation is counted as a failed
+	// attempt right away, unless failed jobs are kept for a TTL.
+	MaxCleanupAttemptsAnnotation = "max-cleanup-attempts"
+
+	// jobLogTailLines is how many lines of the logs of a successful cleanup job are collected
+	// before the job is deleted.
+	jobLogTailLines = 100
+	// maxJobLogEventLength bounds the length of the logs recorded in the event on the PV.
+	maxJobLogEventLength = 1024
 )
 
 // JobController defines the interface for the job controller.
@@ -61,6 +80,7 @@ type JobController interface {
 	Run(stopCh <-chan struct{})
 	IsCleaningJobRunning(pvName string) bool
 	RemoveJob(pvName string) (CleanupState, *time.Time, error)
+	ListRunningJobs() map[string]string
 }
 
 var _ JobController = &jobController{}
@@ -70,6 +90,8 @@ type jobController struct {
 	namespace string
 	queue     workqueue.RateLimitingInterface
 	jobLister batchlisters.JobLister
+	// reportedFailures records the UID of the failed jobs already reported, by job key
+	reportedFailures map[string]types.UID
 }
 
 // NewJobController instantiates  a new job controller.
@@ -116,10 +138,11 @@ func NewJobController(labelmap map[string]string, config *common.RuntimeConfig)
 	})
 
 	return &jobController{
-		RuntimeConfig: config,
-		namespace:     namespace,
-		queue:         queue,
-		jobLister:     batchlisters.NewJobLister(informer.GetIndexer()),
+		RuntimeConfig:    config,
+		namespace:        namespace,
+		queue:            queue,
+		jobLister:        batchlisters.NewJobLister(informer.GetIndexer()),
+		reportedFailures: map[string]types.UID{},
 	}, nil
 
 }
@@ -171,6 +194,7 @@ func (c *jobController) processNextItem() bool {
 
 func (c *jobController) processItem(key string) error {
 	klog.Infof("Processing change to Pod %s", key)
+	defer c.updateFailedJobsMetric()
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
 		return err
@@ -179,6 +203,7 @@ func (c *jobController) processItem(key string) error {
 	job, err := c.jobLister.Jobs(namespace).Get(name)
 	if errors.IsNotFound(err) {
 		klog.Infof("Job %s has been deleted", key)
+		delete(c.reportedFailures, key)
 		return nil
 	}
 	if err != nil {
@@ -192,6 +217,11 @@ func (c *jobController) processItem(key string) error {
 		return nil
 	}
 
+	if failure := jobFailure(job); failure != nil {
+		c.reportFailedJob(key, job, failure)
+		return nil
+	}
+
 	if job.Status.Succeeded == 0 {
 		klog.Infof("Job %s has not yet completed successfully", key)
 		return nil
@@ -201,6 +231,62 @@ func (c *jobController) processItem(key string) error {
 	return nil
 }
 
+// reportFailedJob reports a failed cleanup job once. The job is kept until it expires, and then
+// removed by the deleter, which counts it as a failed cleanup of its PV.
+func (c *jobController) reportFailedJob(key string, job *batch_v1.Job, failure *batch_v1.JobCondition) {
+	if c.reportedFailures[key] == job.UID {
+		return
+	}
+	c.reportedFailures[key] = job.UID
+	pvName := job.Labels[PVLabel]
+	klog.Warningf("Cleanup job %s of pv %s failed: %s: %s", key, pvName, failure.Reason, failure.Message)
+	c.Recorder.Eventf(pvReference(pvName), apiv1.EventTypeWarning, common.EventVolumeCleanupJobFailed,
+		"Cleanup job %s failed: %s: %s", job.Name, failure.Reason, failure.Message)
+}
+
+// failedJobExpired returns true if the job has been failed for longer than the failed cleanup job
+// TTL. Without a TTL, failed jobs only expire right away when their cleanup attempts are bounded.
+func (c *jobController) failedJobExpired(job *batch_v1.Job, failure *batch_v1.JobCondition) bool {
+	ttl := c.FailedCleanupJobTTL.Duration
+	if ttl <= 0 {
+		_, bounded := job.Annotations[MaxCleanupAttemptsAnnotation]
+		return bounded
+	}
+	return !time.Now().Before(failure.LastTransitionTime.Add(ttl))
+}
+
+// updateFailedJobsMetric counts the failed cleanup jobs which are not being deleted.
+func (c *jobController) updateFailedJobsMetric() {
+	jobs, err := c.jobLister.Jobs(c.namespace).List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Failed to list cleanup jobs: %v", err)
+		return
+	}
+	failed := 0
+	for _, job := range jobs {
+		if job.DeletionTimestamp == nil && jobFailure(job) != nil {
+			failed++
+		}
+	}
+	metrics.CleanupJobsFailed.Set(float64(failed))
+}
+
+// jobFailure returns the condition of the job reporting its failure, nil if it hasn't failed.
+func jobFailure(job *batch_v1.Job) *batch_v1.JobCondition {
+	for i := range job.Status.Conditions {
+		condition := &job.Status.Conditions[i]
+		if condition.Type == batch_v1.JobFailed && condition.Status == apiv1.ConditionTrue {
+			return condition
+		}
+	}
+	return nil
+}
+
+// pvReference returns a reference to the PV for recording events on it.
+func pvReference(pvName string) *apiv1.ObjectReference {
+	return &apiv1.ObjectReference{Kind: "PersistentVolume", APIVersion: "v1", Name: pvName}
+}
+
 // IsCleaningJobRunning returns true if a cleaning job is running for the specified PV.
 func (c *jobController) IsCleaningJobRunning(pvName string) bool {
 	jobName := generateCleaningJobName(pvName)
@@ -215,10 +301,34 @@ func (c *jobController) IsCleaningJobRunning(pvName string) bool {
 		return true
 	}
 
+	if failure := jobFailure(job); failure != nil {
+		// The cleanup isn't retried while the failed job is kept.
+		return !c.failedJobExpired(job, failure)
+	}
 	return job.Status.Succeeded <= 0
 }
 
-// RemoveJob returns true and deletes the job if the cleaning job has completed.
+// ListRunningJobs returns the storage class of the PVs whose cleaning job is running, by PV name.
+// The class is empty for the jobs created without the storage class annotation.
+func (c *jobController) ListRunningJobs() map[string]string {
+	jobs, err := c.jobLister.Jobs(c.namespace).List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Failed to list cleanup jobs: %v", err)
+		return nil
+	}
+	running := map[string]string{}
+	for _, job := range jobs {
+		pvName, ok := job.Labels[PVLabel]
+		if !ok || job.DeletionTimestamp != nil || job.Status.Succeeded > 0 || jobFailure(job) != nil {
+			continue
+		}
+		running[pvName] = job.Annotations[StorageClassAnnotation]
+	}
+	return running
+}
+
+// RemoveJob deletes the cleaning job if it has succeeded, or if it has failed and expired, and
+// returns CSSucceeded or CSFailed accordingly.
 func (c *jobController) RemoveJob(pvName string) (CleanupState, *time.Time, error) {
 	jobName := generateCleaningJobName(pvName)
 	job, err := c.jobLister.Jobs(c.namespace).Get(jobName)
@@ -240,11 +350,30 @@ func (c *jobController) RemoveJob(pvName string) (CleanupState, *time.Time, erro
 		}
 	}
 
+	if failure := jobFailure(job); failure != nil && c.failedJobExpired(job, failure) {
+		// Deleting the job deletes its logs too, so keep a record of why the cleanup failed.
+		c.collectJobLogs(job, pvName, false)
+		if err := c.RuntimeConfig.APIUtil.DeleteJob(job.Name, c.namespace); err != nil && !errors.IsNotFound(err) {
+			return CSUnknown, nil, fmt.Errorf("Error deleting failed Job %q: %s", job.Name, err.Error())
+		}
+		if ttl := c.FailedCleanupJobTTL.Duration; ttl > 0 {
+			klog.Infof("Deleted cleanup job %s of pv %s, failed for longer than %v", job.Name, pvName, ttl)
+			c.Recorder.Eventf(pvReference(pvName), apiv1.EventTypeNormal, common.EventVolumeCleanupJobExpired,
+				"Deleted cleanup job %s, failed for longer than %v", job.Name, ttl)
+		} else {
+			klog.Infof("Deleted failed cleanup job %s of pv %s", job.Name, pvName)
+		}
+		return CSFailed, startTime, nil
+	}
+
 	if job.Status.Succeeded == 0 {
-		// Jobs has not yet succeeded. We assume failed jobs to be still running, until addressed by admin.
+		// Jobs has not yet succeeded. Failed jobs are kept until they expire, or are addressed by admin.
 		return CSUnknown, nil, fmt.Errorf("Error deleting Job %q: Cannot remove job that has not succeeded", job.Name)
 	}
 
+	// Deleting the job deletes its logs too, so keep a record of what the cleanup did.
+	c.collectJobLogs(job, pvName, true)
+
 	if err := c.RuntimeConfig.APIUtil.DeleteJob(job.Name, c.namespace); err != nil {
 		return CSUnknown, nil, fmt.Errorf("Error deleting Job %q: %s", job.Name, err.Error())
 	}
@@ -252,8 +381,58 @@ func (c *jobController) RemoveJob(pvName string) (CleanupState, *time.Time, erro
 	return CSSucceeded, startTime, nil
 }
 
+// collectJobLogs records the tail of the logs of a successful or failed cleanup job in the provisioner
+// log and in an event on its PV. Failing to fetch them doesn't prevent the job from being removed.
+func (c *jobController) collectJobLogs(job *batch_v1.Job, pvName string, succeeded bool) {
+	outcome, phase, eventType := "succeeded", apiv1.PodSucceeded, apiv1.EventTypeNormal
+	if !succeeded {
+		outcome, phase, eventType = "failed", apiv1.PodFailed, apiv1.EventTypeWarning
+	}
+	selector := labels.SelectorFromSet(labels.Set{"job-name": job.Name})
+	if job.Spec.Selector != nil {
+		jobSelector, err := meta_v1.LabelSelectorAsSelector(job.Spec.Selector)
+		if err == nil {
+			selector = jobSelector
+		}
+	}
+	pods, err := c.Client.CoreV1().Pods(c.namespace).List(context.TODO(), meta_v1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		klog.Warningf("Failed to list the pods of job %s to collect their logs: %v", job.Name, err)
+		return
+	}
+	var pod *apiv1.Pod
+	for i := range pods.Items {
+		if pods.Items[i].Status.Phase == phase {
+			pod = &pods.Items[i]
+			break
+		}
+	}
+	if pod == nil {
+		klog.Warningf("Found no %s pod of job %s to collect its logs", outcome, job.Name)
+		return
+	}
+
+	tailLines := int64(jobLogTailLines)
+	logs, err := c.Client.CoreV1().Pods(c.namespace).GetLogs(pod.Name, &apiv1.PodLogOptions{
+		Container: JobContainerName,
+		TailLines: &tailLines,
+	}).DoRaw(context.TODO())
+	if err != nil {
+		klog.Warningf("Failed to collect the logs of pod %s of job %s: %v", pod.Name, job.Name, err)
+		return
+	}
+	klog.Infof("Cleanup job %s of pv %s %s, last logs of pod %s:\n%s", job.Name, pvName, outcome, pod.Name, logs)
+
+	eventLogs := string(logs)
+	if len(eventLogs) > maxJobLogEventLength {
+		eventLogs = "..." + eventLogs[len(eventLogs)-maxJobLogEventLength:]
+	}
+	c.Recorder.Eventf(pvReference(pvName), eventType, common.EventVolumeCleanupLogs,
+		"Cleanup job %s %s, last logs:\n%s", job.Name, outcome, eventLogs)
+}
+
 // NewCleanupJob creates manifest for a cleaning job.
-func NewCleanupJob(pv *apiv1.PersistentVolume, volMode apiv1.PersistentVolumeMode, imageName string, tolerations []apiv1.Toleration, nodeName string, namespace string, mountPath string, config common.MountConfig) (*batch_v1.Job, error) {
+func NewCleanupJob(pv *apiv1.PersistentVolume, volMode apiv1.PersistentVolumeMode, imageName string, tolerations []apiv1.Toleration, template *common.JobTemplate, nodeName string, namespace string, mountPath string, config common.MountConfig) (*batch_v1.Job, error) {
 	priv := true
 	// Container definition
 	jobContainer := apiv1.Container{
@@ -265,11 +444,16 @@ func NewCleanupJob(pv *apiv1.PersistentVolume, volMode apiv1.PersistentVolumeMod
 	}
 	if volMode == apiv1.PersistentVolumeBlock {
 		jobContainer.Command = config.BlockCleanerCommand
+		if cleaner.IsBuiltin(config.BlockCleanerCommand) {
+			// The built-in cleaners run in the provisioner binary of the job image.
+			jobContainer.Command = append([]string{common.ProvisionerBinaryPath, cleaner.Subcommand}, config.BlockCleanerCommand...)
+		}
 		jobContainer.Env = []apiv1.EnvVar{{Name: common.LocalPVEnv, Value: mountPath}}
 	} else if volMode == apiv1.PersistentVolumeFilesystem {
-		// We only have one way to clean filesystem, so no need to customize
-		// filesystem cleaner command.
-		jobContainer.Command = []string{"/scripts/fsclean.sh"}
+		jobContainer.Command = config.FilesystemCleanerCommand
+		if len(jobContainer.Command) == 0 {
+			jobContainer.Command = []string{"/scripts/fsclean.sh"}
+		}
 		jobContainer.Env = []apiv1.EnvVar{{Name: common.LocalFilesystemEnv, Value: mountPath}}
 	} else {
 		return nil, fmt.Errorf("unknown PersistentVolume mode: %v", volMode)
@@ -316,8 +500,9 @@ func NewCleanupJob(pv *apiv1.PersistentVolume, volMode apiv1.PersistentVolumeMod
 
 	// Annotate job with useful information that cannot be set as labels due to label name restrictions.
 	annotations := map[string]string{
-		DeviceAnnotation:    mountPath,
-		StartTimeAnnotation: time.Now().Format(time.RFC3339Nano),
+		DeviceAnnotation:       mountPath,
+		StartTimeAnnotation:    time.Now().Format(time.RFC3339Nano),
+		StorageClassAnnotation: pv.Spec.StorageClassName,
 	}
 
 	podTemplate := apiv1.Pod{}
@@ -337,10 +522,56 @@ func NewCleanupJob(pv *apiv1.PersistentVolume, volMode apiv1.PersistentVolumeMod
 	job.ObjectMeta = podTemplate.ObjectMeta
 	job.Spec.Template.Spec = podTemplate.Spec
 	job.Spec.Template.Spec.RestartPolicy = apiv1.RestartPolicyOnFailure
+	applyJobTemplate(job, template.Merge(config.JobTemplate))
+	if config.CleanupTimeout.Duration > 0 {
+		// The deadline is in whole seconds, and must be positive.
+		activeDeadlineSeconds := int64(math.Ceil(config.CleanupTimeout.Seconds()))
+		job.Spec.ActiveDeadlineSeconds = &activeDeadlineSeconds
+	}
+	if config.MaxCleanupAttempts > 0 {
+		// Each job is one cleanup attempt, retried by the deleter with a new job after a backoff.
+		backoffLimit := int32(0)
+		job.Spec.BackoffLimit = &backoffLimit
+		job.Annotations[MaxCleanupAttemptsAnnotation] = strconv.Itoa(config.MaxCleanupAttempts)
+	}
 
 	return job, nil
 }
 
+// applyJobTemplate customizes the job with the fields set in the template. The labels and
+// annotations generated by the provisioner are kept, as the job controller relies on them.
+func applyJobTemplate(job *batch_v1.Job, template *common.JobTemplate) {
+	if template == nil {
+		return
+	}
+	for key, value := range template.Labels {
+		if _, ok := job.Labels[key]; !ok {
+			job.Labels[key] = value
+		}
+	}
+	for key, value := range template.Annotations {
+		if _, ok := job.Annotations[key]; !ok {
+			job.Annotations[key] = value
+		}
+	}
+	job.Spec.Template.Labels = template.Labels
+	job.Spec.Template.Annotations = template.Annotations
+
+	podSpec := &job.Spec.Template.Spec
+	podSpec.PriorityClassName = template.PriorityClassName
+	podSpec.ServiceAccountName = template.ServiceAccountName
+	podSpec.SecurityContext = template.PodSecurityContext
+	container := &podSpec.Containers[0]
+	if template.Resources != nil {
+		container.Resources = *template.Resources
+	}
+	if template.SecurityContext != nil {
+		container.SecurityContext = template.SecurityContext
+	}
+	job.Spec.BackoffLimit = template.BackoffLimit
+	job.Spec.ActiveDeadlineSeconds = template.ActiveDeadlineSeconds
+}
+
 func generateCleaningJobName(pvName string) string {
 	return JobNamePrefix + pvName
 }
@@ -374,11 +605,28 @@ func (c *FakeJobController) MarkSucceeded(pvName string) {
 	c.pvCleanupRunning[pvName] = CSSucceeded
 }
 
+// MarkFailed simulates a failed job which can be replaced for the specified PV.
+func (c *FakeJobController) MarkFailed(pvName string) {
+	c.pvCleanupRunning[pvName] = CSFailed
+}
+
 // IsCleaningJobRunning mocks the interface method.
 func (c *FakeJobController) IsCleaningJobRunning(pvName string) bool {
 	c.IsRunningCount++
-	_, exists := c.pvCleanupRunning[pvName]
-	return exists
+	status, exists := c.pvCleanupRunning[pvName]
+	// Like a Job, a succeeded or replaceable failed cleanup is no longer running.
+	return exists && status != CSSucceeded && status != CSFailed
+}
+
+// ListRunningJobs mocks the interface method, without the storage classes of the PVs.
+func (c *FakeJobController) ListRunningJobs() map[string]string {
+	running := map[string]string{}
+	for pvName, status := range c.pvCleanupRunning {
+		if status == CSRunning {
+			running[pvName] = ""
+		}
+	}
+	return running
 }
 
 // RemoveJob mocks the interface method.
@@ -388,8 +636,9 @@ func (c *FakeJobController) RemoveJob(pvName string) (CleanupState, *time.Time,
 	if !exists {
 		return CSNotFound, nil, nil
 	}
-	if status != CSSucceeded {
+	if status != CSSucceeded && status != CSFailed {
 		return CSUnknown, nil, fmt.Errorf("cannot remove job that has not yet completed %s status %d", pvName, status)
 	}
-	return CSSucceeded, nil, nil
+	delete(c.pvCleanupRunning, pvName)
+	return status, nil, nil
 }
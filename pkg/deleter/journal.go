@@ -0,0 +1,129 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deleter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// journalEntry is the state of a cleanup recorded in the journal.
+type journalEntry struct {
+	StartTime time.Time `json:"startTime"`
+	// State is one of running, succeeded or failed
+	State string `json:"state"`
+}
+
+const (
+	journalStateRunning   = "running"
+	journalStateSucceeded = "succeeded"
+	journalStateFailed    = "failed"
+
+	journalTempSuffix = ".tmp"
+)
+
+// CleanupJournal records the state of the process based cleanups in a directory on the node, one
+// file per PV, so that the cleanups interrupted by a provisioner restart are known when it starts again.
+type CleanupJournal struct {
+	dir string
+}
+
+// NewCleanupJournal returns a CleanupJournal recording the cleanups in dir, which is created if needed.
+func NewCleanupJournal(dir string) (*CleanupJournal, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating cleanup journal directory %q: %v", dir, err)
+	}
+	return &CleanupJournal{dir: dir}, nil
+}
+
+// record writes the state of the cleanup of the PV, replacing the previous one atomically.
+func (j *CleanupJournal) record(pvName string, entry ProcEntry) error {
+	var state string
+	switch entry.Status {
+	case CSRunning:
+		state = journalStateRunning
+	case CSSucceeded:
+		state = journalStateSucceeded
+	case CSFailed:
+		state = journalStateFailed
+	default:
+		return fmt.Errorf("unexpected cleanup state %d for pv %q", entry.Status, pvName)
+	}
+	data, err := json.Marshal(journalEntry{StartTime: entry.StartTime, State: state})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(j.dir, pvName)
+	if err := os.WriteFile(path+journalTempSuffix, data, 0600); err != nil {
+		return fmt.Errorf("error recording cleanup of pv %q: %v", pvName, err)
+	}
+	if err := os.Rename(path+journalTempSuffix, path); err != nil {
+		return fmt.Errorf("error recording cleanup of pv %q: %v", pvName, err)
+	}
+	return nil
+}
+
+// remove deletes the recorded state of the cleanup of the PV.
+func (j *CleanupJournal) remove(pvName string) error {
+	if err := os.Remove(filepath.Join(j.dir, pvName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing cleanup of pv %q from journal: %v", pvName, err)
+	}
+	return nil
+}
+
+// load returns the recorded cleanups. The cleanups which were still running are returned as
+// interrupted.
+func (j *CleanupJournal) load() (map[string]ProcEntry, error) {
+	files, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cleanup journal directory %q: %v", j.dir, err)
+	}
+	entries := map[string]ProcEntry{}
+	for _, file := range files {
+		if file.IsDir() || strings.HasSuffix(file.Name(), journalTempSuffix) {
+			continue
+		}
+		pvName := file.Name()
+		data, err := os.ReadFile(filepath.Join(j.dir, pvName))
+		if err != nil {
+			return nil, fmt.Errorf("error reading cleanup of pv %q from journal: %v", pvName, err)
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			// Err on the side of caution, the cleanup may have been interrupted.
+			klog.Errorf("Error parsing cleanup of pv %q from journal, considering it interrupted: %v", pvName, err)
+			entry.State = journalStateRunning
+		}
+		procEntry := ProcEntry{StartTime: entry.StartTime}
+		switch entry.State {
+		case journalStateSucceeded:
+			procEntry.Status = CSSucceeded
+		case journalStateFailed:
+			procEntry.Status = CSFailed
+		default:
+			procEntry.Status = CSInterrupted
+		}
+		entries[pvName] = procEntry
+	}
+	return entries, nil
+}
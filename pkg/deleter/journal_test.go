@@ -0,0 +1,92 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deleter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournaledProcTable_Restore(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := NewCleanupJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := NewJournaledProcTable(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pvName := range []string{"running", "succeeded", "failed", "removed"} {
+		if err := table.MarkRunning(pvName); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := table.MarkSucceeded("succeeded"); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.MarkFailed("failed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.MarkSucceeded("removed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := table.RemoveEntry("removed"); err != nil {
+		t.Fatal(err)
+	}
+	// A journal file left corrupted by a crash is considered interrupted.
+	if err := os.WriteFile(filepath.Join(dir, "corrupted"), []byte("{\"startTime\":"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a restart of the provisioner.
+	restored, err := NewJournaledProcTable(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedStates := map[string]CleanupState{
+		"running":   CSInterrupted,
+		"succeeded": CSSucceeded,
+		"failed":    CSFailed,
+		"corrupted": CSInterrupted,
+		"removed":   CSNotFound,
+	}
+	for pvName, expected := range expectedStates {
+		if restored.IsRunning(pvName) {
+			t.Errorf("Expected cleanup of %q not to be running after restart", pvName)
+		}
+		if interrupted := restored.IsInterrupted(pvName); interrupted != (expected == CSInterrupted) {
+			t.Errorf("Expected cleanup of %q interrupted to be %v, got %v", pvName, expected == CSInterrupted, interrupted)
+		}
+		state, _, err := restored.RemoveEntry(pvName)
+		if err != nil {
+			t.Errorf("Error removing cleanup of %q: %v", pvName, err)
+		}
+		if state != expected {
+			t.Errorf("Expected cleanup of %q in state %d, got %d", pvName, expected, state)
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected the journal to be empty once all entries are removed, got %d files", len(files))
+	}
+}
@@ -20,17 +20,21 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"k8s.io/klog/v2"
 )
 
 // ProcTable Interface for tracking running processes
 type ProcTable interface {
 	// CleanupBlockPV deletes block based PV
 	IsRunning(pvName string) bool
+	IsInterrupted(pvName string) bool
 	IsEmpty() bool
 	MarkRunning(pvName string) error
 	MarkFailed(pvName string) error
 	MarkSucceeded(pvName string) error
 	RemoveEntry(pvName string) (CleanupState, *time.Time, error)
+	ListRunning() []string
 	Stats() ProcTableStats
 }
 
@@ -55,6 +59,8 @@ type ProcTableImpl struct {
 	procTable map[string]ProcEntry
 	succeeded int
 	failed    int
+	// journal records the entries on the node if not nil
+	journal *CleanupJournal
 }
 
 // NewProcTable returns a BlockCleaner
@@ -62,6 +68,20 @@ func NewProcTable() *ProcTableImpl {
 	return &ProcTableImpl{procTable: make(map[string]ProcEntry)}
 }
 
+// NewJournaledProcTable returns a BlockCleaner recording its entries in journal, and restores the
+// entries recorded by the previous provisioner run. The cleanups which were still running are
+// restored as interrupted.
+func NewJournaledProcTable(journal *CleanupJournal) (*ProcTableImpl, error) {
+	entries, err := journal.load()
+	if err != nil {
+		return nil, err
+	}
+	for pvName, entry := range entries {
+		klog.Infof("Restored cleanup of pv %q in state %d from journal", pvName, entry.Status)
+	}
+	return &ProcTableImpl{procTable: entries, journal: journal}, nil
+}
+
 // IsRunning Check if cleanup process is still running
 func (v *ProcTableImpl) IsRunning(pvName string) bool {
 	v.mutex.RLock()
@@ -74,6 +94,15 @@ func (v *ProcTableImpl) IsRunning(pvName string) bool {
 	return true
 }
 
+// IsInterrupted Check if cleanup process was interrupted by a provisioner restart
+func (v *ProcTableImpl) IsInterrupted(pvName string) bool {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	entry, ok := v.procTable[pvName]
+	return ok && entry.Status == CSInterrupted
+}
+
 // IsEmpty Check if any cleanup process is running
 func (v *ProcTableImpl) IsEmpty() bool {
 	v.mutex.RLock()
@@ -89,7 +118,14 @@ func (v *ProcTableImpl) MarkRunning(pvName string) error {
 	if ok {
 		return fmt.Errorf("Failed to mark running of %q as it is already running, should never happen", pvName)
 	}
-	v.procTable[pvName] = ProcEntry{StartTime: time.Now(), Status: CSRunning}
+	entry := ProcEntry{StartTime: time.Now(), Status: CSRunning}
+	// Never start a cleanup which would not be known after a restart.
+	if v.journal != nil {
+		if err := v.journal.record(pvName, entry); err != nil {
+			return err
+		}
+	}
+	v.procTable[pvName] = entry
 	return nil
 }
 
@@ -120,6 +156,12 @@ func (v *ProcTableImpl) markStatus(pvName string, status CleanupState) error {
 	// Indicate that the process is done.
 	entry.Status = status
 	v.procTable[pvName] = entry
+	if v.journal != nil {
+		if err := v.journal.record(pvName, entry); err != nil {
+			// The cleanup is then considered interrupted after a restart, and run again.
+			klog.Error(err)
+		}
+	}
 	return nil
 }
 
@@ -139,9 +181,27 @@ func (v *ProcTableImpl) RemoveEntry(pvName string) (CleanupState, *time.Time, er
 		return CSUnknown, nil, fmt.Errorf("proctable entry for %q in unexpected unknown state", pvName)
 	}
 	delete(v.procTable, pvName)
+	if v.journal != nil {
+		if err := v.journal.remove(pvName); err != nil {
+			klog.Error(err)
+		}
+	}
 	return entry.Status, &entry.StartTime, nil
 }
 
+// ListRunning returns the names of the PVs whose cleanup process is running.
+func (v *ProcTableImpl) ListRunning() []string {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	var running []string
+	for pvName, entry := range v.procTable {
+		if entry.Status == CSRunning {
+			running = append(running, pvName)
+		}
+	}
+	return running
+}
+
 // Stats returns stats of ProcTable.
 func (v *ProcTableImpl) Stats() ProcTableStats {
 	v.mutex.RLock()
@@ -187,6 +247,11 @@ func (f *FakeProcTableImpl) IsRunning(pvName string) bool {
 	return f.realTable.IsRunning(pvName)
 }
 
+// IsInterrupted Check if cleanup process was interrupted by a provisioner restart
+func (f *FakeProcTableImpl) IsInterrupted(pvName string) bool {
+	return f.realTable.IsInterrupted(pvName)
+}
+
 // IsEmpty Check if any cleanup process is running
 func (f *FakeProcTableImpl) IsEmpty() bool {
 	return f.realTable.IsEmpty()
@@ -216,6 +281,11 @@ func (f *FakeProcTableImpl) RemoveEntry(pvName string) (CleanupState, *time.Time
 	return f.realTable.RemoveEntry(pvName)
 }
 
+// ListRunning returns the names of the PVs whose cleanup process is running.
+func (f *FakeProcTableImpl) ListRunning() []string {
+	return f.realTable.ListRunning()
+}
+
 // Stats returns stats of ProcTable.
 func (f *FakeProcTableImpl) Stats() ProcTableStats {
 	f.StatsCount++
@@ -17,6 +17,7 @@ limitations under the License.
 package discovery
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -33,6 +34,8 @@ import (
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/metrics"
 
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	storagev1listers "k8s.io/client-go/listers/storage/v1"
 	"k8s.io/client-go/tools/cache"
@@ -48,9 +51,15 @@ type Discoverer struct {
 	// ProcTable is a reference to running processes so that we can prevent PV from being created while
 	// it is being cleaned
 	CleanupTracker *deleter.CleanupStatusTracker
+	// Deleter cleans up the dirty volumes before their PV is created
+	Deleter        *deleter.Deleter
 	nodeSelector   *v1.NodeSelector
 	classLister    storagev1listers.StorageClassLister
 	ownerReference *metav1.OwnerReference
+	// capacityMismatches records the size of the resized volumes of bound PVs already reported
+	capacityMismatches map[string]int64
+	// missingVolumes records the PVs whose backing path is missing, already reported
+	missingVolumes map[string]struct{}
 
 	Readyz *readyzCheck
 }
@@ -77,7 +86,7 @@ func (d *readyzCheck) Name() string {
 
 // NewDiscoverer creates a Discoverer object that will scan through
 // the configured directories and create local PVs for any new directories found
-func NewDiscoverer(config *common.RuntimeConfig, cleanupTracker *deleter.CleanupStatusTracker) (*Discoverer, error) {
+func NewDiscoverer(config *common.RuntimeConfig, cleanupTracker *deleter.CleanupStatusTracker, volumeDeleter *deleter.Deleter) (*Discoverer, error) {
 	sharedInformer := config.InformerFactory.Storage().V1().StorageClasses()
 	sharedInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		// We don't need an actual event handler for StorageClasses,
@@ -87,19 +96,6 @@ func NewDiscoverer(config *common.RuntimeConfig, cleanupTracker *deleter.Cleanup
 		DeleteFunc: nil,
 	})
 
-	labelMap := make(map[string]string)
-	for _, labelName := range config.NodeLabelsForPV {
-		labelVal, ok := config.Node.Labels[labelName]
-		if ok {
-			labelMap[labelName] = labelVal
-		}
-	}
-
-	// Also add any additional labels configured for the PVs
-	for labelName, labelValue := range config.LabelsForPV {
-		labelMap[labelName] = labelValue
-	}
-
 	// Generate owner reference
 	ownerRef, err := generateOwnerReference(config.Node)
 	if err != nil {
@@ -111,14 +107,22 @@ func NewDiscoverer(config *common.RuntimeConfig, cleanupTracker *deleter.Cleanup
 		return nil, fmt.Errorf("Failed to generate node selector: %v", err)
 	}
 
+	// The volumes reported by a previous discoverer are not known to this one.
+	metrics.PersistentVolumeCapacityMismatchBytes.Reset()
+	metrics.PersistentVolumeMissing.Reset()
+
 	return &Discoverer{
 		RuntimeConfig:  config,
-		Labels:         labelMap,
+		Labels:         pvLabels(config),
 		CleanupTracker: cleanupTracker,
+		Deleter:        volumeDeleter,
 		classLister:    sharedInformer.Lister(),
 		nodeSelector:   nodeSelector,
 		ownerReference: ownerRef,
 		Readyz:         &readyzCheck{},
+
+		capacityMismatches: map[string]int64{},
+		missingVolumes:     map[string]struct{}{},
 	}, nil
 }
 
@@ -163,21 +167,63 @@ func generateNodeSelector(node *v1.Node) (*v1.NodeSelector, error) {
 	}, nil
 }
 
+// pvLabels returns the labels of the node listed in NodeLabelsForPV and the LabelsForPV, which are
+// added to the created PVs.
+func pvLabels(config *common.RuntimeConfig) map[string]string {
+	labelMap := make(map[string]string)
+	for _, labelName := range config.NodeLabelsForPV {
+		labelVal, ok := config.Node.Labels[labelName]
+		if ok {
+			labelMap[labelName] = labelVal
+		}
+	}
+
+	// Also add any additional labels configured for the PVs
+	for labelName, labelValue := range config.LabelsForPV {
+		labelMap[labelName] = labelValue
+	}
+	return labelMap
+}
+
+// UpdateLabels computes again the labels added to the PVs created from now on, after the
+// NodeLabelsForPV or the LabelsForPV of the configuration changed. The existing PVs are left as is.
+func (d *Discoverer) UpdateLabels() {
+	d.Labels = pvLabels(d.RuntimeConfig)
+}
+
 // DiscoverLocalVolumes reads the configured discovery paths, and creates PVs for the new volumes
 func (d *Discoverer) DiscoverLocalVolumes() {
 	readyz := true
 	for class, config := range d.DiscoveryMap {
-		err := d.discoverVolumesAtPath(class, config)
+		err := d.discoverVolumesAtPath(class, config, nil, nil)
 		if err != nil {
 			klog.Errorf("Failed to discover local volumes: %v", err)
 			readyz = false
 		}
 	}
+	d.pruneReportedVolumes()
 	d.Readyz.readySync.Lock()
 	d.Readyz.ready = readyz
 	d.Readyz.readySync.Unlock()
 }
 
+// DiscoverVolumes creates PVs for the given entries only, instead of going through the whole
+// discovery directories. The key of the map is the storage class and the value the names of the
+// entries in its discovery directory. Entries which no longer exist are ignored. mountPoints is
+// the set of current mount points, so that the mount table doesn't have to be listed again.
+func (d *Discoverer) DiscoverVolumes(entries map[string][]string, mountPoints map[string]interface{}) {
+	for class, files := range entries {
+		config, ok := d.DiscoveryMap[class]
+		if !ok {
+			continue
+		}
+		err := d.discoverVolumesAtPath(class, config, files, mountPoints)
+		if err != nil {
+			klog.Errorf("Failed to discover local volumes: %v", err)
+		}
+	}
+}
+
 func (d *Discoverer) getReclaimPolicyFromStorageClass(name string) (v1.PersistentVolumeReclaimPolicy, error) {
 	class, err := d.classLister.Get(name)
 	if err != nil {
@@ -198,7 +244,10 @@ func (d *Discoverer) getMountOptionsFromStorageClass(name string) ([]string, err
 	return class.MountOptions, nil
 }
 
-func (d *Discoverer) discoverVolumesAtPath(class string, config common.MountConfig) error {
+// discoverVolumesAtPath creates PVs for the volumes found in the discovery directory of the storage class.
+// If entries is not nil, only the given entries of the directory are looked at, and mountPointMap is
+// the set of current mount points. Otherwise the directory is read and the mount table listed.
+func (d *Discoverer) discoverVolumesAtPath(class string, config common.MountConfig, entries []string, mountPointMap map[string]interface{}) error {
 	klog.V(7).Infof("Discovering volumes at hostpath %q, mount path %q for storage class %q", config.HostDir, config.MountDir, class)
 
 	reclaimPolicy, err := d.getReclaimPolicyFromStorageClass(class)
@@ -210,21 +259,35 @@ func (d *Discoverer) discoverVolumesAtPath(class string, config common.MountConf
 		return fmt.Errorf("unsupported ReclaimPolicy %q from storage class %q, supported policy are Retain and Delete", reclaimPolicy, class)
 	}
 
-	files, err := d.VolUtil.ReadDir(config.MountDir)
-	if err != nil {
-		return fmt.Errorf("error reading directory: %v", err)
-	}
+	fullScan := entries == nil
+	var files []string
+	if fullScan {
+		files, err = d.VolUtil.ReadDir(config.MountDir)
+		if err != nil {
+			return fmt.Errorf("error reading directory: %v", err)
+		}
 
-	// Retrieve list of mount points to iterate through discovered paths (aka files) below
-	mountPoints, err := d.RuntimeConfig.Mounter.List()
-	if err != nil {
-		return fmt.Errorf("error retrieving mountpoints: %v", err)
-	}
-	// Put mount points into set for faster checks below
-	type empty struct{}
-	mountPointMap := make(map[string]interface{})
-	for _, mp := range mountPoints {
-		mountPointMap[mp.Path] = empty{}
+		// Retrieve list of mount points to iterate through discovered paths (aka files) below
+		mountPoints, err := d.RuntimeConfig.Mounter.List()
+		if err != nil {
+			return fmt.Errorf("error retrieving mountpoints: %v", err)
+		}
+		// Put mount points into set for faster checks below
+		type empty struct{}
+		mountPointMap = make(map[string]interface{})
+		for _, mp := range mountPoints {
+			mountPointMap[mp.Path] = empty{}
+		}
+	} else {
+		for _, file := range entries {
+			exists, err := d.VolUtil.Exists(filepath.Join(config.MountDir, file))
+			if err != nil {
+				return fmt.Errorf("error checking directory entry: %v", err)
+			}
+			if exists {
+				files = append(files, file)
+			}
+		}
 	}
 
 	var namePatterns []string
@@ -259,36 +322,78 @@ func (d *Discoverer) discoverVolumesAtPath(class string, config common.MountConf
 			discoErrors = append(discoErrors, err)
 			continue
 		}
-		// Check if PV already exists for it
-		pvName := generatePVName(file, d.Node.Name, class)
+		outsidePath := filepath.Join(config.HostDir, file)
+		pvName, err := d.getPVName(file, class, config, outsidePath, filePath, volMode, mountPointMap)
+		if err != nil {
+			discoErrors = append(discoErrors, err)
+			continue
+		}
+		// Check if PV already exists for it, possibly named after another naming scheme
 		pv, exists := d.Cache.GetPV(pvName)
+		if !exists {
+			if pv, exists = d.lookupPVByPath(class, outsidePath); exists {
+				pvName = pv.Name
+			}
+		}
 		if exists {
+			// Never reconcile the PV of another volume that happens to share the name
+			if pv.Spec.Local != nil && pv.Spec.Local.Path != outsidePath {
+				discoErrors = append(discoErrors, fmt.Errorf("PV %q of path %q already exists for path %q", pvName, outsidePath, pv.Spec.Local.Path))
+				continue
+			}
 			if pv.Spec.VolumeMode != nil && *pv.Spec.VolumeMode == v1.PersistentVolumeBlock &&
 				volMode == v1.PersistentVolumeFilesystem {
 				err := fmt.Errorf("incorrect Volume Mode: PV %q requires block mode but path %q was in fs mode", pvName, filePath)
 				discoErrors = append(discoErrors, err)
 				d.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeFailedDelete, err.Error())
+				continue
+			}
+			if err := d.reconcileCapacity(pv, volMode, outsidePath, filePath, mountPointMap); err != nil {
+				discoErrors = append(discoErrors, err)
 			}
 			continue
 		}
 
 		// Check that the local filePath is not already in use in any other local volume
 		// note: this check relies on the cache only containing PVs from this node and no others
-		outsidePath := filepath.Join(config.HostDir, file)
 		existingPVNames := d.Cache.LookupPVsByPath(outsidePath)
 		if len(existingPVNames) > 0 {
 			klog.Errorf("Volume path already in use: PV %q wants path %q which was already found in %q.", pvName, outsidePath, strings.Join(existingPVNames, ","))
 			continue
 		}
 
-		usejob := false
-		if volMode == v1.PersistentVolumeBlock {
-			usejob = d.RuntimeConfig.UseJobForCleaning
-		}
+		usejob := d.RuntimeConfig.UseJobForCleaningVolume(volMode, config)
 		if d.CleanupTracker.InProgress(pvName, usejob) {
 			klog.Infof("PV %s is still being cleaned, not going to recreate it", pvName)
 			continue
 		}
+		// A volume whose PV is gone before its cleanup completed still holds the data of its
+		// previous user, so clean it up before creating its PV.
+		dirty, err := d.CleanupTracker.DirtyVolumes.IsDirty(outsidePath)
+		if err != nil {
+			discoErrors = append(discoErrors, err)
+			continue
+		}
+		if dirty || d.CleanupTracker.Interrupted(pvName, usejob) {
+			pv := &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: pvName},
+				Spec: v1.PersistentVolumeSpec{
+					StorageClassName: class,
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						Local: &v1.LocalVolumeSource{Path: outsidePath},
+					},
+				},
+			}
+			cleaned, err := d.Deleter.CleanVolume(pv, volMode, filePath, config)
+			if err != nil {
+				discoErrors = append(discoErrors, fmt.Errorf("error cleaning up dirty volume %q: %v", outsidePath, err))
+				continue
+			}
+			if !cleaned {
+				klog.Infof("Volume %q is being cleaned up, not going to create PV %s yet", outsidePath, pvName)
+				continue
+			}
+		}
 
 		// remove old cleanup status
 		_, _, err = d.CleanupTracker.RemoveStatus(pvName, usejob)
@@ -304,6 +409,7 @@ func (d *Discoverer) discoverVolumesAtPath(class string, config common.MountConf
 		}
 
 		var capacityByte int64
+		var annotations map[string]string
 		desiredAccessMode := v1.ReadWriteOnce
 		if config.AccessMode != "" {
 			desiredAccessMode = v1.PersistentVolumeAccessMode(config.AccessMode)
@@ -316,6 +422,14 @@ func (d *Discoverer) discoverVolumesAtPath(class string, config common.MountConf
 				discoErrors = append(discoErrors, fmt.Errorf("path %q block stats error: %v", filePath, err))
 				continue
 			}
+			// Record the identity of the device so that the deleter can make sure it cleans
+			// the same physical disk, even if the symlink is later pointed somewhere else.
+			identity, err := d.VolUtil.GetBlockDeviceIdentity(filePath)
+			if err != nil {
+				discoErrors = append(discoErrors, fmt.Errorf("path %q block identity error: %v", filePath, err))
+				continue
+			}
+			annotations = common.BlockDeviceIdentityToAnnotations(identity)
 			totalCapacityBlockBytes += capacityByte
 			if desireVolumeMode == v1.PersistentVolumeBlock && len(mountOptions) != 0 {
 				klog.Warningf("Path %q will be used to create block volume, "+
@@ -348,19 +462,257 @@ func (d *Discoverer) discoverVolumesAtPath(class string, config common.MountConf
 			continue
 		}
 
-		err = d.createPV(file, class, reclaimPolicy, mountOptions, config, capacityByte, desireVolumeMode, desiredAccessMode, startTime)
+		err = d.createPV(pvName, file, class, reclaimPolicy, mountOptions, config, capacityByte, desireVolumeMode, desiredAccessMode, annotations, startTime)
 		if err != nil {
 			discoErrors = append(discoErrors, err)
 		}
 	}
-	metrics.PersistentVolumeCapacityBytes.WithLabelValues(string(v1.PersistentVolumeBlock)).Set(float64(totalCapacityBlockBytes))
-	metrics.PersistentVolumeCapacityBytes.WithLabelValues(string(v1.PersistentVolumeFilesystem)).Set(float64(totalCapacityFSBytes))
+	if config.MissingVolumePolicy != common.MissingVolumePolicyIgnore {
+		discoErrors = append(discoErrors, d.checkMissingVolumes(class, config, entries, mountPointMap)...)
+	}
+	// The totals are only meaningful when all the entries have been looked at.
+	if fullScan {
+		metrics.PersistentVolumeCapacityBytes.WithLabelValues(string(v1.PersistentVolumeBlock)).Set(float64(totalCapacityBlockBytes))
+		metrics.PersistentVolumeCapacityBytes.WithLabelValues(string(v1.PersistentVolumeFilesystem)).Set(float64(totalCapacityFSBytes))
+	}
 	if discoErrors == nil {
 		return nil
 	}
 	return fmt.Errorf("%d error(s) while discovering volumes: %v", len(discoErrors), discoErrors)
 }
 
+// reconcileCapacity compares the capacity of an existing PV with the current size of its volume,
+// in case the volume has been resized. The capacity of an available PV is updated, the mismatch of
+// a bound PV is reported with an event and a metric since its capacity has been promised to a claim.
+func (d *Discoverer) reconcileCapacity(pv *v1.PersistentVolume, volMode v1.PersistentVolumeMode, outsidePath, filePath string, mountPointMap map[string]interface{}) error {
+	if pv.DeletionTimestamp != nil || (pv.Status.Phase != v1.VolumeAvailable && pv.Status.Phase != v1.VolumeBound) {
+		d.clearCapacityMismatch(pv.Name)
+		return nil
+	}
+
+	var capacityByte int64
+	var err error
+	switch volMode {
+	case v1.PersistentVolumeBlock:
+		capacityByte, err = d.VolUtil.GetBlockCapacityByte(filePath)
+		if err != nil {
+			return fmt.Errorf("path %q block stats error: %v", filePath, err)
+		}
+	case v1.PersistentVolumeFilesystem:
+		// The capacity of an unmounted path would be the one of the filesystem it belongs to.
+		isLikelyMountPoint, err := d.VolUtil.IsLikelyMountPoint(outsidePath, filePath, mountPointMap)
+		if !isLikelyMountPoint || err != nil {
+			return nil
+		}
+		capacityByte, err = d.VolUtil.GetFsCapacityByte(outsidePath, filePath)
+		if err != nil {
+			return fmt.Errorf("path %q fs stats error: %v", filePath, err)
+		}
+	default:
+		return nil
+	}
+
+	capacity := roundDownCapacityPretty(capacityByte)
+	pvCapacity := pv.Spec.Capacity[v1.ResourceStorage]
+	if capacity == pvCapacity.Value() {
+		d.clearCapacityMismatch(pv.Name)
+		return nil
+	}
+
+	if pv.Status.Phase == v1.VolumeBound {
+		if reported, ok := d.capacityMismatches[pv.Name]; !ok || reported != capacity {
+			klog.Warningf("Volume of bound PV %q has been resized from %d to %d bytes", pv.Name, pvCapacity.Value(), capacity)
+			d.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeCapacityMismatch,
+				"Volume has been resized from %s to %s, the PV capacity can't be updated while it is bound",
+				pvCapacity.String(), resource.NewQuantity(capacity, resource.BinarySI).String())
+			d.capacityMismatches[pv.Name] = capacity
+		}
+		metrics.PersistentVolumeCapacityMismatchBytes.WithLabelValues(pv.Name).Set(float64(capacity - pvCapacity.Value()))
+		return nil
+	}
+
+	newPV := pv.DeepCopy()
+	newPV.Spec.Capacity[v1.ResourceStorage] = *resource.NewQuantity(capacity, resource.BinarySI)
+	updatedPV, err := d.APIUtil.UpdatePV(newPV)
+	if apierrors.IsConflict(err) {
+		// The PV has just changed, e.g. it has been bound, it will be looked at again on the next discovery.
+		klog.V(4).Infof("Conflict updating capacity of PV %q: %v", pv.Name, err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error updating capacity of PV %q: %v", pv.Name, err)
+	}
+	d.Cache.UpdatePV(updatedPV)
+	klog.Infof("Updated capacity of PV %q from %d to %d bytes", pv.Name, pvCapacity.Value(), capacity)
+	d.Recorder.Eventf(updatedPV, v1.EventTypeNormal, common.EventVolumeResized, "Capacity updated from %s to %s",
+		pvCapacity.String(), updatedPV.Spec.Capacity.Storage().String())
+	d.clearCapacityMismatch(pv.Name)
+	return nil
+}
+
+// checkMissingVolumes looks for the PVs of the storage class whose backing path is gone or is no longer
+// a mount point, e.g. because the disk died. They are reported with an event and a metric, and the
+// Available ones are deleted if the policy of the class is Delete, so that no pod gets scheduled onto them.
+// If entries is not nil, only the PVs of the given entries of the discovery directory are looked at.
+func (d *Discoverer) checkMissingVolumes(class string, config common.MountConfig, entries []string, mountPointMap map[string]interface{}) []error {
+	var errs []error
+	for _, pv := range d.Cache.ListPVs() {
+		if pv.Spec.StorageClassName != class || pv.Spec.Local == nil {
+			continue
+		}
+		relativePath, err := filepath.Rel(config.HostDir, pv.Spec.Local.Path)
+		if err != nil || strings.HasPrefix(relativePath, "..") {
+			// The PV was created for another discovery directory.
+			continue
+		}
+		if entries != nil && !slices.Contains(entries, relativePath) {
+			continue
+		}
+		if pv.DeletionTimestamp != nil {
+			d.clearMissingVolume(pv.Name)
+			continue
+		}
+
+		filePath := filepath.Join(config.MountDir, relativePath)
+		reason, err := d.getMissingReason(pv.Spec.Local.Path, filePath, mountPointMap)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if reason == "" {
+			d.clearMissingVolume(pv.Name)
+			continue
+		}
+
+		if _, ok := d.missingVolumes[pv.Name]; !ok {
+			klog.Warningf("Backing path of PV %q is missing: %s", pv.Name, reason)
+			d.Recorder.Eventf(pv, v1.EventTypeWarning, common.EventVolumeMissing, "Backing path is missing: %s", reason)
+			d.missingVolumes[pv.Name] = struct{}{}
+		}
+		metrics.PersistentVolumeMissing.WithLabelValues(pv.Name).Set(1)
+
+		if config.MissingVolumePolicy != common.MissingVolumePolicyDelete || pv.Status.Phase != v1.VolumeAvailable {
+			continue
+		}
+		klog.Infof("Deleting available PV %q whose backing path is missing", pv.Name)
+		if err := d.APIUtil.DeletePV(pv.Name); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("error deleting PV %q with missing backing path: %v", pv.Name, err))
+			continue
+		}
+		d.clearMissingVolume(pv.Name)
+	}
+	return errs
+}
+
+// getMissingReason returns why the backing path of a PV is considered missing, or an empty string
+// if it is present. A directory is only present if it is still a mount point.
+func (d *Discoverer) getMissingReason(outsidePath, filePath string, mountPointMap map[string]interface{}) (string, error) {
+	exists, err := d.VolUtil.Exists(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error checking backing path %q: %v", filePath, err)
+	}
+	if !exists {
+		return fmt.Sprintf("path %q no longer exists", filePath), nil
+	}
+	volMode, err := common.GetVolumeMode(d.VolUtil, filePath)
+	if err != nil {
+		// e.g. a symlink to a device which is gone
+		return err.Error(), nil
+	}
+	if volMode == v1.PersistentVolumeFilesystem {
+		if isLikelyMountPoint, err := d.VolUtil.IsLikelyMountPoint(outsidePath, filePath, mountPointMap); !isLikelyMountPoint || err != nil {
+			return fmt.Sprintf("path %q is no longer a mount point", filePath), nil
+		}
+	}
+	return "", nil
+}
+
+// pruneReportedVolumes forgets the capacity mismatches and the missing volumes of the PVs which are
+// no longer looked at by the discovery, because they have been deleted or their storage class is no
+// longer configured.
+func (d *Discoverer) pruneReportedVolumes() {
+	isDiscovered := func(pvName string) (common.MountConfig, bool) {
+		pv, exists := d.Cache.GetPV(pvName)
+		if !exists {
+			return common.MountConfig{}, false
+		}
+		config, ok := d.DiscoveryMap[pv.Spec.StorageClassName]
+		return config, ok
+	}
+	for pvName := range d.capacityMismatches {
+		if _, ok := isDiscovered(pvName); !ok {
+			d.clearCapacityMismatch(pvName)
+		}
+	}
+	for pvName := range d.missingVolumes {
+		if config, ok := isDiscovered(pvName); !ok || config.MissingVolumePolicy == common.MissingVolumePolicyIgnore {
+			d.clearMissingVolume(pvName)
+		}
+	}
+}
+
+func (d *Discoverer) clearCapacityMismatch(pvName string) {
+	if _, ok := d.capacityMismatches[pvName]; ok {
+		delete(d.capacityMismatches, pvName)
+		metrics.PersistentVolumeCapacityMismatchBytes.DeleteLabelValues(pvName)
+	}
+}
+
+func (d *Discoverer) clearMissingVolume(pvName string) {
+	if _, ok := d.missingVolumes[pvName]; ok {
+		delete(d.missingVolumes, pvName)
+		metrics.PersistentVolumeMissing.DeleteLabelValues(pvName)
+	}
+}
+
+// getPVName returns the name of the PV of the given discovery directory entry, according to the naming
+// scheme of the storage class.
+func (d *Discoverer) getPVName(file, class string, config common.MountConfig, outsidePath, filePath string, volMode v1.PersistentVolumeMode, mountPointMap map[string]interface{}) (string, error) {
+	if config.PVNamingScheme != common.PVNamingSchemeDeviceIdentity {
+		return generatePVName(file, d.Node.Name, class), nil
+	}
+
+	var identity string
+	switch volMode {
+	case v1.PersistentVolumeBlock:
+		id, err := d.VolUtil.GetBlockDeviceIdentity(filePath)
+		if err != nil {
+			return "", fmt.Errorf("path %q block identity error: %v", filePath, err)
+		}
+		if id.WWN != "" {
+			identity = "wwn:" + id.WWN
+		} else if id.Serial != "" {
+			identity = "serial:" + id.Serial
+		}
+		// The partitions of a disk share its WWN and serial.
+		if identity != "" && id.Partition != "" {
+			identity += ",partition:" + id.Partition
+		}
+	case v1.PersistentVolumeFilesystem:
+		// The filesystem of an unmounted path would be the one of the discovery directory.
+		if isLikelyMountPoint, err := d.VolUtil.IsLikelyMountPoint(outsidePath, filePath, mountPointMap); isLikelyMountPoint && err == nil {
+			uuid, err := d.VolUtil.GetFsUUID(filePath)
+			if err != nil {
+				return "", fmt.Errorf("path %q filesystem UUID error: %v", filePath, err)
+			}
+			if uuid != "" {
+				identity = "fsuuid:" + uuid
+			}
+		}
+	}
+	return generateStablePVName(identity, file, d.Node.Name, class), nil
+}
+
+// lookupPVByPath returns the PV of the storage class created for the given host path, whatever its name.
+func (d *Discoverer) lookupPVByPath(class, outsidePath string) (*v1.PersistentVolume, bool) {
+	for _, pvName := range d.Cache.LookupPVsByPath(outsidePath) {
+		if pv, exists := d.Cache.GetPV(pvName); exists && pv.Spec.StorageClassName == class {
+			return pv, true
+		}
+	}
+	return nil, false
+}
+
 func generatePVName(file, node, class string) string {
 	h := fnv.New32a()
 	h.Write([]byte(file))
@@ -370,8 +722,24 @@ func generatePVName(file, node, class string) string {
 	return fmt.Sprintf("local-pv-%x", h.Sum32())
 }
 
-func (d *Discoverer) createPV(file, class string, reclaimPolicy v1.PersistentVolumeReclaimPolicy, mountOptions []string, config common.MountConfig, capacityByte int64, volMode v1.PersistentVolumeMode, accessMode v1.PersistentVolumeAccessMode, startTime time.Time) error {
-	pvName := generatePVName(file, d.Node.Name, class)
+// generateStablePVName returns a PV name derived from the identity of the device. The identity is
+// not unique on its own: bind mounts of one disk share its filesystem UUID, and cloned disks or
+// disks identified by their serial only may share it across nodes. It is therefore hashed along
+// with the node and the file, i.e. the path relative to the host dir, so that the name only
+// changes when another device shows up at the path. If the identity is unknown, the file, node
+// and class are used instead, with the same collision-resistant hash.
+func generateStablePVName(identity, file, node, class string) string {
+	h := sha256.New()
+	if identity != "" {
+		h.Write([]byte(identity + "\x00" + node + "\x00" + file))
+	} else {
+		h.Write([]byte(file + "\x00" + node + "\x00" + class))
+	}
+	// The first 128 bits of the SHA-256 hash
+	return fmt.Sprintf("local-pv-%x", h.Sum(nil)[:16])
+}
+
+func (d *Discoverer) createPV(pvName, file, class string, reclaimPolicy v1.PersistentVolumeReclaimPolicy, mountOptions []string, config common.MountConfig, capacityByte int64, volMode v1.PersistentVolumeMode, accessMode v1.PersistentVolumeAccessMode, annotations map[string]string, startTime time.Time) error {
 	outsidePath := filepath.Join(config.HostDir, file)
 
 	klog.Infof("Found new volume at host path %q with capacity %d, creating Local PV %q, required volumeMode %q",
@@ -387,6 +755,7 @@ func (d *Discoverer) createPV(file, class string, reclaimPolicy v1.PersistentVol
 		VolumeMode:      volMode,
 		AccessMode:      accessMode,
 		Labels:          d.Labels,
+		Annotations:     annotations,
 		MountOptions:    mountOptions,
 		SetPVOwnerRef:   d.SetPVOwnerRef,
 		OwnerReference:  d.ownerReference,
@@ -17,16 +17,23 @@ limitations under the License.
 package discovery
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 
 	"k8s.io/klog/v2"
 	esUtil "sigs.k8s.io/sig-storage-lib-external-provisioner/v6/util"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/cache"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/deleter"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/metrics"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/util"
 
 	v1 "k8s.io/api/core/v1"
@@ -38,6 +45,7 @@ import (
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes/fake"
 	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/mount"
 )
 
@@ -239,6 +247,41 @@ func TestDiscoverVolumes_NewVolumesLater(t *testing.T) {
 	verifyCreatedPVs(t, test)
 }
 
+func TestDiscoverVolumes_OnlyGivenEntries(t *testing.T) {
+	vols := map[string][]*util.FakeDirEntry{
+		"dir1": {
+			{Name: "mount1", Hash: 0xaaaafef5, VolumeType: util.FakeEntryFile},
+		},
+	}
+	test := &testConfig{
+		dirLayout:       vols,
+		expectedVolumes: vols,
+	}
+	d := testSetup(t, test, false, false)
+
+	d.DiscoverLocalVolumes()
+
+	verifyCreatedPVs(t, test)
+
+	// Only one of the new mount points is reported, and a removed entry is ignored
+	newVols := map[string][]*util.FakeDirEntry{
+		"dir1": {
+			{Name: "mount3", Hash: 0xf34b8003, VolumeType: util.FakeEntryFile},
+			{Name: "mount4", Hash: 0x6ccd1f2e, VolumeType: util.FakeEntryFile},
+		},
+	}
+	test.volUtil.AddNewDirEntries(testMountDir, newVols)
+	test.expectedVolumes = map[string][]*util.FakeDirEntry{"dir1": newVols["dir1"][:1]}
+
+	mountPoints := map[string]interface{}{}
+	for _, vol := range newVols["dir1"] {
+		mountPoints[filepath.Join(testMountDir, "dir1", vol.Name)] = struct{}{}
+	}
+	d.DiscoverVolumes(map[string][]string{"sc1": {"mount3", "removed"}}, mountPoints)
+
+	verifyCreatedPVs(t, test)
+}
+
 func TestDiscoverVolumes_CreatePVFails(t *testing.T) {
 	vols := map[string][]*util.FakeDirEntry{
 		"dir1": {
@@ -350,6 +393,97 @@ func TestDiscoverVolumes_CleaningInProgress(t *testing.T) {
 	verifyCreatedPVs(t, test)
 }
 
+func TestDiscoverVolumes_CleaningInterrupted(t *testing.T) {
+	vols := map[string][]*util.FakeDirEntry{
+		"dir1": {
+			{Name: "mount1", Hash: 0xaaaafef5, VolumeType: util.FakeEntryFile, Capacity: 100 * 1024},
+			{Name: "symlink2", Hash: 0x23645a36, VolumeType: util.FakeEntryBlock, Capacity: 100 * 1024 * 1024},
+		},
+	}
+
+	// Don't expect dir1/symlink2 to be created
+	expectedVols := map[string][]*util.FakeDirEntry{
+		"dir1": {
+			{Name: "mount1", Hash: 0xaaaafef5, VolumeType: util.FakeEntryFile, Capacity: 100 * 1024},
+		},
+	}
+	test := &testConfig{
+		dirLayout:       vols,
+		expectedVolumes: expectedVols,
+	}
+	d := testSetup(t, test, false, false)
+
+	// Mark dir1/symlink2 PV as being cleaned before a restart of the provisioner.
+	journal, err := deleter.NewCleanupJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	procTable, err := deleter.NewJournaledProcTable(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := procTable.MarkRunning(getPVName(vols["dir1"][1])); err != nil {
+		t.Fatal(err)
+	}
+	test.cleanupTracker.ProcTable, err = deleter.NewJournaledProcTable(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.DiscoverLocalVolumes()
+	verifyCreatedPVs(t, test)
+}
+
+func TestDiscoverVolumes_DirtyVolume(t *testing.T) {
+	vols := map[string][]*util.FakeDirEntry{
+		"dir1": {
+			{Name: "mount1", Hash: 0xaaaafef5, VolumeType: util.FakeEntryFile, Capacity: 100 * 1024},
+			{Name: "mount2", Hash: 0x79412c38, VolumeType: util.FakeEntryFile, Capacity: 100 * 1024},
+		},
+	}
+	test := &testConfig{
+		dirLayout: vols,
+		// Don't expect dir1/mount2 to be created before it is cleaned up
+		expectedVolumes: map[string][]*util.FakeDirEntry{
+			"dir1": {
+				{Name: "mount1", Hash: 0xaaaafef5, VolumeType: util.FakeEntryFile, Capacity: 100 * 1024},
+			},
+		},
+	}
+	d := testSetup(t, test, false, false)
+
+	dirtyVolumes, err := deleter.NewDirtyVolumes(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.cleanupTracker.DirtyVolumes = dirtyVolumes
+	dirtyPath := filepath.Join(testHostDir, "dir1", "mount2")
+	if err := dirtyVolumes.Mark(dirtyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	d.DiscoverLocalVolumes()
+	verifyCreatedPVs(t, test)
+
+	pvName := getPVName(vols["dir1"][1])
+	err = wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		return !test.cleanupTracker.InProgress(pvName, false), nil
+	})
+	if err != nil {
+		t.Fatalf("Cleanup of dirty volume did not complete: %v", err)
+	}
+
+	// Expect dir1/mount2 to be created once it is cleaned up
+	test.expectedVolumes = map[string][]*util.FakeDirEntry{
+		"dir1": {vols["dir1"][1]},
+	}
+	d.DiscoverLocalVolumes()
+	verifyCreatedPVs(t, test)
+	if dirty, err := dirtyVolumes.IsDirty(dirtyPath); err != nil || dirty {
+		t.Errorf("Expected volume %q to be clean, got dirty %v, err %v", dirtyPath, dirty, err)
+	}
+}
+
 func TestDiscoverVolumes_InvalidMode(t *testing.T) {
 	vols := map[string][]*util.FakeDirEntry{
 		"dir1": {
@@ -382,6 +516,444 @@ func TestDiscoverVolumes_InvalidMode(t *testing.T) {
 	verifyCreatedPVs(t, test)
 }
 
+func TestDiscoverVolumes_BlockDeviceIdentity(t *testing.T) {
+	vols := map[string][]*util.FakeDirEntry{
+		"dir2": {
+			{Name: "symlink1", Hash: 0x55d5adba, VolumeType: util.FakeEntryBlock,
+				Identity: &util.BlockDeviceIdentity{WWN: "0x5000c500a1b2c3d4", Serial: "ZA1234", PartUUID: "8f3d2c1a-0001"}},
+			{Name: "symlink2", Hash: 0x226458a3, VolumeType: util.FakeEntryBlock},
+		},
+	}
+	test := &testConfig{
+		dirLayout:       vols,
+		expectedVolumes: vols,
+	}
+	d := testSetup(t, test, false, false)
+
+	d.DiscoverLocalVolumes()
+
+	pv, exists := test.cache.GetPV(getPVName(vols["dir2"][0]))
+	if !exists {
+		t.Fatalf("PV for %q was not created", vols["dir2"][0].Name)
+	}
+	expectedAnnotations := map[string]string{
+		common.AnnDeviceWWN:      "0x5000c500a1b2c3d4",
+		common.AnnDeviceSerial:   "ZA1234",
+		common.AnnDevicePartUUID: "8f3d2c1a-0001",
+	}
+	for key, value := range expectedAnnotations {
+		if pv.Annotations[key] != value {
+			t.Errorf("Expected annotation %s=%q, got %q", key, value, pv.Annotations[key])
+		}
+	}
+
+	pv, exists = test.cache.GetPV(getPVName(vols["dir2"][1]))
+	if !exists {
+		t.Fatalf("PV for %q was not created", vols["dir2"][1].Name)
+	}
+	if id := common.BlockDeviceIdentityFromAnnotations(pv); id != nil {
+		t.Errorf("Expected no device identity for a device without identifiers, got %+v", id)
+	}
+	verifyCreatedPVs(t, test)
+}
+
+func TestDiscoverVolumes_ResizedAvailableVolume(t *testing.T) {
+	vols := map[string][]*util.FakeDirEntry{
+		"dir1": {
+			{Name: "mount1", Hash: 0xaaaafef5, VolumeType: util.FakeEntryFile, Capacity: 100 * esUtil.GiB},
+		},
+		"dir2": {
+			{Name: "symlink1", Hash: 0x55d5adba, VolumeType: util.FakeEntryBlock, Capacity: 100 * esUtil.GiB},
+		},
+	}
+	test := &testConfig{
+		dirLayout:       vols,
+		expectedVolumes: vols,
+	}
+	d := testSetup(t, test, false, false)
+
+	d.DiscoverLocalVolumes()
+	verifyCreatedPVs(t, test)
+
+	for _, files := range vols {
+		setPVPhase(test.cache, getPVName(files[0]), v1.VolumeAvailable)
+		files[0].Capacity = 200 * esUtil.GiB
+	}
+
+	d.DiscoverLocalVolumes()
+	if err := d.Readyz.Check(nil); err != nil {
+		t.Errorf("Expected discoverer to be ready, got %v", err)
+	}
+
+	for _, files := range vols {
+		pvName := getPVName(files[0])
+		pv, err := test.client.CoreV1().PersistentVolumes().Get(context.TODO(), pvName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Error getting PV %q: %v", pvName, err)
+		}
+		if capacity := pv.Spec.Capacity.Storage().Value(); capacity != 200*esUtil.GiB {
+			t.Errorf("Expected capacity of PV %q to be updated to %d, got %d", pvName, 200*esUtil.GiB, capacity)
+		}
+		cachedPV, _ := test.cache.GetPV(pvName)
+		if capacity := cachedPV.Spec.Capacity.Storage().Value(); capacity != 200*esUtil.GiB {
+			t.Errorf("Expected capacity of cached PV %q to be updated to %d, got %d", pvName, 200*esUtil.GiB, capacity)
+		}
+	}
+	recorder := d.Recorder.(*record.FakeRecorder)
+	for range vols {
+		select {
+		case event := <-recorder.Events:
+			if !strings.Contains(event, common.EventVolumeResized) {
+				t.Errorf("Expected %s event, got %q", common.EventVolumeResized, event)
+			}
+		default:
+			t.Errorf("Expected %s event", common.EventVolumeResized)
+		}
+	}
+}
+
+func TestDiscoverVolumes_ResizedBoundVolume(t *testing.T) {
+	vols := map[string][]*util.FakeDirEntry{
+		"dir2": {
+			{Name: "symlink1", Hash: 0x55d5adba, VolumeType: util.FakeEntryBlock, Capacity: 100 * esUtil.GiB},
+		},
+	}
+	test := &testConfig{
+		dirLayout:       vols,
+		expectedVolumes: vols,
+	}
+	d := testSetup(t, test, false, false)
+
+	d.DiscoverLocalVolumes()
+	verifyCreatedPVs(t, test)
+
+	pvName := getPVName(vols["dir2"][0])
+	setPVPhase(test.cache, pvName, v1.VolumeBound)
+	vols["dir2"][0].Capacity = 200 * esUtil.GiB
+
+	// The mismatch is only reported once
+	d.DiscoverLocalVolumes()
+	d.DiscoverLocalVolumes()
+
+	pv, _ := test.cache.GetPV(pvName)
+	if capacity := pv.Spec.Capacity.Storage().Value(); capacity != 100*esUtil.GiB {
+		t.Errorf("Expected capacity of bound PV %q to be left at %d, got %d", pvName, 100*esUtil.GiB, capacity)
+	}
+	recorder := d.Recorder.(*record.FakeRecorder)
+	if len(recorder.Events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, common.EventVolumeCapacityMismatch) {
+		t.Errorf("Expected %s event, got %q", common.EventVolumeCapacityMismatch, event)
+	}
+	if mismatch := getCapacityMismatchMetric(t, pvName); mismatch != float64(100*esUtil.GiB) {
+		t.Errorf("Expected capacity mismatch metric of %d, got %v", 100*esUtil.GiB, mismatch)
+	}
+
+	// The mismatch is cleared once the PV is released
+	setPVPhase(test.cache, pvName, v1.VolumeReleased)
+	d.DiscoverLocalVolumes()
+	if mismatch := getCapacityMismatchMetric(t, pvName); mismatch != 0 {
+		t.Errorf("Expected no capacity mismatch metric, got %v", mismatch)
+	}
+}
+
+func TestDiscoverVolumes_ResizedBoundVolumeUnconfigured(t *testing.T) {
+	vols := map[string][]*util.FakeDirEntry{
+		"dir2": {
+			{Name: "symlink1", Hash: 0x55d5adba, VolumeType: util.FakeEntryBlock, Capacity: 100 * esUtil.GiB},
+		},
+	}
+	test := &testConfig{
+		dirLayout:       vols,
+		expectedVolumes: vols,
+	}
+	d := testSetup(t, test, false, false)
+
+	d.DiscoverLocalVolumes()
+	verifyCreatedPVs(t, test)
+
+	pvName := getPVName(vols["dir2"][0])
+	setPVPhase(test.cache, pvName, v1.VolumeBound)
+	vols["dir2"][0].Capacity = 200 * esUtil.GiB
+	d.DiscoverLocalVolumes()
+	if mismatch := getCapacityMismatchMetric(t, pvName); mismatch != float64(100*esUtil.GiB) {
+		t.Errorf("Expected capacity mismatch metric of %d, got %v", 100*esUtil.GiB, mismatch)
+	}
+
+	// The storage class of the PV is removed from the configuration, so the PV is no longer looked at
+	d.DiscoveryMap = map[string]common.MountConfig{"sc1": scMapping["sc1"]}
+	d.DiscoverLocalVolumes()
+	if mismatch := getCapacityMismatchMetric(t, pvName); mismatch != 0 {
+		t.Errorf("Expected no capacity mismatch metric, got %v", mismatch)
+	}
+	if _, ok := d.capacityMismatches[pvName]; ok {
+		t.Errorf("Expected capacity mismatch of PV %q to be forgotten", pvName)
+	}
+}
+
+func TestDiscoverVolumes_MissingVolume(t *testing.T) {
+	vols := map[string][]*util.FakeDirEntry{
+		"dir1": {
+			{Name: "mount1", Hash: 0xaaaafef5, VolumeType: util.FakeEntryFile},
+			{Name: "mount2", Hash: 0x79412c38, VolumeType: util.FakeEntryFile},
+		},
+		"dir2": {
+			{Name: "symlink1", Hash: 0x55d5adba, VolumeType: util.FakeEntryBlock},
+		},
+	}
+	test := &testConfig{
+		dirLayout:       vols,
+		expectedVolumes: vols,
+	}
+	d := testSetup(t, test, false, false)
+
+	d.DiscoverLocalVolumes()
+	verifyCreatedPVs(t, test)
+
+	// The block device is removed, and mount2 is unmounted
+	test.volUtil.RemoveDirEntry(testMountDir, "dir2", "symlink1")
+	fm := d.Mounter.(*mount.FakeMounter)
+	fm.MountPoints = slices.DeleteFunc(fm.MountPoints, func(mp mount.MountPoint) bool {
+		return mp.Path == filepath.Join(testMountDir, "dir1", "mount2")
+	})
+
+	// The missing volumes are only reported once
+	d.DiscoverLocalVolumes()
+	d.DiscoverLocalVolumes()
+
+	missingPVs := []string{getPVName(vols["dir1"][1]), getPVName(vols["dir2"][0])}
+	recorder := d.Recorder.(*record.FakeRecorder)
+	if len(recorder.Events) != len(missingPVs) {
+		t.Fatalf("Expected %d events, got %d", len(missingPVs), len(recorder.Events))
+	}
+	for range missingPVs {
+		if event := <-recorder.Events; !strings.Contains(event, common.EventVolumeMissing) {
+			t.Errorf("Expected %s event, got %q", common.EventVolumeMissing, event)
+		}
+	}
+	for _, pvName := range missingPVs {
+		if _, exists := test.cache.GetPV(pvName); !exists {
+			t.Errorf("Expected PV %q to be kept", pvName)
+		}
+		if missing := getPVMissingMetric(t, pvName); missing != 1 {
+			t.Errorf("Expected missing metric of PV %q to be 1, got %v", pvName, missing)
+		}
+	}
+	if missing := getPVMissingMetric(t, getPVName(vols["dir1"][0])); missing != 0 {
+		t.Errorf("Expected no missing metric for a present volume, got %v", missing)
+	}
+
+	// The volume is mounted again
+	fm.MountPoints = append(fm.MountPoints, mount.MountPoint{Path: filepath.Join(testMountDir, "dir1", "mount2")})
+	d.DiscoverLocalVolumes()
+	if missing := getPVMissingMetric(t, getPVName(vols["dir1"][1])); missing != 0 {
+		t.Errorf("Expected missing metric to be cleared, got %v", missing)
+	}
+}
+
+func TestDiscoverVolumes_MissingVolumeDeletePolicy(t *testing.T) {
+	vols := map[string][]*util.FakeDirEntry{
+		"dir2": {
+			{Name: "symlink1", Hash: 0x55d5adba, VolumeType: util.FakeEntryBlock},
+			{Name: "symlink2", Hash: 0x226458a3, VolumeType: util.FakeEntryBlock},
+		},
+	}
+	test := &testConfig{
+		dirLayout:       vols,
+		expectedVolumes: vols,
+	}
+	d := testSetup(t, test, false, false)
+	config := scMapping["sc2"]
+	config.MissingVolumePolicy = common.MissingVolumePolicyDelete
+	d.DiscoveryMap = map[string]common.MountConfig{"sc2": config}
+
+	d.DiscoverLocalVolumes()
+	verifyCreatedPVs(t, test)
+
+	availablePV, boundPV := getPVName(vols["dir2"][0]), getPVName(vols["dir2"][1])
+	setPVPhase(test.cache, availablePV, v1.VolumeAvailable)
+	setPVPhase(test.cache, boundPV, v1.VolumeBound)
+	test.volUtil.RemoveDirEntry(testMountDir, "dir2", "symlink1")
+	test.volUtil.RemoveDirEntry(testMountDir, "dir2", "symlink2")
+
+	d.DiscoverLocalVolumes()
+
+	if _, exists := test.cache.GetPV(availablePV); exists {
+		t.Errorf("Expected available PV %q to be deleted", availablePV)
+	}
+	if missing := getPVMissingMetric(t, availablePV); missing != 0 {
+		t.Errorf("Expected no missing metric for deleted PV %q, got %v", availablePV, missing)
+	}
+	if _, exists := test.cache.GetPV(boundPV); !exists {
+		t.Errorf("Expected bound PV %q to be kept", boundPV)
+	}
+	if missing := getPVMissingMetric(t, boundPV); missing != 1 {
+		t.Errorf("Expected missing metric of bound PV %q to be 1, got %v", boundPV, missing)
+	}
+}
+
+func TestDiscoverVolumes_DeviceIdentityNames(t *testing.T) {
+	vols := map[string][]*util.FakeDirEntry{
+		"dir1": {
+			{Name: "mount1", VolumeType: util.FakeEntryFile, FsUUID: "2f1c5e0a-6d1b-4c8e-9a57-0c1d2e3f4a5b"},
+			// Not on a block device known to udev
+			{Name: "mount2", VolumeType: util.FakeEntryFile},
+		},
+		"dir2": {
+			{Name: "symlink1", VolumeType: util.FakeEntryBlock,
+				Identity: &util.BlockDeviceIdentity{WWN: "naa.5000c500a1b2c3d4", Serial: "ZA1234"}},
+			{Name: "symlink2", VolumeType: util.FakeEntryBlock,
+				Identity: &util.BlockDeviceIdentity{WWN: "naa.5000c500a1b2c3d4", Serial: "ZA1234", Partition: "1"}},
+			{Name: "symlink3", VolumeType: util.FakeEntryBlock,
+				Identity: &util.BlockDeviceIdentity{Serial: "ZB9876"}},
+		},
+	}
+	test := &testConfig{
+		dirLayout: vols,
+	}
+	d := testSetup(t, test, false, false)
+	d.DiscoveryMap = map[string]common.MountConfig{}
+	for class, config := range scMapping {
+		config.PVNamingScheme = common.PVNamingSchemeDeviceIdentity
+		d.DiscoveryMap[class] = config
+	}
+
+	d.DiscoverLocalVolumes()
+
+	expectedNames := map[string]string{
+		generateStablePVName("fsuuid:2f1c5e0a-6d1b-4c8e-9a57-0c1d2e3f4a5b", "mount1", testNodeName, ""): "dir1/mount1",
+		generateStablePVName("", "mount2", testNodeName, "sc1"):                                         "dir1/mount2",
+		generateStablePVName("wwn:naa.5000c500a1b2c3d4", "symlink1", testNodeName, ""):                  "dir2/symlink1",
+		generateStablePVName("wwn:naa.5000c500a1b2c3d4,partition:1", "symlink2", testNodeName, ""):      "dir2/symlink2",
+		generateStablePVName("serial:ZB9876", "symlink3", testNodeName, ""):                             "dir2/symlink3",
+	}
+	createdPVs := getAndResetCreatedPVs(test.client, test.cache)
+	if len(createdPVs) != len(expectedNames) {
+		t.Errorf("Expected %d created PVs, got %d", len(expectedNames), len(createdPVs))
+	}
+	for pvName, path := range expectedNames {
+		pv, found := createdPVs[pvName]
+		if !found {
+			t.Errorf("Expected PV %q to be created for %q", pvName, path)
+			continue
+		}
+		if expectedPath := filepath.Join(testHostDir, path); pv.Spec.Local.Path != expectedPath {
+			t.Errorf("Expected path %q for PV %q, got %q", expectedPath, pvName, pv.Spec.Local.Path)
+		}
+	}
+}
+
+func TestDiscoverVolumes_DeviceIdentityNamesBindMounts(t *testing.T) {
+	// Two bind mounts of directories of the same disk share its filesystem UUID
+	vols := map[string][]*util.FakeDirEntry{
+		"dir1": {
+			{Name: "mount1", VolumeType: util.FakeEntryFile, FsUUID: "2f1c5e0a-6d1b-4c8e-9a57-0c1d2e3f4a5b"},
+			{Name: "mount2", VolumeType: util.FakeEntryFile, FsUUID: "2f1c5e0a-6d1b-4c8e-9a57-0c1d2e3f4a5b"},
+		},
+	}
+	test := &testConfig{
+		dirLayout: vols,
+	}
+	d := testSetup(t, test, false, false)
+	config := scMapping["sc1"]
+	config.PVNamingScheme = common.PVNamingSchemeDeviceIdentity
+	d.DiscoveryMap = map[string]common.MountConfig{"sc1": config}
+
+	d.DiscoverLocalVolumes()
+
+	createdPVs := getAndResetCreatedPVs(test.client, test.cache)
+	paths := map[string]string{}
+	for pvName, pv := range createdPVs {
+		paths[pv.Spec.Local.Path] = pvName
+	}
+	for _, path := range []string{"dir1/mount1", "dir1/mount2"} {
+		if _, found := paths[filepath.Join(testHostDir, path)]; !found {
+			t.Errorf("Expected a PV to be created for %q, got %v", path, paths)
+		}
+	}
+	if err := d.Readyz.Check(nil); err != nil {
+		t.Errorf("Expected discoverer to be ready, got %v", err)
+	}
+
+	// Discovering the volumes again finds both PVs
+	d.DiscoverLocalVolumes()
+	if createdPVs := getAndResetCreatedPVs(test.client, test.cache); len(createdPVs) != 0 {
+		t.Errorf("Expected no PV to be created, got %v", createdPVs)
+	}
+	if err := d.Readyz.Check(nil); err != nil {
+		t.Errorf("Expected discoverer to be ready, got %v", err)
+	}
+}
+
+func TestDiscoverVolumes_DeviceIdentityNamesKeepLegacyPVs(t *testing.T) {
+	vols := map[string][]*util.FakeDirEntry{
+		"dir2": {
+			{Name: "symlink1", Hash: 0x55d5adba, VolumeType: util.FakeEntryBlock,
+				Identity: &util.BlockDeviceIdentity{WWN: "naa.5000c500a1b2c3d4"}},
+		},
+	}
+	test := &testConfig{
+		dirLayout:       vols,
+		expectedVolumes: vols,
+	}
+	d := testSetup(t, test, false, false)
+
+	d.DiscoverLocalVolumes()
+	verifyCreatedPVs(t, test)
+
+	// The PV created under the legacy scheme is still recognized once the scheme is changed
+	config := scMapping["sc2"]
+	config.PVNamingScheme = common.PVNamingSchemeDeviceIdentity
+	d.DiscoveryMap = map[string]common.MountConfig{"sc2": config}
+	d.DiscoverLocalVolumes()
+
+	if createdPVs := getAndResetCreatedPVs(test.client, test.cache); len(createdPVs) != 0 {
+		t.Errorf("Expected no PV to be created, got %v", createdPVs)
+	}
+	if err := d.Readyz.Check(nil); err != nil {
+		t.Errorf("Expected discoverer to be ready, got %v", err)
+	}
+}
+
+// getPVMissingMetric returns the missing metric of the PV, or 0 if there is none.
+func getPVMissingMetric(t *testing.T, pvName string) float64 {
+	return getPVGaugeMetric(t, metrics.PersistentVolumeMissing, pvName)
+}
+
+// setPVPhase updates the phase of the cached PV, like the populator does when the PV changes.
+func setPVPhase(volumeCache *cache.VolumeCache, pvName string, phase v1.PersistentVolumePhase) {
+	pv, _ := volumeCache.GetPV(pvName)
+	pv = pv.DeepCopy()
+	pv.Status.Phase = phase
+	volumeCache.UpdatePV(pv)
+}
+
+// getCapacityMismatchMetric returns the capacity mismatch metric of the PV, or 0 if there is none.
+func getCapacityMismatchMetric(t *testing.T, pvName string) float64 {
+	return getPVGaugeMetric(t, metrics.PersistentVolumeCapacityMismatchBytes, pvName)
+}
+
+// getPVGaugeMetric returns the value of the gauge for the PV, or 0 if there is none.
+func getPVGaugeMetric(t *testing.T, gauge *prometheus.GaugeVec, pvName string) float64 {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(gauge)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Error gathering metrics: %v", err)
+	}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "persistentvolume" && label.GetValue() == pvName {
+					return metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
 func testSetup(t *testing.T, test *testConfig, useAlphaAPI, setPVOwnerRef bool) *Discoverer {
 	if test.cache == nil {
 		test.cache = cache.NewVolumeCache()
@@ -453,9 +1025,10 @@ func testSetup(t *testing.T, test *testConfig, useAlphaAPI, setPVOwnerRef bool)
 		Name:            testProvisionerName,
 		Mounter:         fm,
 		Client:          test.client,
+		Recorder:        record.NewFakeRecorder(100),
 		InformerFactory: informers.NewSharedInformerFactory(test.client, 0),
 	}
-	d, err := NewDiscoverer(runConfig, test.cleanupTracker)
+	d, err := NewDiscoverer(runConfig, test.cleanupTracker, deleter.NewDeleter(runConfig, test.cleanupTracker))
 	if err != nil {
 		t.Fatalf("Error setting up test discoverer: %v", err)
 	}
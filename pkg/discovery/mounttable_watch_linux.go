@@ -0,0 +1,63 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+const (
+	mountInfoPath = "/proc/self/mountinfo"
+	// mountTablePollTimeoutMs bounds how long a stop request can go unnoticed
+	mountTablePollTimeoutMs = 1000
+)
+
+// watchMountTable calls changed every time the mount table changes, until stopCh is closed.
+// The kernel reports mount table changes as POLLPRI on the mountinfo file.
+func watchMountTable(stopCh <-chan struct{}, changed func()) {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		klog.Errorf("Error watching mount table, mount changes will only be seen by full discoveries: %v", err)
+		return
+	}
+	defer f.Close()
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLPRI}}
+		n, err := unix.Poll(fds, mountTablePollTimeoutMs)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			klog.Errorf("Error watching mount table, mount changes will only be seen by full discoveries: %v", err)
+			return
+		}
+		if n > 0 && fds[0].Revents&(unix.POLLPRI|unix.POLLERR) != 0 {
+			changed()
+		}
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/mount"
+
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+)
+
+// VolumeWatcher watches the discovery directories and the mount table, and records
+// which entries of the discovery directories have changed since the last Drain.
+type VolumeWatcher struct {
+	fsWatcher *fsnotify.Watcher
+	mounter   mount.Interface
+	// classes maps a discovery directory to the storage classes using it
+	classes map[string][]string
+
+	mutex sync.Mutex
+	// mountPoints is the set of mount points seen on the last mount table change.
+	// It is replaced, never modified, on every change.
+	mountPoints map[string]interface{}
+	pending     map[string]map[string]struct{}
+	// overflowed is set when events have been dropped, so the pending entries are incomplete
+	overflowed bool
+	changed    chan struct{}
+}
+
+// NewVolumeWatcher returns a VolumeWatcher for the discovery directories of discoveryMap.
+func NewVolumeWatcher(discoveryMap map[string]common.MountConfig, mounter mount.Interface) (*VolumeWatcher, error) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error creating watcher: %v", err)
+	}
+	w := &VolumeWatcher{
+		fsWatcher: fsWatcher,
+		mounter:   mounter,
+		classes:   map[string][]string{},
+		pending:   map[string]map[string]struct{}{},
+		changed:   make(chan struct{}, 1),
+	}
+	for class, config := range discoveryMap {
+		dir := filepath.Clean(config.MountDir)
+		if _, ok := w.classes[dir]; !ok {
+			if err := fsWatcher.Add(dir); err != nil {
+				fsWatcher.Close()
+				return nil, fmt.Errorf("error watching directory %q: %v", dir, err)
+			}
+		}
+		w.classes[dir] = append(w.classes[dir], class)
+	}
+	w.mountPoints, err = w.listMountPoints()
+	if err != nil {
+		fsWatcher.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Run processes the directory and mount table changes until stopCh is closed.
+func (w *VolumeWatcher) Run(stopCh <-chan struct{}) {
+	defer w.fsWatcher.Close()
+	go watchMountTable(stopCh, w.handleMountTableChange)
+	for {
+		select {
+		case <-stopCh:
+			return
+		case event, ok := <-w.fsWatcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+				klog.V(5).Infof("Discovery directory change: %v", event)
+				w.enqueue(event.Name)
+			}
+		case err, ok := <-w.fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				klog.Warningf("Events of the discovery directories have been dropped, running a full discovery")
+				w.mutex.Lock()
+				w.overflowed = true
+				w.mutex.Unlock()
+				w.notify()
+				continue
+			}
+			klog.Errorf("Error watching discovery directories: %v", err)
+		}
+	}
+}
+
+// Changed returns a channel which receives a value when there are entries to drain.
+func (w *VolumeWatcher) Changed() <-chan struct{} {
+	return w.changed
+}
+
+// Drain returns the changed entries, as expected by Discoverer.DiscoverVolumes, and forgets them.
+func (w *VolumeWatcher) Drain() map[string][]string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	entries := map[string][]string{}
+	for class, files := range w.pending {
+		for file := range files {
+			entries[class] = append(entries[class], file)
+		}
+	}
+	w.pending = map[string]map[string]struct{}{}
+	return entries
+}
+
+// NeedsFullDiscovery returns true, once, if changes may have been missed since the last call,
+// in which case the drained entries are incomplete.
+func (w *VolumeWatcher) NeedsFullDiscovery() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	overflowed := w.overflowed
+	w.overflowed = false
+	return overflowed
+}
+
+// MountPoints returns the set of the current mount points. The returned map must not be modified.
+func (w *VolumeWatcher) MountPoints() map[string]interface{} {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.mountPoints
+}
+
+// handleMountTableChange enqueues the mount points which appeared or disappeared
+// since the last change of the mount table.
+func (w *VolumeWatcher) handleMountTableChange() {
+	mountPoints, err := w.listMountPoints()
+	if err != nil {
+		klog.Errorf("Error handling mount table change: %v", err)
+		return
+	}
+	w.mutex.Lock()
+	oldMountPoints := w.mountPoints
+	w.mountPoints = mountPoints
+	w.mutex.Unlock()
+	for path := range mountPoints {
+		if _, ok := oldMountPoints[path]; !ok {
+			w.enqueue(path)
+		}
+	}
+	for path := range oldMountPoints {
+		if _, ok := mountPoints[path]; !ok {
+			w.enqueue(path)
+		}
+	}
+}
+
+func (w *VolumeWatcher) listMountPoints() (map[string]interface{}, error) {
+	mountPoints, err := w.mounter.List()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving mountpoints: %v", err)
+	}
+	paths := map[string]interface{}{}
+	for _, mp := range mountPoints {
+		paths[filepath.Clean(mp.Path)] = struct{}{}
+	}
+	return paths, nil
+}
+
+// enqueue records path as changed if it is an entry of a discovery directory.
+func (w *VolumeWatcher) enqueue(path string) {
+	dir, file := filepath.Split(filepath.Clean(path))
+	classes, ok := w.classes[filepath.Clean(dir)]
+	if !ok {
+		return
+	}
+	w.mutex.Lock()
+	for _, class := range classes {
+		if w.pending[class] == nil {
+			w.pending[class] = map[string]struct{}{}
+		}
+		w.pending[class][file] = struct{}{}
+	}
+	w.mutex.Unlock()
+	w.notify()
+}
+
+// notify wakes up the consumer of Changed, if it isn't already about to wake up.
+func (w *VolumeWatcher) notify() {
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/utils/mount"
+
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+)
+
+func TestVolumeWatcher_DirectoryChange(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewVolumeWatcher(map[string]common.MountConfig{"sc1": {MountDir: dir}}, &mount.FakeMounter{})
+	if err != nil {
+		t.Fatalf("Error creating volume watcher: %v", err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go w.Run(stopCh)
+
+	if err := os.Mkdir(filepath.Join(dir, "vol1"), 0755); err != nil {
+		t.Fatalf("Error creating volume: %v", err)
+	}
+	// Changes outside of the discovery directory are not reported
+	if err := os.Mkdir(filepath.Join(dir, "vol1", "nested"), 0755); err != nil {
+		t.Fatalf("Error creating nested directory: %v", err)
+	}
+
+	select {
+	case <-w.Changed():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Timed out waiting for the directory change")
+	}
+	expected := map[string][]string{"sc1": {"vol1"}}
+	if entries := w.Drain(); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected changed entries %v, got %v", expected, entries)
+	}
+	if entries := w.Drain(); len(entries) != 0 {
+		t.Errorf("Expected no changed entries after drain, got %v", entries)
+	}
+}
+
+func TestVolumeWatcher_MountTableChange(t *testing.T) {
+	dir := t.TempDir()
+	fm := &mount.FakeMounter{
+		MountPoints: []mount.MountPoint{
+			{Path: filepath.Join(dir, "vol1")},
+			{Path: "/other/vol2"},
+		},
+	}
+	w, err := NewVolumeWatcher(map[string]common.MountConfig{"sc1": {MountDir: dir}, "sc2": {MountDir: dir}}, fm)
+	if err != nil {
+		t.Fatalf("Error creating volume watcher: %v", err)
+	}
+
+	// vol1 is unmounted, vol3 is mounted and the mount outside of the discovery directory is ignored
+	fm.MountPoints = []mount.MountPoint{
+		{Path: filepath.Join(dir, "vol3")},
+		{Path: "/other/vol4"},
+	}
+	w.handleMountTableChange()
+
+	select {
+	case <-w.Changed():
+	default:
+		t.Fatalf("Expected the mount table change to be reported")
+	}
+	entries := w.Drain()
+	for _, class := range []string{"sc1", "sc2"} {
+		files := map[string]bool{}
+		for _, file := range entries[class] {
+			files[file] = true
+		}
+		expected := map[string]bool{"vol1": true, "vol3": true}
+		if !reflect.DeepEqual(files, expected) {
+			t.Errorf("Expected changed entries %v for class %q, got %v", expected, class, files)
+		}
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected changed entries for 2 classes, got %v", entries)
+	}
+	expectedMountPoints := map[string]interface{}{filepath.Join(dir, "vol3"): struct{}{}, "/other/vol4": struct{}{}}
+	if mountPoints := w.MountPoints(); !reflect.DeepEqual(mountPoints, expectedMountPoints) {
+		t.Errorf("Expected mount points %v, got %v", expectedMountPoints, mountPoints)
+	}
+}
+
+func TestVolumeWatcher_NeedsFullDiscovery(t *testing.T) {
+	w, err := NewVolumeWatcher(map[string]common.MountConfig{"sc1": {MountDir: t.TempDir()}}, &mount.FakeMounter{})
+	if err != nil {
+		t.Fatalf("Error creating volume watcher: %v", err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go w.Run(stopCh)
+
+	if w.NeedsFullDiscovery() {
+		t.Fatalf("Expected no full discovery to be needed")
+	}
+	w.fsWatcher.Errors <- fsnotify.ErrEventOverflow
+
+	select {
+	case <-w.Changed():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Timed out waiting for the overflow to be reported")
+	}
+	if !w.NeedsFullDiscovery() {
+		t.Errorf("Expected a full discovery to be needed after an overflow")
+	}
+	if w.NeedsFullDiscovery() {
+		t.Errorf("Expected the full discovery to be requested only once")
+	}
+}
@@ -29,6 +29,8 @@ const (
 	LocalVolumeProvisionerSubsystem = "local_volume_provisioner"
 	// APIServerRequestCreate represents metrics related to create resource request.
 	APIServerRequestCreate = "create"
+	// APIServerRequestUpdate represents metrics related to update resource request.
+	APIServerRequestUpdate = "update"
 	// APIServerRequestDelete represents metrics related to delete resource request.
 	APIServerRequestDelete = "delete"
 	// DeleteTypeProcess represents metrics related deletion in process.
@@ -47,6 +49,60 @@ var (
 		},
 		[]string{"mode"},
 	)
+	// PersistentVolumeCapacityMismatchBytes is used to collect the difference between the size of the
+	// local volumes and the capacity of their bound PVs, when they have been resized.
+	PersistentVolumeCapacityMismatchBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: LocalVolumeProvisionerSubsystem,
+			Name:      "persistentvolume_capacity_mismatch_bytes",
+			Help:      "Difference in bytes between the size of the local volume and the capacity of its bound persistent volume. Broken down by persistent volume name.",
+		},
+		[]string{"persistentvolume"},
+	)
+	// PersistentVolumeMissing is used to collect the persistent volumes whose backing path is missing
+	// or no longer a mount point.
+	PersistentVolumeMissing = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: LocalVolumeProvisionerSubsystem,
+			Name:      "persistentvolume_missing",
+			Help:      "Set to 1 for the persistent volumes whose backing path is missing or no longer a mount point. Broken down by persistent volume name.",
+		},
+		[]string{"persistentvolume"},
+	)
+	// CleanupProgressRatio is used to collect the progress of the volume cleanups run by the provisioner
+	// process. The progress of the cleanups run by jobs is only printed in their logs.
+	CleanupProgressRatio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: LocalVolumeProvisionerSubsystem,
+			Name:      "cleanup_progress_ratio",
+			Help:      "Ratio of the bytes already cleaned to the bytes to clean of the volume cleanups running in the provisioner process, not of those run by jobs. Broken down by persistent volume name.",
+		},
+		[]string{"persistentvolume"},
+	)
+	// CleanupJobsFailed is used to collect the number of failed cleanup jobs left in place.
+	CleanupJobsFailed = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: LocalVolumeProvisionerSubsystem,
+			Name:      "cleanup_jobs_failed",
+			Help:      "Number of failed cleanup jobs of the node, which are kept until they are deleted by hand or their TTL expires.",
+		},
+	)
+	// CleanupQueueDepth is used to collect the number of cleanups waiting for the concurrency limits.
+	CleanupQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: LocalVolumeProvisionerSubsystem,
+			Name:      "cleanup_queue_depth",
+			Help:      "Number of released persistent volumes whose cleanup waits for the concurrent cleanup limits.",
+		},
+	)
+	// ConfigReloadFailuresTotal is used to collect the number of failed reloads of the configuration.
+	ConfigReloadFailuresTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: LocalVolumeProvisionerSubsystem,
+			Name:      "config_reload_failures_total",
+			Help:      "Total number of reloads of the configuration which failed, while the last applied configuration is kept.",
+		},
+	)
 	// PersistentVolumeDiscoveryTotal is used to collect accumulated count of persistent volumes discoveried.
 	PersistentVolumeDiscoveryTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -62,4 +62,20 @@ var (
 			Help:      "Total number of persistent volume claim delete failed attempts.",
 		},
 	)
+	// CleanupJobDeleteTotal is used to collect accumulated count of cleanup jobs deleted because their Node is gone.
+	CleanupJobDeleteTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: LocalVolumeNodeCleanupSubsystem,
+			Name:      "cleanup_job_delete_total",
+			Help:      "Total number of cleanup jobs deleted because they target a deleted node.",
+		},
+	)
+	// CleanupJobDeleteFailedTotal is used to collect accumulated count of cleanup job delete failed attempts.
+	CleanupJobDeleteFailedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: LocalVolumeNodeCleanupSubsystem,
+			Name:      "cleanup_job_delete_failed_total",
+			Help:      "Total number of cleanup job delete failed attempts.",
+		},
+	)
 )
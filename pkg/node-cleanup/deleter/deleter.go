@@ -18,38 +18,45 @@ package deleter
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+	provisionerdeleter "sigs.k8s.io/sig-storage-local-static-provisioner/pkg/deleter"
 	cleanupmetrics "sigs.k8s.io/sig-storage-local-static-provisioner/pkg/metrics/node-cleanup"
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/util"
 )
 
 // Deleter handles cleanup of local PVs with an affinity to a deleted Node.
 // Only PVs with a StorageClass listed in the storageClassNames will be considered for cleanup.
+// Cleanup jobs of the provisioners in cleanupJobNamespace which target a deleted Node are deleted too.
 type Deleter struct {
-	client            kubernetes.Interface
-	pvLister          corelisters.PersistentVolumeLister
-	nodeLister        corelisters.NodeLister
-	storageClassNames []string
+	client              kubernetes.Interface
+	pvLister            corelisters.PersistentVolumeLister
+	nodeLister          corelisters.NodeLister
+	storageClassNames   []string
+	cleanupJobNamespace string
 }
 
 // NewDeleter creates a Deleter object to handle the deletion of local PVs
-// that have an affinity to a deleted Node and have a StorageClass listed in storageClassNames.
-func NewDeleter(client kubernetes.Interface, pvLister corelisters.PersistentVolumeLister, nodeLister corelisters.NodeLister, storageClassNames []string) *Deleter {
+// that have an affinity to a deleted Node and have a StorageClass listed in storageClassNames,
+// and of the cleanup jobs in cleanupJobNamespace that target a deleted Node, if it is not empty.
+func NewDeleter(client kubernetes.Interface, pvLister corelisters.PersistentVolumeLister, nodeLister corelisters.NodeLister, storageClassNames []string, cleanupJobNamespace string) *Deleter {
 	return &Deleter{
-		client:            client,
-		pvLister:          pvLister,
-		nodeLister:        nodeLister,
-		storageClassNames: storageClassNames,
+		client:              client,
+		pvLister:            pvLister,
+		nodeLister:          nodeLister,
+		storageClassNames:   storageClassNames,
+		cleanupJobNamespace: cleanupJobNamespace,
 	}
 }
 
@@ -62,6 +69,7 @@ func (d *Deleter) Run(ctx context.Context, discoveryInterval time.Duration) {
 			return
 		default:
 			d.DeletePVs(ctx)
+			d.DeleteCleanupJobs(ctx)
 			time.Sleep(discoveryInterval)
 		}
 	}
@@ -107,6 +115,45 @@ func (d *Deleter) DeletePVs(ctx context.Context) {
 	}
 }
 
+// DeleteCleanupJobs deletes the cleanup jobs of the provisioners which target a deleted Node.
+// Such jobs can't be scheduled, so they would otherwise stay Pending forever.
+func (d *Deleter) DeleteCleanupJobs(ctx context.Context) {
+	if d.cleanupJobNamespace == "" {
+		return
+	}
+	selector := labels.NewSelector()
+	for _, key := range []string{provisionerdeleter.PVLabel, common.NodeNameLabel} {
+		req, err := labels.NewRequirement(key, selection.Exists, nil)
+		if err != nil {
+			klog.Errorf("error building cleanup job selector: %v", err)
+			return
+		}
+		selector = selector.Add(*req)
+	}
+	jobs, err := d.client.BatchV1().Jobs(d.cleanupJobNamespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		klog.Errorf("error listing cleanup jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs.Items {
+		if !strings.HasPrefix(job.Name, provisionerdeleter.JobNamePrefix) || job.DeletionTimestamp != nil {
+			continue
+		}
+		nodeName := job.Labels[common.NodeNameLabel]
+		if common.AnyNodeExists(d.nodeLister, []string{nodeName}) {
+			continue
+		}
+		klog.Infof("Attempting to delete cleanup job %q that targets deleted Node %q", job.Name, nodeName)
+		if err := d.deleteJob(ctx, job.Name); err != nil {
+			cleanupmetrics.CleanupJobDeleteFailedTotal.Inc()
+			klog.Errorf("Error deleting cleanup job %q: %v", job.Name, err)
+			continue
+		}
+		cleanupmetrics.CleanupJobDeleteTotal.Inc()
+	}
+}
+
 // referencesNonExistentNode returns true if the local PV has a NodeAffinity to
 // a deleted Node. An error is returned if the local PV's NodeAffinity
 // does not have the form:
@@ -136,3 +183,14 @@ func (d *Deleter) deletePV(ctx context.Context, pvName string) error {
 	}
 	return err
 }
+
+func (d *Deleter) deleteJob(ctx context.Context, jobName string) error {
+	// The pods of the job were never scheduled, or were on the deleted Node.
+	propagation := metav1.DeletePropagationBackground
+	err := d.client.BatchV1().Jobs(d.cleanupJobNamespace).Delete(ctx, jobName, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && errors.IsNotFound(err) {
+		klog.Warningf("Cleanup job %q no longer exists", jobName)
+		return nil
+	}
+	return err
+}
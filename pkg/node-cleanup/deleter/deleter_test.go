@@ -22,6 +22,7 @@ import (
 	"testing"
 	"time"
 
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -31,6 +32,7 @@ import (
 	core "k8s.io/client-go/testing"
 
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+	provisionerdeleter "sigs.k8s.io/sig-storage-local-static-provisioner/pkg/deleter"
 )
 
 const (
@@ -145,7 +147,7 @@ func TestDeleter(t *testing.T) {
 			pvInformer := informers.Core().V1().PersistentVolumes()
 			nodeInformer := informers.Core().V1().Nodes()
 
-			deleter := NewDeleter(client, pvInformer.Lister(), nodeInformer.Lister(), test.storageClassNames)
+			deleter := NewDeleter(client, pvInformer.Lister(), nodeInformer.Lister(), test.storageClassNames, "")
 
 			// Populate the informers with initial objects so the controller can
 			// Get() and List() it.
@@ -186,6 +188,43 @@ func TestDeleter(t *testing.T) {
 	}
 }
 
+func TestDeleteCleanupJobs(t *testing.T) {
+	node := node()
+	cleanupJob := func(name, namespace, nodeName string) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{common.NodeNameLabel: nodeName, provisionerdeleter.PVLabel: testPVName},
+			},
+		}
+	}
+	objects := []runtime.Object{
+		node,
+		cleanupJob(provisionerdeleter.JobNamePrefix+"pv1", "kube-system", testNodeName),
+		cleanupJob(provisionerdeleter.JobNamePrefix+"pv2", "kube-system", nonExistentNodeName),
+		cleanupJob(provisionerdeleter.JobNamePrefix+"pv3", "default", nonExistentNodeName),
+		cleanupJob("unrelated", "kube-system", nonExistentNodeName),
+	}
+	client := fake.NewSimpleClientset(objects...)
+	informers := informers.NewSharedInformerFactory(client, noResyncPeriodFunc())
+	nodeInformer := informers.Core().V1().Nodes()
+	nodeInformer.Informer().GetStore().Add(node)
+
+	deleter := NewDeleter(client, informers.Core().V1().PersistentVolumes().Lister(), nodeInformer.Lister(), nil, "kube-system")
+	deleter.DeleteCleanupJobs(context.TODO())
+
+	var deleted []string
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "delete" {
+			deleted = append(deleted, action.GetNamespace()+"/"+action.(core.DeleteAction).GetName())
+		}
+	}
+	if expected := []string{"kube-system/" + provisionerdeleter.JobNamePrefix + "pv2"}; !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("Expected deleted jobs %v, got %v", expected, deleted)
+	}
+}
+
 func pvWithRemoteSource(pv *v1.PersistentVolume) *v1.PersistentVolume {
 	pv.Spec.PersistentVolumeSource = remoteSource
 	return pv
@@ -33,6 +33,9 @@ type APIUtil interface {
 	// Create PersistentVolume object
 	CreatePV(pv *v1.PersistentVolume) (*v1.PersistentVolume, error)
 
+	// Update PersistentVolume object
+	UpdatePV(pv *v1.PersistentVolume) (*v1.PersistentVolume, error)
+
 	// Delete PersistentVolume object
 	DeletePV(pvName string) error
 
@@ -66,6 +69,18 @@ func (u *apiUtil) CreatePV(pv *v1.PersistentVolume) (*v1.PersistentVolume, error
 	return pv, err
 }
 
+// UpdatePV will update a PersistentVolume
+func (u *apiUtil) UpdatePV(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	startTime := time.Now()
+	metrics.APIServerRequestsTotal.WithLabelValues(metrics.APIServerRequestUpdate).Inc()
+	pv, err := u.client.CoreV1().PersistentVolumes().Update(context.TODO(), pv, metav1.UpdateOptions{})
+	metrics.APIServerRequestsDurationSeconds.WithLabelValues(metrics.APIServerRequestUpdate).Observe(time.Since(startTime).Seconds())
+	if err != nil {
+		metrics.APIServerRequestsFailedTotal.WithLabelValues(metrics.APIServerRequestUpdate).Inc()
+	}
+	return pv, err
+}
+
 // DeletePV will delete a PersistentVolume
 func (u *apiUtil) DeletePV(pvName string) error {
 	startTime := time.Now()
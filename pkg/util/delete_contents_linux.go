@@ -0,0 +1,390 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// deleteContentsWorkers is how many directories may be deleted in parallel, in addition to the
+	// one of the caller.
+	deleteContentsWorkers = 16
+	// deleteContentsBatchSize is how many directory entries are read at once, so that huge
+	// directories are never loaded in memory.
+	deleteContentsBatchSize = 1024
+	// mountInfoPath lists the mount points, to find the ones nested in a volume.
+	mountInfoPath = "/proc/self/mountinfo"
+	// lazyUnmount detaches the mount point at path, even if it is busy.
+	lazyUnmount = func(path string) error {
+		return unix.Unmount(path, unix.MNT_DETACH|unix.UMOUNT_NOFOLLOW)
+	}
+	// openat2 is stubbed by tests to exercise the fallback of kernels older than 5.6.
+	openat2 = unix.Openat2
+)
+
+const (
+	// maxDeleteContentsFailures is how many entries which could not be removed are reported by
+	// DeleteContents, the others are counted.
+	maxDeleteContentsFailures = 10
+
+	// Inode flags, see ioctl_iflags(2), which make unlink fail with EPERM.
+	fsImmutableFlag  = 0x00000010
+	fsAppendOnlyFlag = 0x00000020
+)
+
+// DeleteContents deletes all the contents under the given directory, and returns how many entries
+// were removed. The mount points nested in the directory are lazily unmounted first. The
+// subdirectories are deleted in parallel by a bounded number of workers, each directory is read by
+// batches, and the entries are removed with unlinkat relative to their directory, without following
+// symlinks. The immutable and append-only flags which prevent an entry from being removed are
+// cleared. The entries which could not be removed are returned in a DeleteContentsError.
+// mountPath is resolved beneath mountDir without following symlinks, see openDirBeneath.
+func (u *volumeUtil) DeleteContents(hostPath, mountPath, mountDir string) (int64, error) {
+	dir, err := openDirBeneath(mountDir, mountPath)
+	if err != nil {
+		return 0, err
+	}
+	defer dir.Close()
+
+	d := &contentsDeleter{
+		workers:     make(chan struct{}, deleteContentsWorkers),
+		mountPoints: map[string]bool{},
+	}
+	if err := d.unmountNestedMounts(mountPath); err != nil {
+		return 0, err
+	}
+	d.deleteContents(dir, mountPath)
+	return atomic.LoadInt64(&d.removed), d.failuresError()
+}
+
+// openDirBeneath opens the directory path, which must be strictly beneath the directory root. path
+// is resolved with openat2 and RESOLVE_BENEATH|RESOLVE_NO_SYMLINKS, so that no symlink nor ".."
+// component can make it escape from root, even if the tree is changed concurrently. On kernels
+// without openat2, the components of path are opened one by one relatively to their parent,
+// without following symlinks.
+func openDirBeneath(root, path string) (*os.File, error) {
+	if !IsStrictlyBeneath(root, path) {
+		return nil, fmt.Errorf("refusing to open %q: not beneath %q", path, root)
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, err
+	}
+	rootfd, err := unix.Open(root, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	defer unix.Close(rootfd)
+
+	flags := unix.O_RDONLY | unix.O_DIRECTORY | unix.O_NOFOLLOW | unix.O_CLOEXEC
+	fd, err := openat2(rootfd, rel, &unix.OpenHow{
+		Flags:   uint64(flags),
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS,
+	})
+	// Older kernels return ENOSYS, and some seccomp profiles EPERM.
+	if err == unix.ENOSYS || err == unix.EPERM {
+		fd, err = openComponents(rootfd, rel, flags)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// openComponents opens the relative path rel beneath the directory dirfd, component by component.
+// rel must be clean and must not start with "..".
+func openComponents(dirfd int, rel string, flags int) (int, error) {
+	fd := -1
+	for _, name := range strings.Split(rel, "/") {
+		next, err := unix.Openat(dirfd, name, flags, 0)
+		if fd >= 0 {
+			unix.Close(fd)
+		}
+		if err != nil {
+			return -1, err
+		}
+		fd, dirfd = next, next
+	}
+	return fd, nil
+}
+
+// contentsDeleter deletes the contents of a directory tree.
+type contentsDeleter struct {
+	// workers holds a token for each directory being deleted by a worker goroutine
+	workers chan struct{}
+	// removed counts the removed entries
+	removed int64
+	// mountPoints are the nested mount points which could not be unmounted, and are kept
+	mountPoints map[string]bool
+
+	mutex        sync.Mutex
+	failures     []string
+	failureCount int
+}
+
+// unmountNestedMounts lazily unmounts the mount points nested in path, deepest first, so that
+// neither their contents are deleted nor they make the removal of their directory fail. The mount
+// points which could not be unmounted are reported, and kept with their contents.
+func (d *contentsDeleter) unmountNestedMounts(path string) error {
+	root, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	mountPoints, err := listMountPoints()
+	if err != nil {
+		return fmt.Errorf("error listing the mount points nested in %q: %v", path, err)
+	}
+	var nested []string
+	for _, mountPoint := range mountPoints {
+		if strings.HasPrefix(mountPoint, root+"/") {
+			nested = append(nested, mountPoint)
+		}
+	}
+	// The mount points listed last are mounted over the others, so they are unmounted first.
+	for i, j := 0, len(nested)-1; i < j; i, j = i+1, j-1 {
+		nested[i], nested[j] = nested[j], nested[i]
+	}
+	sort.SliceStable(nested, func(i, j int) bool {
+		return strings.Count(nested[i], "/") > strings.Count(nested[j], "/")
+	})
+	for _, mountPoint := range nested {
+		// The deleted entries are reported relatively to the given path.
+		mountPath := filepath.Join(path, strings.TrimPrefix(mountPoint, root))
+		klog.Infof("Lazily unmounting %q nested in %q", mountPath, path)
+		err := lazyUnmount(mountPoint)
+		// EINVAL is returned if it was unmounted with a parent mount point.
+		if err != nil && err != unix.EINVAL && err != unix.ENOENT {
+			d.addFailure(mountPath, fmt.Errorf("error unmounting: %v", err))
+			d.mountPoints[mountPath] = true
+		}
+	}
+	return nil
+}
+
+// listMountPoints returns the mount points listed in mountInfoPath, in mount order.
+func listMountPoints() ([]string, error) {
+	file, err := os.Open(mountInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var mountPoints []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// The mount point is the fifth field, see proc(5).
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("unexpected line %q", scanner.Text())
+		}
+		mountPoints = append(mountPoints, unescapeMountPoint(fields[4]))
+	}
+	return mountPoints, scanner.Err()
+}
+
+// unescapeMountPoint replaces the octal escapes of the space, tab, newline and backslash
+// characters in a mount point of mountinfo.
+func unescapeMountPoint(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// deleteContents removes the entries of dir, and returns false if some could not be removed.
+func (d *contentsDeleter) deleteContents(dir *os.File, path string) bool {
+	for {
+		found, ok := d.deleteEntries(dir, path)
+		if found == 0 || !ok {
+			return ok
+		}
+		// Removing entries while the directory is read may hide others, so read it again until
+		// it is seen empty.
+		if _, err := dir.Seek(0, io.SeekStart); err != nil {
+			d.addFailure(path, fmt.Errorf("error rewinding directory: %v", err))
+			return false
+		}
+	}
+}
+
+// deleteEntries reads dir once, removing its entries as they are read. It returns how many entries
+// were found, and false if some could not be removed.
+func (d *contentsDeleter) deleteEntries(dir *os.File, path string) (int, bool) {
+	dirfd := int(dir.Fd())
+	found := 0
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for {
+		entries, err := dir.ReadDir(deleteContentsBatchSize)
+		for _, entry := range entries {
+			found++
+			name := entry.Name()
+			if len(d.mountPoints) > 0 && d.mountPoints[filepath.Join(path, name)] {
+				// The mount point could not be unmounted, its contents are kept.
+				failed.Store(true)
+				continue
+			}
+			if !entry.IsDir() {
+				if !d.unlink(dirfd, path, name, 0) {
+					failed.Store(true)
+				}
+				continue
+			}
+			select {
+			case d.workers <- struct{}{}:
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-d.workers }()
+					if !d.deleteTree(dirfd, path, name) {
+						failed.Store(true)
+					}
+				}()
+			default:
+				// All the workers are busy, delete the directory in this goroutine.
+				if !d.deleteTree(dirfd, path, name) {
+					failed.Store(true)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			d.addFailure(path, fmt.Errorf("error reading directory: %v", err))
+			failed.Store(true)
+			break
+		}
+	}
+	wg.Wait()
+	return found, !failed.Load()
+}
+
+// deleteTree removes the directory name of the directory dirfd, and everything under it.
+func (d *contentsDeleter) deleteTree(dirfd int, parentPath, name string) bool {
+	path := filepath.Join(parentPath, name)
+	fd, err := unix.Openat(dirfd, name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err == unix.ENOENT {
+		return true
+	}
+	if err != nil {
+		d.addFailure(path, fmt.Errorf("error opening directory: %v", err))
+		return false
+	}
+	dir := os.NewFile(uintptr(fd), path)
+	ok := d.deleteContents(dir, path)
+	dir.Close()
+	if !ok {
+		return false
+	}
+	return d.unlink(dirfd, parentPath, name, unix.AT_REMOVEDIR)
+}
+
+// unlink removes the entry name of the directory dirfd. If it is not permitted, the immutable and
+// append-only flags of the entry and of the directory are cleared, and it is removed again.
+func (d *contentsDeleter) unlink(dirfd int, parentPath, name string, flags int) bool {
+	err := unix.Unlinkat(dirfd, name, flags)
+	if err == unix.EPERM && clearRemovalFlags(dirfd, name) {
+		err = unix.Unlinkat(dirfd, name, flags)
+	}
+	if err == unix.ENOENT {
+		return true
+	}
+	if err != nil {
+		d.addFailure(filepath.Join(parentPath, name), err)
+		return false
+	}
+	atomic.AddInt64(&d.removed, 1)
+	return true
+}
+
+// clearRemovalFlags clears the immutable and append-only flags of the directory dirfd and of its
+// entry name, and returns true if some were cleared. The flags of entries which are neither
+// regular files nor directories are left as is, as opening them may have side effects.
+func clearRemovalFlags(dirfd int, name string) bool {
+	cleared := clearFlags(dirfd)
+	var stat unix.Stat_t
+	if err := unix.Fstatat(dirfd, name, &stat, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return cleared
+	}
+	if mode := stat.Mode & unix.S_IFMT; mode != unix.S_IFREG && mode != unix.S_IFDIR {
+		return cleared
+	}
+	fd, err := unix.Openat(dirfd, name, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return cleared
+	}
+	defer unix.Close(fd)
+	return clearFlags(fd) || cleared
+}
+
+// clearFlags clears the immutable and append-only flags of fd, and returns true if some were set.
+func clearFlags(fd int) bool {
+	flags, err := unix.IoctlGetUint32(fd, unix.FS_IOC_GETFLAGS)
+	if err != nil || flags&(fsImmutableFlag|fsAppendOnlyFlag) == 0 {
+		return false
+	}
+	if err := unix.IoctlSetPointerInt(fd, unix.FS_IOC_SETFLAGS, int(flags&^(fsImmutableFlag|fsAppendOnlyFlag))); err != nil {
+		klog.Warningf("Error clearing the immutable and append-only flags: %v", err)
+		return false
+	}
+	return true
+}
+
+// addFailure records that path could not be removed.
+func (d *contentsDeleter) addFailure(path string, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.failureCount++
+	if len(d.failures) < maxDeleteContentsFailures {
+		d.failures = append(d.failures, fmt.Sprintf("%s: %v", path, err))
+	}
+}
+
+// failuresError returns the entries which could not be removed, or nil if all were.
+func (d *contentsDeleter) failuresError() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.failureCount == 0 {
+		return nil
+	}
+	return &DeleteContentsError{Failures: d.failures, Count: d.failureCount}
+}
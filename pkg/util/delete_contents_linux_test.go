@@ -0,0 +1,306 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestDeleteContents(t *testing.T) {
+	oldWorkers, oldBatchSize := deleteContentsWorkers, deleteContentsBatchSize
+	// Few workers and small batches, so that directories are also deleted inline and read in
+	// several batches.
+	deleteContentsWorkers, deleteContentsBatchSize = 2, 7
+	t.Cleanup(func() {
+		deleteContentsWorkers, deleteContentsBatchSize = oldWorkers, oldBatchSize
+	})
+
+	root := t.TempDir()
+	volume := filepath.Join(root, "volume")
+	outside := filepath.Join(root, "outside")
+	var expectedRemoved int64
+	mkdir := func(path string) {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile := func(path string) {
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mkdir(volume)
+	mkdir(outside)
+	writeFile(filepath.Join(outside, "keep"))
+
+	// A wide directory, deep directories and a few files at the top.
+	wide := filepath.Join(volume, "wide")
+	mkdir(wide)
+	expectedRemoved++
+	for i := 0; i < 100; i++ {
+		writeFile(filepath.Join(wide, fmt.Sprintf("file-%d", i)))
+		expectedRemoved++
+	}
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(volume, fmt.Sprintf("deep-%d", i))
+		for depth := 0; depth < 10; depth++ {
+			mkdir(path)
+			writeFile(filepath.Join(path, "file"))
+			expectedRemoved += 2
+			path = filepath.Join(path, "sub")
+		}
+	}
+	for i := 0; i < 10; i++ {
+		writeFile(filepath.Join(volume, fmt.Sprintf("top-%d", i)))
+		expectedRemoved++
+	}
+	// Symlinks are removed, not followed.
+	if err := os.Symlink(outside, filepath.Join(volume, "link")); err != nil {
+		t.Fatal(err)
+	}
+	expectedRemoved++
+
+	u := &volumeUtil{}
+	removed, err := u.DeleteContents(volume, volume, filepath.Dir(volume))
+	if err != nil {
+		t.Fatalf("DeleteContents failed: %v", err)
+	}
+	if removed != expectedRemoved {
+		t.Errorf("Expected %d removed entries, got %d", expectedRemoved, removed)
+	}
+	entries, err := os.ReadDir(volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected an empty volume, found %d entries", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(outside, "keep")); err != nil {
+		t.Errorf("Expected the target of the symlink to be kept: %v", err)
+	}
+}
+
+func TestDeleteContents_MissingDirectory(t *testing.T) {
+	u := &volumeUtil{}
+	path := filepath.Join(t.TempDir(), "missing")
+	if _, err := u.DeleteContents(path, path, filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Errorf("Expected a not exist error, got %v", err)
+	}
+}
+
+func TestDeleteContents_NestedMounts(t *testing.T) {
+	root := t.TempDir()
+	volume := filepath.Join(root, "volume")
+	for _, dir := range []string{"stale", "stale/nested", "with space", "busy"} {
+		if err := os.MkdirAll(filepath.Join(volume, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"stale/nested/file", "busy/file", "top"} {
+		if err := os.WriteFile(filepath.Join(volume, file), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	realVolume, err := filepath.EvalSymlinks(volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mountInfo := strings.Join([]string{
+		"20 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw",
+		fmt.Sprintf("30 20 8:2 / %s rw,relatime shared:2 - ext4 /dev/sdb rw", realVolume),
+		fmt.Sprintf("31 30 8:3 / %s/stale rw,relatime shared:3 - ext4 /dev/sdc rw", realVolume),
+		fmt.Sprintf("32 31 8:3 / %s/stale/nested rw,relatime shared:3 - ext4 /dev/sdc rw", realVolume),
+		fmt.Sprintf("33 30 0:4 / %s/with\\040space rw,relatime shared:4 - tmpfs tmpfs rw", realVolume),
+		fmt.Sprintf("34 30 8:5 / %s/busy rw,relatime shared:5 - ext4 /dev/sdd rw", realVolume),
+		fmt.Sprintf("35 20 8:6 / %s-other rw,relatime shared:6 - ext4 /dev/sde rw", realVolume),
+	}, "\n")
+	mountInfoFile := filepath.Join(root, "mountinfo")
+	if err := os.WriteFile(mountInfoFile, []byte(mountInfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var unmounted []string
+	oldMountInfoPath, oldLazyUnmount := mountInfoPath, lazyUnmount
+	mountInfoPath = mountInfoFile
+	lazyUnmount = func(path string) error {
+		if path == filepath.Join(realVolume, "busy") {
+			return unix.EPERM
+		}
+		unmounted = append(unmounted, path)
+		return nil
+	}
+	t.Cleanup(func() {
+		mountInfoPath, lazyUnmount = oldMountInfoPath, oldLazyUnmount
+	})
+
+	u := &volumeUtil{}
+	removed, err := u.DeleteContents(volume, volume, filepath.Dir(volume))
+	expectedUnmounted := []string{
+		filepath.Join(realVolume, "stale/nested"),
+		filepath.Join(realVolume, "with space"),
+		filepath.Join(realVolume, "stale"),
+	}
+	if !reflect.DeepEqual(unmounted, expectedUnmounted) {
+		t.Errorf("Expected unmounted %v, got %v", expectedUnmounted, unmounted)
+	}
+	contentsErr, ok := err.(*DeleteContentsError)
+	if !ok {
+		t.Fatalf("Expected a DeleteContentsError, got %v", err)
+	}
+	expectedFailures := []string{filepath.Join(volume, "busy") + ": error unmounting: operation not permitted"}
+	if contentsErr.Count != 1 || !reflect.DeepEqual(contentsErr.Failures, expectedFailures) {
+		t.Errorf("Expected failures %v, got %d: %v", expectedFailures, contentsErr.Count, contentsErr.Failures)
+	}
+	// The busy mount point is kept with its contents.
+	if removed != 5 {
+		t.Errorf("Expected 5 removed entries, got %d", removed)
+	}
+	if _, err := os.Stat(filepath.Join(volume, "busy/file")); err != nil {
+		t.Errorf("Expected the contents of the busy mount point to be kept: %v", err)
+	}
+	entries, err := os.ReadDir(volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the busy mount point to be kept, found %d entries", len(entries))
+	}
+}
+
+func TestDeleteContents_ImmutableFlags(t *testing.T) {
+	volume := t.TempDir()
+	setFlags := func(path string, flags int) {
+		fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unix.Close(fd)
+		if err := unix.IoctlSetPointerInt(fd, unix.FS_IOC_SETFLAGS, flags); err != nil {
+			t.Skipf("Setting inode flags is not supported: %v", err)
+		}
+	}
+	appendOnly := filepath.Join(volume, "append-only")
+	immutableDir := filepath.Join(volume, "immutable-dir")
+	if err := os.Mkdir(immutableDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{appendOnly, filepath.Join(volume, "immutable"), filepath.Join(immutableDir, "file")} {
+		if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The flags are cleared if the test fails before they are.
+	t.Cleanup(func() {
+		for _, path := range []string{appendOnly, filepath.Join(volume, "immutable"), immutableDir} {
+			if fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0); err == nil {
+				clearFlags(fd)
+				unix.Close(fd)
+			}
+		}
+	})
+	setFlags(appendOnly, fsAppendOnlyFlag)
+	setFlags(filepath.Join(volume, "immutable"), fsImmutableFlag)
+	setFlags(immutableDir, fsImmutableFlag)
+
+	u := &volumeUtil{}
+	removed, err := u.DeleteContents(volume, volume, filepath.Dir(volume))
+	if err != nil {
+		t.Fatalf("DeleteContents failed: %v", err)
+	}
+	if removed != 4 {
+		t.Errorf("Expected 4 removed entries, got %d", removed)
+	}
+	entries, err := os.ReadDir(volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected an empty volume, found %d entries", len(entries))
+	}
+}
+
+func TestDeleteContentsError(t *testing.T) {
+	err := &DeleteContentsError{Failures: []string{"/a: busy", "/b: busy"}, Count: 5}
+	expected := "5 entries could not be removed: /a: busy; /b: busy; and 3 more"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestOpenDirBeneath(t *testing.T) {
+	root := t.TempDir()
+	mountDir := filepath.Join(root, "disks")
+	for _, dir := range []string{"disks/vol1", "disks/a/vol2", "disks2/vol3", "outside"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "outside"), filepath.Join(mountDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "outside"), filepath.Join(mountDir, "a", "link")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path        string
+		expectError bool
+	}{
+		{path: filepath.Join(mountDir, "vol1")},
+		{path: filepath.Join(mountDir, "a", "vol2")},
+		{path: filepath.Join(root, "disks2", "vol3"), expectError: true},
+		{path: filepath.Join(mountDir, "..", "outside"), expectError: true},
+		{path: filepath.Join(mountDir, "link"), expectError: true},
+		{path: filepath.Join(mountDir, "a", "link"), expectError: true},
+		{path: mountDir, expectError: true},
+	}
+	oldOpenat2 := openat2
+	t.Cleanup(func() {
+		openat2 = oldOpenat2
+	})
+	for _, fallback := range []bool{false, true} {
+		if fallback {
+			// Kernels older than 5.6 don't have openat2.
+			openat2 = func(dirfd int, path string, how *unix.OpenHow) (int, error) {
+				return -1, unix.ENOSYS
+			}
+		}
+		for _, test := range tests {
+			dir, err := openDirBeneath(mountDir, test.path)
+			if test.expectError {
+				if err == nil {
+					dir.Close()
+					t.Errorf("Expected opening %q to fail, fallback %v", test.path, fallback)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("Opening %q failed, fallback %v: %v", test.path, fallback, err)
+				continue
+			}
+			dir.Close()
+		}
+	}
+}
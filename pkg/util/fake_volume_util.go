@@ -19,6 +19,7 @@ package util
 import (
 	"fmt"
 	"path/filepath"
+	"slices"
 
 	"k8s.io/klog/v2"
 )
@@ -49,6 +50,16 @@ type FakeDirEntry struct {
 	// Expected hash value of the PV name
 	Hash     uint32
 	Capacity int64
+	// Identity of the block device, only used for entries of type block
+	Identity *BlockDeviceIdentity
+	// UUID of the mounted filesystem, only used for entries of type file
+	FsUUID string
+	// Root of the mount within its filesystem, "/" if empty, only used for entries of type file
+	MountRoot string
+	// Number of entries under the directory, removed by DeleteContents, only used for entries of type file
+	Contents int64
+	// Entries under the directory which DeleteContents fails to remove, only used for entries of type file
+	DeleteFailures []string
 }
 
 // NewFakeVolumeUtil returns a VolumeUtil object for use in unit testing
@@ -110,12 +121,41 @@ func (u *FakeVolumeUtil) ReadDir(fullPath string) ([]string, error) {
 	return fileNames, nil
 }
 
+// Exists checks if the given directory entry exists
+func (u *FakeVolumeUtil) Exists(fullPath string) (bool, error) {
+	dir, file := filepath.Split(fullPath)
+	files, found := u.directoryFiles[filepath.Clean(dir)]
+	if !found {
+		return false, nil
+	}
+	for _, f := range files {
+		if file == f.Name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // DeleteContents removes all the contents under the given directory
-func (u *FakeVolumeUtil) DeleteContents(hostPath, mountPath string) error {
+func (u *FakeVolumeUtil) DeleteContents(hostPath, mountPath, mountDir string) (int64, error) {
 	if u.deleteShouldFail {
-		return fmt.Errorf("Fake delete contents failed")
+		return 0, fmt.Errorf("Fake delete contents failed")
+	}
+	if !IsStrictlyBeneath(mountDir, mountPath) {
+		return 0, fmt.Errorf("refusing to delete the contents of %q: not beneath %q", mountPath, mountDir)
+	}
+	dir, file := filepath.Split(mountPath)
+	for _, f := range u.directoryFiles[filepath.Clean(dir)] {
+		if f.Name == file {
+			removed := f.Contents
+			f.Contents = 0
+			if len(f.DeleteFailures) > 0 {
+				return removed, &DeleteContentsError{Failures: f.DeleteFailures, Count: len(f.DeleteFailures)}
+			}
+			return removed, nil
+		}
 	}
-	return nil
+	return 0, nil
 }
 
 // GetFsCapacityByte returns capacity in byte about a mounted filesystem.
@@ -128,6 +168,67 @@ func (u *FakeVolumeUtil) GetBlockCapacityByte(fullPath string) (int64, error) {
 	return u.getDirEntryCapacity(fullPath, FakeEntryBlock)
 }
 
+// GetBlockDeviceIdentity returns the identity of the specified block device.
+func (u *FakeVolumeUtil) GetBlockDeviceIdentity(fullPath string) (*BlockDeviceIdentity, error) {
+	dir, file := filepath.Split(fullPath)
+	dir = filepath.Clean(dir)
+	files, found := u.directoryFiles[dir]
+	if !found {
+		return nil, fmt.Errorf("Directory %q not found", dir)
+	}
+
+	for _, f := range files {
+		if file == f.Name {
+			if f.VolumeType != FakeEntryBlock {
+				return nil, fmt.Errorf("Directory entry %q is not a %q", f.Name, FakeEntryBlock)
+			}
+			if f.Identity == nil {
+				return &BlockDeviceIdentity{}, nil
+			}
+			identity := *f.Identity
+			return &identity, nil
+		}
+	}
+	return nil, fmt.Errorf("Directory entry %q not found", fullPath)
+}
+
+// GetFsUUID returns the filesystem UUID of the specified directory entry.
+func (u *FakeVolumeUtil) GetFsUUID(mountPath string) (string, error) {
+	dir, file := filepath.Split(mountPath)
+	dir = filepath.Clean(dir)
+	files, found := u.directoryFiles[dir]
+	if !found {
+		return "", fmt.Errorf("Directory %q not found", dir)
+	}
+
+	for _, f := range files {
+		if file == f.Name {
+			return f.FsUUID, nil
+		}
+	}
+	return "", fmt.Errorf("Directory entry %q not found", mountPath)
+}
+
+// GetMountRoot returns the mount root of the specified directory entry.
+func (u *FakeVolumeUtil) GetMountRoot(mountPath string) (string, error) {
+	dir, file := filepath.Split(mountPath)
+	dir = filepath.Clean(dir)
+	files, found := u.directoryFiles[dir]
+	if !found {
+		return "", fmt.Errorf("Directory %q not found", dir)
+	}
+
+	for _, f := range files {
+		if file == f.Name {
+			if f.MountRoot == "" {
+				return "/", nil
+			}
+			return f.MountRoot, nil
+		}
+	}
+	return "", fmt.Errorf("Directory entry %q not found", mountPath)
+}
+
 func (u *FakeVolumeUtil) getDirEntryCapacity(fullPath string, entryType string) (int64, error) {
 	dir, file := filepath.Split(fullPath)
 	dir = filepath.Clean(dir)
@@ -139,7 +240,7 @@ func (u *FakeVolumeUtil) getDirEntryCapacity(fullPath string, entryType string)
 	for _, f := range files {
 		if file == f.Name {
 			if f.VolumeType != entryType {
-				return 0, fmt.Errorf("Directory entry %q is not a %q", f, entryType)
+				return 0, fmt.Errorf("Directory entry %q is not a %q", f.Name, entryType)
 			}
 			return f.Capacity, nil
 		}
@@ -161,6 +262,16 @@ func (u *FakeVolumeUtil) AddNewDirEntries(mountDir string, dirFiles map[string][
 	}
 }
 
+// RemoveDirEntry removes the given file from the current directory listing
+// This is only for testing
+func (u *FakeVolumeUtil) RemoveDirEntry(mountDir, dir, file string) {
+	mountedPath := filepath.Join(mountDir, dir)
+	klog.Infof("Removing from directory %q: file %q\n", dir, file)
+	u.directoryFiles[mountedPath] = slices.DeleteFunc(u.directoryFiles[mountedPath], func(f *FakeDirEntry) bool {
+		return f.Name == file
+	})
+}
+
 // IsLikelyMountPoint checks if the given path is likely a mountpoint
 func (u *FakeVolumeUtil) IsLikelyMountPoint(hostPath, mountPath string, mountPointMap map[string]interface{}) (bool, error) {
 	if _, isMntPnt := mountPointMap[mountPath]; isMntPnt == false {
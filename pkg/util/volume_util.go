@@ -17,7 +17,10 @@ limitations under the License.
 package util
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -37,14 +40,67 @@ type VolumeUtil interface {
 	// ReadDir returns a list of files under the specified directory
 	ReadDir(fullPath string) ([]string, error)
 
-	// Delete all the contents under the given path, but not the path itself
-	DeleteContents(hostPath, mountPath string) error
+	// Exists checks if the given path exists, without following symlinks
+	Exists(fullPath string) (bool, error)
+
+	// Delete all the contents under the given path, which must be strictly beneath mountDir, but
+	// not the path itself, and return how many entries were removed
+	DeleteContents(hostPath, mountPath, mountDir string) (int64, error)
 
 	// Get capacity for fs on full path
 	GetFsCapacityByte(hostPath, mountPath string) (int64, error)
 
 	// Get capacity of the block device
 	GetBlockCapacityByte(fullPath string) (int64, error)
+
+	// Get the stable identity of the block device the given path resolves to
+	GetBlockDeviceIdentity(fullPath string) (*BlockDeviceIdentity, error)
+
+	// Get the UUID of the filesystem mounted at the given path, empty if it is unknown
+	GetFsUUID(mountPath string) (string, error)
+
+	// Get the root of the mount at the given path within its filesystem, "/" unless it is a bind
+	// mount of a subdirectory
+	GetMountRoot(mountPath string) (string, error)
+}
+
+// BlockDeviceIdentity holds the identifiers that allow a physical block device
+// to be recognized independently of the path it is currently reachable at.
+// Any of the fields may be empty if the device does not report it.
+type BlockDeviceIdentity struct {
+	// WWN is the World Wide Name of the device
+	WWN string
+	// Serial is the serial number of the device
+	Serial string
+	// PartUUID is the partition UUID, only set if the device is a partition
+	// and the udev database could be read
+	PartUUID string
+	// Partition is the partition number, only set if the device is a partition
+	Partition string
+	// FsUUID is the UUID of the filesystem on the device, only set if the udev
+	// database could be read
+	FsUUID string
+}
+
+// IsEmpty returns true if none of the identifiers are known
+func (id *BlockDeviceIdentity) IsEmpty() bool {
+	return id == nil || (id.WWN == "" && id.Serial == "" && id.PartUUID == "")
+}
+
+// DeleteContentsError is returned by DeleteContents when some entries could not be removed.
+type DeleteContentsError struct {
+	// Failures holds the first entries which could not be removed, with the reason
+	Failures []string
+	// Count is how many entries could not be removed
+	Count int
+}
+
+func (e *DeleteContentsError) Error() string {
+	msg := fmt.Sprintf("%d entries could not be removed: %s", e.Count, strings.Join(e.Failures, "; "))
+	if more := e.Count - len(e.Failures); more > 0 {
+		msg += fmt.Sprintf("; and %d more", more)
+	}
+	return msg
 }
 
 // IsDir checks if the given path is a directory
@@ -78,6 +134,26 @@ func (u *volumeUtil) ReadDir(fullPath string) ([]string, error) {
 	return files, nil
 }
 
+// Exists checks if the given path exists, without following symlinks
+func (u *volumeUtil) Exists(fullPath string) (bool, error) {
+	_, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// IsStrictlyBeneath returns true if path is beneath the directory dir, but is not dir itself, once
+// both are cleaned. e.g. /mnt/disks/vol1 is beneath /mnt/disks, but /mnt/disks2/vol1 and
+// /mnt/disks/../vol1 are not.
+func IsStrictlyBeneath(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // GetLocalPersistentVolumeNodeNames returns the node affinity node name(s) for
 // local PersistentVolumes. nil is returned if the PV does not have any
 // specific node affinity node selector terms and match expressions.
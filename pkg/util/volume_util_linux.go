@@ -20,18 +20,27 @@ limitations under the License.
 package util
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
-	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/kubernetes/pkg/volume/util/fs"
+	"k8s.io/mount-utils"
 )
 
 var _ VolumeUtil = &volumeUtil{}
 
+var (
+	// sysfsBlockDevDir is where the kernel exposes block devices by major:minor number
+	sysfsBlockDevDir = "/sys/dev/block"
+	// udevDataDir is where udev stores the properties of the devices it manages
+	udevDataDir = "/run/udev/data"
+)
+
 type volumeUtil struct{}
 
 // NewVolumeUtil returns a VolumeUtil object for performing local filesystem operations
@@ -66,6 +75,113 @@ func (u *volumeUtil) GetBlockCapacityByte(fullPath string) (int64, error) {
 	return size, err
 }
 
+// GetBlockDeviceIdentity returns the WWN, serial and partition UUID of the block device
+// fullPath resolves to. Symlinks are followed, so the identity is the one of the device
+// currently behind the path.
+func (u *volumeUtil) GetBlockDeviceIdentity(fullPath string) (*BlockDeviceIdentity, error) {
+	devPath, err := filepath.EvalSymlinks(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(devPath, &st); err != nil {
+		return nil, err
+	}
+	if (st.Mode & unix.S_IFMT) != unix.S_IFBLK {
+		return nil, fmt.Errorf("%q is not a block device", devPath)
+	}
+	return getBlockDeviceIdentity(fmt.Sprintf("%d:%d", unix.Major(uint64(st.Rdev)), unix.Minor(uint64(st.Rdev))))
+}
+
+// getBlockDeviceIdentity returns the identity of the block device with the given major:minor number.
+// Each identifier is always read from the same source so that it compares equal across restarts:
+// the WWN, serial and partition number come from sysfs, which is always available, and the partition UUID comes from
+// the udev database, as the kernel does not expose it. The partition UUID is left empty when the
+// udev database can't be read.
+func getBlockDeviceIdentity(devNumber string) (*BlockDeviceIdentity, error) {
+	devDir, err := filepath.EvalSymlinks(filepath.Join(sysfsBlockDevDir, devNumber))
+	if err != nil {
+		return nil, err
+	}
+	// For partitions, the WWN and serial are attributes of the parent disk.
+	diskDir := devDir
+	partition := readSysfsAttribute(filepath.Join(devDir, "partition"))
+	if partition != "" {
+		diskDir = filepath.Dir(devDir)
+	}
+
+	props := readUdevProperties(filepath.Join(udevDataDir, "b"+devNumber))
+	return &BlockDeviceIdentity{
+		WWN:       readSysfsAttribute(filepath.Join(diskDir, "wwid"), filepath.Join(diskDir, "device", "wwid")),
+		Serial:    readSysfsAttribute(filepath.Join(diskDir, "serial"), filepath.Join(diskDir, "device", "serial")),
+		PartUUID:  props["ID_PART_ENTRY_UUID"],
+		Partition: partition,
+		FsUUID:    props["ID_FS_UUID"],
+	}, nil
+}
+
+// GetFsUUID returns the UUID of the filesystem mounted at mountPath, as recorded in the udev
+// database for the device backing it. It is empty if the filesystem isn't on a block device
+// known to udev, e.g. tmpfs, or if the udev database can't be read.
+func (u *volumeUtil) GetFsUUID(mountPath string) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(mountPath, &st); err != nil {
+		return "", err
+	}
+	devNumber := fmt.Sprintf("%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+	return readUdevProperties(filepath.Join(udevDataDir, "b"+devNumber))["ID_FS_UUID"], nil
+}
+
+// GetMountRoot returns the root of the mount at mountPath within its filesystem, as listed in the
+// mountinfo. It is "/" unless a subdirectory of the filesystem is bind mounted at mountPath.
+func (u *volumeUtil) GetMountRoot(mountPath string) (string, error) {
+	infos, err := mount.ParseMountInfo(mountInfoPath)
+	if err != nil {
+		return "", err
+	}
+	// The last mount at the path hides the previous ones.
+	for i := len(infos) - 1; i >= 0; i-- {
+		if infos[i].MountPoint == mountPath {
+			return infos[i].Root, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a mount point", mountPath)
+}
+
+// readUdevProperties parses the "E:KEY=VALUE" lines of a udev database entry.
+// A missing or unreadable entry yields no properties.
+func readUdevProperties(path string) map[string]string {
+	props := map[string]string{}
+	file, err := os.Open(path)
+	if err != nil {
+		return props
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "E:") {
+			continue
+		}
+		if key, value, found := strings.Cut(line[2:], "="); found {
+			props[key] = value
+		}
+	}
+	return props
+}
+
+// readSysfsAttribute returns the trimmed contents of the first readable attribute file.
+func readSysfsAttribute(paths ...string) string {
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return strings.TrimSpace(string(data))
+		}
+	}
+	return ""
+}
+
 // IsLikelyMountPoint is not implemented in linux because the discovery implementation
 // already checks if a path is a mount point by analyzing the /proc/mounts file
 func (u *volumeUtil) IsLikelyMountPoint(hostPath, mountPath string, mountPointMap map[string]interface{}) (bool, error) {
@@ -86,26 +202,3 @@ func (u *volumeUtil) IsBlock(fullPath string) (bool, error) {
 
 	return (st.Mode & unix.S_IFMT) == unix.S_IFBLK, nil
 }
-
-// DeleteContents deletes all the contents under the given directory
-func (u *volumeUtil) DeleteContents(hostPath, mountPath string) error {
-	dir, err := os.Open(mountPath)
-	if err != nil {
-		return err
-	}
-	defer dir.Close()
-
-	files, err := dir.Readdirnames(-1)
-	if err != nil {
-		return err
-	}
-	errList := []error{}
-	for _, file := range files {
-		err = os.RemoveAll(filepath.Join(mountPath, file))
-		if err != nil {
-			errList = append(errList, err)
-		}
-	}
-
-	return utilerrors.NewAggregate(errList)
-}
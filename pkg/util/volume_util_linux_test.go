@@ -0,0 +1,193 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/unix"
+)
+
+// setupSysfs creates a fake sysfs and udev database under a temp dir with an NVMe disk (259:0)
+// and its first partition (259:1), and points sysfsBlockDevDir and udevDataDir at them.
+func setupSysfs(t *testing.T, withUdev bool) {
+	root := t.TempDir()
+	diskDir := filepath.Join(root, "devices", "pci0000:00", "nvme", "nvme0", "nvme0n1")
+	partDir := filepath.Join(diskDir, "nvme0n1p1")
+	devDir := filepath.Join(root, "dev", "block")
+	udevDir := filepath.Join(root, "udev", "data")
+
+	files := map[string]string{
+		filepath.Join(diskDir, "wwid"):             "eui.0025388b71b2c3d4\n",
+		filepath.Join(diskDir, "device", "serial"): "S4EWNX0R123456 \n",
+		filepath.Join(partDir, "partition"):        "1\n",
+		filepath.Join(udevDir, "b259:0"):           "S:disk/by-id/nvme-Samsung_SSD_970_S4EWNX0R123456\nE:ID_SERIAL=Samsung_SSD_970_S4EWNX0R123456\nE:ID_WWN=eui.0025388b71b2c3d4\n",
+		filepath.Join(udevDir, "b259:1"):           "E:ID_SERIAL=Samsung_SSD_970_S4EWNX0R123456\nE:ID_PART_ENTRY_UUID=8f3d2c1a-0001\nE:ID_FS_UUID=5b1e0c7d-2a4f\n",
+	}
+	for path, content := range files {
+		if !withUdev && filepath.Dir(path) == udevDir {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(devDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for devNumber, target := range map[string]string{"259:0": diskDir, "259:1": partDir} {
+		rel, err := filepath.Rel(devDir, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(rel, filepath.Join(devDir, devNumber)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldSysfsBlockDevDir, oldUdevDataDir := sysfsBlockDevDir, udevDataDir
+	sysfsBlockDevDir, udevDataDir = devDir, udevDir
+	t.Cleanup(func() {
+		sysfsBlockDevDir, udevDataDir = oldSysfsBlockDevDir, oldUdevDataDir
+	})
+}
+
+func TestGetBlockDeviceIdentity(t *testing.T) {
+	tests := []struct {
+		name             string
+		devNumber        string
+		withUdev         bool
+		expectedIdentity *BlockDeviceIdentity
+	}{
+		{
+			name:             "disk",
+			devNumber:        "259:0",
+			withUdev:         true,
+			expectedIdentity: &BlockDeviceIdentity{WWN: "eui.0025388b71b2c3d4", Serial: "S4EWNX0R123456"},
+		},
+		{
+			name:             "partition uses parent disk attributes",
+			devNumber:        "259:1",
+			withUdev:         true,
+			expectedIdentity: &BlockDeviceIdentity{WWN: "eui.0025388b71b2c3d4", Serial: "S4EWNX0R123456", PartUUID: "8f3d2c1a-0001", Partition: "1", FsUUID: "5b1e0c7d-2a4f"},
+		},
+		{
+			name:             "partition without udev database",
+			devNumber:        "259:1",
+			expectedIdentity: &BlockDeviceIdentity{WWN: "eui.0025388b71b2c3d4", Serial: "S4EWNX0R123456", Partition: "1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupSysfs(t, test.withUdev)
+			identity, err := getBlockDeviceIdentity(test.devNumber)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.expectedIdentity, identity); diff != "" {
+				t.Errorf("unexpected identity (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetBlockDeviceIdentity_UnknownDevice(t *testing.T) {
+	setupSysfs(t, true)
+	if _, err := getBlockDeviceIdentity("8:0"); err == nil {
+		t.Errorf("expected error for a device missing from sysfs")
+	}
+}
+
+func TestGetFsUUID(t *testing.T) {
+	setupSysfs(t, true)
+	mountPath := t.TempDir()
+	var st unix.Stat_t
+	if err := unix.Stat(mountPath, &st); err != nil {
+		t.Fatal(err)
+	}
+	u := &volumeUtil{}
+
+	uuid, err := u.GetFsUUID(mountPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if uuid != "" {
+		t.Errorf("expected no UUID for a filesystem unknown to udev, got %q", uuid)
+	}
+
+	devNumber := fmt.Sprintf("%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+	entry := "E:ID_FS_TYPE=ext4\nE:ID_FS_UUID=2f1c5e0a-6d1b-4c8e-9a57-0c1d2e3f4a5b\n"
+	if err := os.WriteFile(filepath.Join(udevDataDir, "b"+devNumber), []byte(entry), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uuid, err = u.GetFsUUID(mountPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if uuid != "2f1c5e0a-6d1b-4c8e-9a57-0c1d2e3f4a5b" {
+		t.Errorf("expected UUID from the udev database, got %q", uuid)
+	}
+}
+
+func TestGetMountRoot(t *testing.T) {
+	mountInfo := strings.Join([]string{
+		"20 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw",
+		"30 20 8:2 / /mnt/disks/vol1 rw,relatime shared:2 - ext4 /dev/sdb rw",
+		"31 20 8:3 /vol2 /mnt/disks/vol2 rw,relatime shared:3 - ext4 /dev/sdc rw",
+		"32 30 8:3 /vol3 /mnt/disks/vol1 rw,relatime shared:3 - ext4 /dev/sdc rw",
+	}, "\n")
+	mountInfoFile := filepath.Join(t.TempDir(), "mountinfo")
+	if err := os.WriteFile(mountInfoFile, []byte(mountInfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldMountInfoPath := mountInfoPath
+	mountInfoPath = mountInfoFile
+	t.Cleanup(func() {
+		mountInfoPath = oldMountInfoPath
+	})
+	u := &volumeUtil{}
+
+	tests := map[string]string{
+		"/mnt/disks/vol2": "/vol2",
+		// The last mount hides the previous ones.
+		"/mnt/disks/vol1": "/vol3",
+	}
+	for mountPath, expectedRoot := range tests {
+		root, err := u.GetMountRoot(mountPath)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if root != expectedRoot {
+			t.Errorf("expected root %q of %q, got %q", expectedRoot, mountPath, root)
+		}
+	}
+	if _, err := u.GetMountRoot("/mnt/disks/vol4"); err == nil {
+		t.Errorf("expected error for a path which is not a mount point")
+	}
+}
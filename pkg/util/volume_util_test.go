@@ -324,3 +324,43 @@ func TestGetPersistentVolumeNodeNames(t *testing.T) {
 		})
 	}
 }
+
+func TestFakeVolumeUtil_DeleteContents(t *testing.T) {
+	u := NewFakeVolumeUtil(false, map[string][]*FakeDirEntry{
+		"/mnt/disks": {{Name: "vol1", VolumeType: FakeEntryFile, Contents: 42}},
+	})
+	removed, err := u.DeleteContents("/mnt/disks/vol1", "/mnt/disks/vol1", "/mnt/disks")
+	if err != nil || removed != 42 {
+		t.Errorf("Expected 42 removed entries, got %d, err %v", removed, err)
+	}
+	// The contents are gone.
+	removed, err = u.DeleteContents("/mnt/disks/vol1", "/mnt/disks/vol1", "/mnt/disks")
+	if err != nil || removed != 0 {
+		t.Errorf("Expected no removed entries, got %d, err %v", removed, err)
+	}
+}
+
+func TestIsStrictlyBeneath(t *testing.T) {
+	tests := []struct {
+		name     string
+		dir      string
+		path     string
+		expected bool
+	}{
+		{name: "subdirectory", dir: "/mnt/disks", path: "/mnt/disks/vol1", expected: true},
+		{name: "nested subdirectory", dir: "/mnt/disks/", path: "/mnt/disks/a/vol1", expected: true},
+		{name: "same directory", dir: "/mnt/disks", path: "/mnt/disks/", expected: false},
+		{name: "sibling with the same prefix", dir: "/mnt/disks", path: "/mnt/disks2/vol1", expected: false},
+		{name: "escaping with dot dot", dir: "/mnt/disks", path: "/mnt/disks/../vol1", expected: false},
+		{name: "parent directory", dir: "/mnt/disks", path: "/mnt", expected: false},
+		{name: "file name starting with dot dot", dir: "/mnt/disks", path: "/mnt/disks/..vol1", expected: true},
+		{name: "relative path", dir: "/mnt/disks", path: "vol1", expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if beneath := IsStrictlyBeneath(test.dir, test.path); beneath != test.expected {
+				t.Errorf("Expected IsStrictlyBeneath(%q, %q) to be %v", test.dir, test.path, test.expected)
+			}
+		})
+	}
+}
@@ -45,6 +45,16 @@ func (u *volumeUtil) GetBlockCapacityByte(fullPath string) (int64, error) {
 	return 0, fmt.Errorf("GetBlockCapacityByte is unsupported in this build")
 }
 
+// GetBlockDeviceIdentity for unsupported platform returns error.
+func (u *volumeUtil) GetBlockDeviceIdentity(fullPath string) (*BlockDeviceIdentity, error) {
+	return nil, fmt.Errorf("GetBlockDeviceIdentity is unsupported in this build")
+}
+
+// GetFsUUID for unsupported platform returns error.
+func (u *volumeUtil) GetFsUUID(mountPath string) (string, error) {
+	return "", fmt.Errorf("GetFsUUID is unsupported in this build")
+}
+
 // IsBlock for unsupported platform returns error.
 func (u *volumeUtil) IsBlock(fullPath string) (bool, error) {
 	return false, fmt.Errorf("IsBlock is unsupported in this build")
@@ -55,6 +65,11 @@ func (u *volumeUtil) IsLikelyMountPoint(hostPath, mountPath string, mountPointMa
 }
 
 // DeleteContents deletes all the contents under the given directory
-func (u *volumeUtil) DeleteContents(hostPath, mountPath string) error {
-	return fmt.Errorf("DeleteContents is unsupported in this build")
+func (u *volumeUtil) DeleteContents(hostPath, mountPath, mountDir string) (int64, error) {
+	return 0, fmt.Errorf("DeleteContents is unsupported in this build")
+}
+
+// GetMountRoot for unsupported platform returns error.
+func (u *volumeUtil) GetMountRoot(mountPath string) (string, error) {
+	return "", fmt.Errorf("GetMountRoot is unsupported in this build")
 }
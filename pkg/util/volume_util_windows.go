@@ -56,21 +56,25 @@ func (u *volumeUtil) GetFsCapacityByte(hostPath, mountPath string) (int64, error
 	return totalBytes, nil
 }
 
-// DeleteContents deletes all the contents under the given directory
-func (u *volumeUtil) DeleteContents(hostPath, mountPath string) error {
+// DeleteContents deletes all the contents under the given directory by formatting the volume, so
+// the number of removed entries is unknown and reported as 0.
+func (u *volumeUtil) DeleteContents(hostPath, mountPath, mountDir string) (int64, error) {
+	if !IsStrictlyBeneath(mountDir, mountPath) {
+		return 0, fmt.Errorf("refusing to delete the contents of %q: not beneath %q", mountPath, mountDir)
+	}
 	// mountPath is in the context of the volume inside local volume provisioner
 	// the path to use in Windows is the one that CSI Proxy will use and it should
 	// be in the context of the host (because CSI Proxy doesn't know about the context
 	// of the local volume provisioner volumes)
 	volumeID, err := u.csiProxy.GetVolumeId(hostPath)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	err = u.csiProxy.FormatVolume(volumeID)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return 0, nil
 }
 
 // GetBlockCapacityByte is defined here for darwin and other platforms
@@ -79,6 +83,16 @@ func (u *volumeUtil) GetBlockCapacityByte(fullPath string) (int64, error) {
 	return 0, fmt.Errorf("GetBlockCapacityByte is unsupported in this build")
 }
 
+// GetBlockDeviceIdentity for unsupported platform returns error.
+func (u *volumeUtil) GetBlockDeviceIdentity(fullPath string) (*BlockDeviceIdentity, error) {
+	return nil, fmt.Errorf("GetBlockDeviceIdentity is unsupported in this build")
+}
+
+// GetFsUUID for Windows returns an empty UUID, filesystem UUIDs are not looked up on Windows.
+func (u *volumeUtil) GetFsUUID(mountPath string) (string, error) {
+	return "", nil
+}
+
 // IsBlock for unsupported platform returns error.
 func (u *volumeUtil) IsBlock(fullPath string) (bool, error) {
 	return false, fmt.Errorf("IsBlock is unsupported in this build")
@@ -94,3 +108,8 @@ func (u *volumeUtil) IsLikelyMountPoint(hostPath, mountPath string, mountPointMa
 	}
 	return isLikelyMountPoint, nil
 }
+
+// GetMountRoot for unsupported platform returns error.
+func (u *volumeUtil) GetMountRoot(mountPath string) (string, error) {
+	return "", fmt.Errorf("GetMountRoot is unsupported in this build")
+}
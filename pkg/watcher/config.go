@@ -17,60 +17,175 @@ limitations under the License.
 package watcher
 
 import (
+	"fmt"
+	"net/http"
 	"reflect"
+	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/metrics"
 )
 
-// ConfigWatcher monitors the config file periodically with the provided interval
+// ConfigWatcher loads the config periodically with the provided interval
 // and compares the provisioner config that is currently applied and the loaded provisioner
 // config. If a difference between the configs is detected, it will signal to the sync loop
-// to restart.
+// to restart. If the config can't be loaded, the last applied config is kept, and the
+// error is reported until a valid config is loaded. The config is also loaded soon after a
+// change of a watched directory.
 type ConfigWatcher struct {
-	configPath        string
+	load              common.ConfigLoader
 	resyncPeriod      time.Duration
 	lastAppliedConfig common.ProvisionerConfiguration
+	recorder          record.EventRecorder
+	node              *v1.Node
+	// dirWatcher watches the directories whose changes trigger a reload, if any
+	dirWatcher *fsnotify.Watcher
+
+	errorSync sync.RWMutex
+	// loadError is the error of the last load of the config, if it failed
+	loadError error
 }
 
 // NewConfigWatcher creates a new ConfigWatcher object with the provided
-// path of the config file, period to run the load and compare, and the initial
-// configuration that is currently being applied for the provisioner.
-func NewConfigWatcher(configPath string, resyncPeriod time.Duration, config common.ProvisionerConfiguration) *ConfigWatcher {
+// loader of the config, period to run the load and compare, and the initial
+// configuration that is currently being applied for the provisioner. The errors
+// loading the config are recorded as events of the node.
+func NewConfigWatcher(load common.ConfigLoader, resyncPeriod time.Duration, config common.ProvisionerConfiguration,
+	recorder record.EventRecorder, node *v1.Node) *ConfigWatcher {
 	return &ConfigWatcher{
-		configPath:        configPath,
+		load:              load,
 		resyncPeriod:      resyncPeriod,
 		lastAppliedConfig: config,
+		recorder:          recorder,
+		node:              node,
 	}
 }
 
+// dirChangeDelay is how long the config watcher waits after a change of a watched directory
+// before loading the config, so that the files being written are loaded together once complete.
+var dirChangeDelay = time.Second
+
+// WatchDir makes the ConfigWatcher load the config soon after a file of dir changes, in addition
+// to the periodic reloads. dir must exist.
+func (cw *ConfigWatcher) WatchDir(dir string) error {
+	if cw.dirWatcher == nil {
+		dirWatcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("error creating watcher: %v", err)
+		}
+		cw.dirWatcher = dirWatcher
+	}
+	if err := cw.dirWatcher.Add(dir); err != nil {
+		return fmt.Errorf("error watching directory %q: %v", dir, err)
+	}
+	return nil
+}
+
 // Run will start running the ConfigWatcher in a loop. During each reload cycle,
-// it loads the configuration from the config file on disk and compares with the last applied
+// it loads the configuration from its source and compares with the last applied
 // configuration. If there is a difference, it will send the loaded configuration to the
 // channel indicating restart sync loop is needed and then update its last applied configuration.
 func (cw *ConfigWatcher) Run(configUpdate chan<- common.ProvisionerConfiguration) {
-	provisionerConfig := common.ProvisionerConfiguration{
-		StorageClassConfig: make(map[string]common.MountConfig),
-		MinResyncPeriod:    metav1.Duration{Duration: 5 * time.Minute},
+	var dirEvents <-chan fsnotify.Event
+	var dirErrors <-chan error
+	if cw.dirWatcher != nil {
+		defer cw.dirWatcher.Close()
+		dirEvents, dirErrors = cw.dirWatcher.Events, cw.dirWatcher.Errors
 	}
-
+	// dirChanged fires once the changes of the watched directories have settled.
+	var dirChanged <-chan time.Time
 	for {
 		select {
 		case <-time.After(cw.resyncPeriod):
-			if err := common.LoadProvisionerConfigs(cw.configPath, &provisionerConfig); err != nil {
-				klog.Fatalf("Error parsing Provisioner's configuration: %#v. Exiting...\n", err)
+			cw.reload(configUpdate)
+		case <-dirChanged:
+			dirChanged = nil
+			cw.reload(configUpdate)
+		case event, ok := <-dirEvents:
+			if !ok {
+				dirEvents = nil
+				continue
+			}
+			if event.Op&fsnotify.Chmod == event.Op {
+				continue
+			}
+			klog.V(5).Infof("Config directory change: %v", event)
+			if dirChanged == nil {
+				dirChanged = time.After(dirChangeDelay)
 			}
+		case err, ok := <-dirErrors:
+			if !ok {
+				dirErrors = nil
+				continue
+			}
+			// The config is still loaded periodically.
+			klog.Errorf("Error watching config directories: %v", err)
+		}
+	}
+}
 
-			if !reflect.DeepEqual(cw.lastAppliedConfig, provisionerConfig) {
-				klog.Infof("Loaded and detected updated configuration: %+v", provisionerConfig)
-				klog.Infof("Signalling sync loop to restart to pick up updated configuration...")
+// reload loads the config, and sends it to configUpdate if it changed. If it can't be
+// loaded, the last applied config is kept, and it is loaded again on the next cycle.
+func (cw *ConfigWatcher) reload(configUpdate chan<- common.ProvisionerConfiguration) {
+	// The config is loaded from scratch, so that a failed load doesn't alter the applied one.
+	provisionerConfig := common.ProvisionerConfiguration{
+		StorageClassConfig: make(map[string]common.MountConfig),
+		MinResyncPeriod:    metav1.Duration{Duration: 5 * time.Minute},
+	}
+	if err := cw.load(&provisionerConfig); err != nil {
+		cw.recordLoadError(err)
+		return
+	}
+	cw.recordLoadError(nil)
 
-				configUpdate <- provisionerConfig
-				cw.lastAppliedConfig = provisionerConfig
-			}
+	if !reflect.DeepEqual(cw.lastAppliedConfig, provisionerConfig) {
+		klog.Infof("Loaded and detected updated configuration: %+v", provisionerConfig)
+		klog.Infof("Signalling sync loop to pick up updated configuration...")
+
+		configUpdate <- provisionerConfig
+		cw.lastAppliedConfig = provisionerConfig
+	}
+}
+
+// recordLoadError records the result of the last load of the config. Each new error is
+// reported by an event of the node, and every failed load is counted.
+func (cw *ConfigWatcher) recordLoadError(err error) {
+	cw.errorSync.Lock()
+	defer cw.errorSync.Unlock()
+	if err == nil {
+		if cw.loadError != nil {
+			klog.Infof("Loaded a valid configuration again")
 		}
+		cw.loadError = nil
+		return
+	}
+	metrics.ConfigReloadFailuresTotal.Inc()
+	klog.Errorf("Error parsing Provisioner's configuration, keeping the last applied one: %v", err)
+	if cw.loadError == nil || cw.loadError.Error() != err.Error() {
+		cw.recorder.Eventf(cw.node, v1.EventTypeWarning, common.EventProvisionerConfigInvalid,
+			"Error parsing Provisioner's configuration, keeping the last applied one: %v", err)
+	}
+	cw.loadError = err
+}
+
+// Check returns an error if the last load of the config failed
+func (cw *ConfigWatcher) Check(_ *http.Request) error {
+	cw.errorSync.RLock()
+	defer cw.errorSync.RUnlock()
+	if cw.loadError != nil {
+		return fmt.Errorf("invalid configuration: %v", cw.loadError)
 	}
+	return nil
+}
+
+// Name returns the name of this ReadyzCheck
+func (cw *ConfigWatcher) Name() string {
+	return "ConfigReadyzCheck"
 }
@@ -0,0 +1,174 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/common"
+	"sigs.k8s.io/sig-storage-local-static-provisioner/pkg/metrics"
+)
+
+func TestConfigWatcher_Reload(t *testing.T) {
+	configPath := t.TempDir()
+	writeConfig := func(storageClassMap string) {
+		if err := os.WriteFile(filepath.Join(configPath, common.ProvisonerStorageClassConfig), []byte(storageClassMap), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	recorder := record.NewFakeRecorder(10)
+	cw := NewConfigWatcher(common.ConfigMapLoader(configPath, ""), 0, common.ProvisionerConfiguration{}, recorder, node)
+	configUpdate := make(chan common.ProvisionerConfiguration, 1)
+	failures := testutil.ToFloat64(metrics.ConfigReloadFailuresTotal)
+
+	// A valid config is applied.
+	writeConfig("local-storage:\n  hostDir: /mnt/disks\n  mountDir: /mnt/disks\n")
+	cw.reload(configUpdate)
+	select {
+	case config := <-configUpdate:
+		if _, ok := config.StorageClassConfig["local-storage"]; !ok {
+			t.Errorf("Expected the local-storage class to be applied, got %+v", config)
+		}
+	default:
+		t.Fatalf("Expected the config to be applied")
+	}
+	if err := cw.Check(nil); err != nil {
+		t.Errorf("Expected the config watcher to be ready: %v", err)
+	}
+
+	// An invalid config is reported, and the applied one is kept.
+	writeConfig("local-storage:\n  hostDir: /mnt/disks\n  mountDir: /mnt/disks\n  volumeMode: Wrong\n")
+	for i := 0; i < 2; i++ {
+		cw.reload(configUpdate)
+	}
+	select {
+	case config := <-configUpdate:
+		t.Errorf("Unexpected config applied: %+v", config)
+	default:
+	}
+	if err := cw.Check(nil); err == nil {
+		t.Errorf("Expected the config watcher not to be ready")
+	}
+	if cw.lastAppliedConfig.StorageClassConfig["local-storage"].VolumeMode != "Filesystem" {
+		t.Errorf("Expected the applied config to be kept, got %+v", cw.lastAppliedConfig)
+	}
+	if count := testutil.ToFloat64(metrics.ConfigReloadFailuresTotal) - failures; count != 2 {
+		t.Errorf("Expected 2 reload failures, got %v", count)
+	}
+	// The same error is only reported once.
+	if len(recorder.Events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, v1.EventTypeWarning+" "+common.EventProvisionerConfigInvalid) {
+		t.Errorf("Unexpected event %q", event)
+	}
+
+	// The config is applied once it is fixed.
+	writeConfig("local-storage:\n  hostDir: /mnt/disks\n  mountDir: /mnt/disks\n  volumeMode: Block\n")
+	cw.reload(configUpdate)
+	select {
+	case config := <-configUpdate:
+		if config.StorageClassConfig["local-storage"].VolumeMode != "Block" {
+			t.Errorf("Expected the fixed config to be applied, got %+v", config)
+		}
+	default:
+		t.Fatalf("Expected the fixed config to be applied")
+	}
+	if err := cw.Check(nil); err != nil {
+		t.Errorf("Expected the config watcher to be ready: %v", err)
+	}
+}
+
+func TestConfigWatcher_ReloadDropIn(t *testing.T) {
+	configPath, dropInDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(configPath, common.ProvisonerStorageClassConfig), []byte("local-storage:\n  hostDir: /mnt/disks\n  mountDir: /mnt/disks\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	cw := NewConfigWatcher(common.ConfigMapLoader(configPath, dropInDir), 0, common.ProvisionerConfiguration{}, record.NewFakeRecorder(10), node)
+	configUpdate := make(chan common.ProvisionerConfiguration, 1)
+	cw.reload(configUpdate)
+	<-configUpdate
+
+	// A class added by a drop-in file is applied.
+	if err := os.WriteFile(filepath.Join(dropInDir, "nvme.yaml"), []byte("storageClassMap:\n  nvme:\n    hostDir: /mnt/nvme\n    mountDir: /mnt/nvme\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cw.reload(configUpdate)
+	select {
+	case config := <-configUpdate:
+		if _, ok := config.StorageClassConfig["nvme"]; !ok {
+			t.Errorf("Expected the nvme class to be applied, got %+v", config)
+		}
+		if _, ok := config.StorageClassConfig["local-storage"]; !ok {
+			t.Errorf("Expected the local-storage class to be kept, got %+v", config)
+		}
+	default:
+		t.Fatalf("Expected the config to be applied")
+	}
+}
+
+func TestConfigWatcher_WatchDir(t *testing.T) {
+	configPath, dropInDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(configPath, common.ProvisonerStorageClassConfig), []byte("local-storage:\n  hostDir: /mnt/disks\n  mountDir: /mnt/disks\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldDirChangeDelay := dirChangeDelay
+	dirChangeDelay = 10 * time.Millisecond
+	t.Cleanup(func() {
+		dirChangeDelay = oldDirChangeDelay
+	})
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	// The periodic reloads never happen during the test.
+	cw := NewConfigWatcher(common.ConfigMapLoader(configPath, dropInDir), time.Hour, common.ProvisionerConfiguration{}, record.NewFakeRecorder(10), node)
+	if err := cw.WatchDir(dropInDir); err != nil {
+		t.Fatal(err)
+	}
+	configUpdate := make(chan common.ProvisionerConfiguration, 1)
+	go cw.Run(configUpdate)
+
+	// A drop-in file is loaded once it is written.
+	if err := os.WriteFile(filepath.Join(dropInDir, "nvme.yml"), []byte("storageClassMap:\n  nvme:\n    hostDir: /mnt/nvme\n    mountDir: /mnt/nvme\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case config := <-configUpdate:
+		if _, ok := config.StorageClassConfig["nvme"]; !ok {
+			t.Errorf("Expected the nvme class to be applied, got %+v", config)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Expected the config to be reloaded after the drop-in directory changed")
+	}
+}
+
+func TestConfigWatcher_WatchMissingDir(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	cw := NewConfigWatcher(common.ConfigMapLoader(t.TempDir(), ""), time.Hour, common.ProvisionerConfiguration{}, record.NewFakeRecorder(10), node)
+	if err := cw.WatchDir(filepath.Join(t.TempDir(), "conf.d")); err == nil {
+		t.Errorf("Expected an error watching a missing directory")
+	}
+}